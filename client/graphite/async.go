@@ -0,0 +1,191 @@
+// Copyright 2024-2025 NetCracker Technology Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package graphite
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"time"
+
+	adapter "github.com/Netcracker/qubership-graphite-remote-adapter/client"
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/config"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+var (
+	asyncQueueDepth = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "remote_adapter_graphite",
+			Name:      "async_queue_depth",
+			Help:      "Number of write requests waiting in the async queue.",
+		},
+	)
+	asyncBatchSize = promauto.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: "remote_adapter_graphite",
+			Name:      "async_batch_size_bytes",
+			Help:      "Size of the encoded datapoints of the batches sent by the async workers.",
+			Buckets:   prometheus.ExponentialBuckets(1<<10, 4, 8),
+		},
+	)
+	asyncFlushLatency = promauto.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: "remote_adapter_graphite",
+			Name:      "async_flush_latency_seconds",
+			Help:      "Time between the queueing of the oldest request of a batch and the end of its flush.",
+			Buckets:   prometheus.DefBuckets,
+		},
+	)
+	asyncFailedSamples = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "remote_adapter_graphite",
+			Name:      "async_failed_samples_total",
+			Help:      "Total number of queued samples which failed on send to a carbon destination.",
+		},
+		[]string{"destination"},
+	)
+)
+
+// errAsyncQueueFull is returned by Write when the async queue cannot take more requests.
+var errAsyncQueueFull = errors.New("async write queue is full")
+
+// asyncRequest holds the time series of a write request waiting in the async queue.
+type asyncRequest struct {
+	series []prompb.TimeSeries
+	prefix string
+	queued time.Time
+}
+
+// startAsync starts the workers of the async write mode.
+func (client *Client) startAsync(asyncCfg *config.AsyncConfig) {
+	cfg := *asyncCfg
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = config.DefaultAsyncConfig.QueueSize
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = config.DefaultAsyncConfig.Workers
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = config.DefaultAsyncConfig.BatchSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = config.DefaultAsyncConfig.FlushInterval
+	}
+	client.asyncQueue = make(chan asyncRequest, cfg.QueueSize)
+	client.asyncFlushInterval = cfg.FlushInterval
+	client.asyncStop = make(chan struct{})
+	for i := 0; i < cfg.Workers; i++ {
+		client.asyncWG.Add(1)
+		go client.runAsyncWorker(&cfg)
+	}
+}
+
+// stopAsync stops the workers once they have sent the queued samples.
+func (client *Client) stopAsync() {
+	if client.asyncStop == nil {
+		return
+	}
+	close(client.asyncStop)
+	client.asyncWG.Wait()
+}
+
+// enqueue queues time series to be sent by the async workers, it fails without waiting when the queue is full.
+func (client *Client) enqueue(series []prompb.TimeSeries, prefix string) error {
+	select {
+	case client.asyncQueue <- asyncRequest{series: series, prefix: prefix, queued: time.Now()}:
+		asyncQueueDepth.Set(float64(len(client.asyncQueue)))
+		return nil
+	default:
+		// A worker frees the queue at the latest after a flush interval.
+		return &adapter.ThrottledError{Err: errAsyncQueueFull, RetryAfter: client.asyncFlushInterval}
+	}
+}
+
+// runAsyncWorker batches queued samples. A batch is sent when its size reaches the batch size,
+// at each flush interval, and when the worker is stopped.
+func (client *Client) runAsyncWorker(cfg *config.AsyncConfig) {
+	defer client.asyncWG.Done()
+
+	ticker := time.NewTicker(cfg.FlushInterval)
+	defer ticker.Stop()
+
+	bytesBuffers, counts := client.newBuffers()
+	size := 0
+	var oldest time.Time
+	add := func(req asyncRequest) {
+		asyncQueueDepth.Set(float64(len(client.asyncQueue)))
+		if size == 0 {
+			oldest = req.queued
+		}
+		client.encodeSeries(bytesBuffers, counts, req.series, req.prefix, cfg.BatchSize)
+		if size = client.bufferedBytes(bytesBuffers); size >= cfg.BatchSize {
+			client.flushAsync(bytesBuffers, counts, size, oldest)
+			bytesBuffers, counts = client.newBuffers()
+			size = 0
+		}
+	}
+	flush := func() {
+		if size > 0 {
+			client.flushAsync(bytesBuffers, counts, size, oldest)
+			bytesBuffers, counts = client.newBuffers()
+			size = 0
+		}
+	}
+
+	for {
+		select {
+		case req := <-client.asyncQueue:
+			add(req)
+		case <-ticker.C:
+			flush()
+		case <-client.asyncStop:
+			for {
+				select {
+				case req := <-client.asyncQueue:
+					add(req)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// flushAsync sends a batch of queued samples to carbon.
+func (client *Client) flushAsync(bytesBuffers [][][]*bytes.Buffer, counts []int, size int, oldest time.Time) {
+	ctx := context.Background()
+	if client.writeTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, client.writeTimeout)
+		defer cancel()
+	}
+
+	_, errs := client.send(ctx, bytesBuffers, counts)
+	for i, err := range errs {
+		if err != nil {
+			d := client.destinations[i]
+			_ = level.Warn(client.logger).Log("destination", d.address, "num_samples", counts[i], "err", err, "msg", "Error sending queued samples to carbon")
+			asyncFailedSamples.WithLabelValues(d.address).Add(float64(counts[i]))
+		}
+	}
+	asyncBatchSize.Observe(float64(size))
+	asyncFlushLatency.Observe(time.Since(oldest).Seconds())
+}
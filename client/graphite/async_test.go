@@ -0,0 +1,93 @@
+// Copyright 2024-2025 NetCracker Technology Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package graphite
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	adapter "github.com/Netcracker/qubership-graphite-remote-adapter/client"
+	graphiteconfig "github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/config"
+	"github.com/Netcracker/qubership-graphite-remote-adapter/config"
+	"github.com/go-kit/log"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAsyncCoalesce(t *testing.T) {
+	srv := newCarbonServer(t)
+	cfg := config.DefaultConfig
+	cfg.Graphite.Write.CarbonAddress = srv.Addr()
+	cfg.Graphite.Write.Async = &graphiteconfig.AsyncConfig{QueueSize: 100, Workers: 1, BatchSize: 1 << 20, FlushInterval: time.Hour}
+	client := NewClient(&cfg, log.NewNopLogger(), nil, nil)
+	defer client.Shutdown()
+
+	for i := 0; i < 10; i++ {
+		response, err := writeSeries(client, false, testSeries(fmt.Sprintf("metric_%d", i), prompb.Sample{Value: 1, Timestamp: 1000}))
+		require.NoError(t, err)
+		require.Equal(t, "Queued.", string(response))
+	}
+	// Dry runs are not queued.
+	response, err := writeSeries(client, true, testSeries("metric", prompb.Sample{Value: 1, Timestamp: 1000}))
+	require.NoError(t, err)
+	require.Equal(t, "metric 1.000000 1\n", string(response))
+
+	// Requests are batched until the batch is full or the flush interval elapsed.
+	time.Sleep(100 * time.Millisecond)
+	require.Empty(t, srv.lines(t, 0))
+
+	// Queued samples are sent when the client shuts down.
+	client.Shutdown()
+	require.Len(t, srv.lines(t, 10), 10)
+}
+
+func TestAsyncBatchSize(t *testing.T) {
+	srv := newCarbonServer(t)
+	cfg := config.DefaultConfig
+	cfg.Graphite.Write.CarbonAddress = srv.Addr()
+	cfg.Graphite.Write.Async = &graphiteconfig.AsyncConfig{QueueSize: 100, Workers: 2, BatchSize: 1, FlushInterval: time.Hour}
+	client := NewClient(&cfg, log.NewNopLogger(), nil, nil)
+	defer client.Shutdown()
+
+	// Full batches are sent without waiting for the flush interval.
+	for i := 0; i < 10; i++ {
+		_, err := writeSeries(client, false, testSeries(fmt.Sprintf("metric_%d", i), prompb.Sample{Value: 1, Timestamp: 1000}))
+		require.NoError(t, err)
+	}
+	require.Len(t, srv.lines(t, 10), 10)
+}
+
+func TestAsyncQueueFull(t *testing.T) {
+	cfg := config.DefaultConfig
+	cfg.Graphite.Write.CarbonAddress = deadAddress(t)
+	cfg.Graphite.Write.CarbonRetry.MaxRetries = 1
+	cfg.Graphite.Write.CarbonRetry.MinBackoff = time.Second
+	cfg.Graphite.Write.Async = &graphiteconfig.AsyncConfig{QueueSize: 1, Workers: 1, BatchSize: 1, FlushInterval: 50 * time.Millisecond}
+	client := NewClient(&cfg, log.NewNopLogger(), nil, nil)
+	defer client.Shutdown()
+
+	// The worker waits for carbon while the queue fills up.
+	var err error
+	for i := 0; i < 10 && err == nil; i++ {
+		_, err = writeSeries(client, false, testSeries("metric", prompb.Sample{Value: 1, Timestamp: 1000}))
+	}
+	require.ErrorIs(t, err, errAsyncQueueFull)
+	var throttled *adapter.ThrottledError
+	require.True(t, errors.As(err, &throttled))
+	require.Equal(t, 50*time.Millisecond, throttled.RetryAfter)
+}
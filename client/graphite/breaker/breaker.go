@@ -0,0 +1,161 @@
+// Copyright 2024-2025 NetCracker Technology Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package breaker implements a circuit breaker failing writes fast while a destination is down.
+package breaker
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrOpen is returned instead of writing while the circuit breaker is open.
+var ErrOpen = errors.New("circuit breaker is open")
+
+// State of the circuit breaker.
+type State int
+
+// Circuit breaker states, in the order exposed by metrics.
+const (
+	// Closed lets all writes through.
+	Closed State = iota
+	// Open fails writes fast until the open timeout expires.
+	Open
+	// HalfOpen lets a single probe write through to check whether the destination recovered.
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// Breaker opens after a number of consecutive failures and probes for recovery once opened.
+// A nil Breaker always lets writes through.
+type Breaker struct {
+	threshold   int
+	openTimeout time.Duration
+	onChange    func(State)
+	now         func() time.Time
+
+	lock     sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// New returns a breaker opening after threshold consecutive failures, for openTimeout.
+// It returns nil if threshold is not positive. onChange, if not nil, is called on each state change.
+func New(threshold int, openTimeout time.Duration, onChange func(State)) *Breaker {
+	if threshold <= 0 {
+		return nil
+	}
+	b := &Breaker{
+		threshold:   threshold,
+		openTimeout: openTimeout,
+		onChange:    onChange,
+		now:         time.Now,
+	}
+	if onChange != nil {
+		onChange(Closed)
+	}
+	return b
+}
+
+// Allow reports whether a write may be attempted. Once the open timeout expired,
+// a single caller is allowed to probe the destination; it must report the outcome.
+func (b *Breaker) Allow() bool {
+	if b == nil {
+		return true
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	switch b.state {
+	case Open:
+		if b.now().Sub(b.openedAt) < b.openTimeout {
+			return false
+		}
+		b.setState(HalfOpen)
+		b.probing = true
+		return true
+	case HalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	}
+	return true
+}
+
+// Success reports a successful write and closes the breaker.
+func (b *Breaker) Success() {
+	if b == nil {
+		return
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.failures = 0
+	b.probing = false
+	b.setState(Closed)
+}
+
+// Failure reports a failed write. It opens the breaker after threshold consecutive
+// failures, or as soon as a probe fails.
+func (b *Breaker) Failure() {
+	if b == nil {
+		return
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.failures++
+	b.probing = false
+	if b.state == HalfOpen || b.failures >= b.threshold {
+		b.openedAt = b.now()
+		b.setState(Open)
+	}
+}
+
+// State returns the current state of the breaker.
+func (b *Breaker) State() State {
+	if b == nil {
+		return Closed
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.state
+}
+
+func (b *Breaker) setState(state State) {
+	if b.state == state {
+		return
+	}
+	b.state = state
+	if b.onChange != nil {
+		b.onChange(state)
+	}
+}
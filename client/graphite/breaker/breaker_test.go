@@ -0,0 +1,84 @@
+// Copyright 2024-2025 NetCracker Technology Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package breaker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testBreaker(threshold int, openTimeout time.Duration) (*Breaker, *time.Time, *[]State) {
+	var states []State
+	b := New(threshold, openTimeout, func(s State) { states = append(states, s) })
+	now := time.Unix(1600000000, 0)
+	b.now = func() time.Time { return now }
+	return b, &now, &states
+}
+
+func TestBreakerOpensAfterThreshold(t *testing.T) {
+	b, _, states := testBreaker(3, time.Minute)
+
+	for i := 0; i < 2; i++ {
+		require.True(t, b.Allow())
+		b.Failure()
+	}
+	require.Equal(t, Closed, b.State())
+
+	// A success resets consecutive failures.
+	b.Success()
+	for i := 0; i < 3; i++ {
+		require.True(t, b.Allow())
+		b.Failure()
+	}
+	require.Equal(t, Open, b.State())
+	require.False(t, b.Allow())
+	require.Equal(t, []State{Closed, Open}, *states)
+}
+
+func TestBreakerProbes(t *testing.T) {
+	b, now, states := testBreaker(1, time.Minute)
+
+	b.Failure()
+	require.False(t, b.Allow())
+
+	*now = now.Add(time.Minute)
+	require.True(t, b.Allow())
+	require.Equal(t, HalfOpen, b.State())
+	// Only a single probe is let through.
+	require.False(t, b.Allow())
+
+	// A failed probe opens the breaker for another timeout.
+	b.Failure()
+	require.Equal(t, Open, b.State())
+	require.False(t, b.Allow())
+
+	*now = now.Add(time.Minute)
+	require.True(t, b.Allow())
+	b.Success()
+	require.Equal(t, Closed, b.State())
+	require.True(t, b.Allow())
+	require.Equal(t, []State{Closed, Open, HalfOpen, Open, HalfOpen, Closed}, *states)
+}
+
+func TestDisabledBreaker(t *testing.T) {
+	b := New(0, time.Minute, nil)
+	require.Nil(t, b)
+	b.Failure()
+	require.True(t, b.Allow())
+	require.Equal(t, Closed, b.State())
+}
@@ -16,16 +16,27 @@
 package graphite
 
 import (
-	"net"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	graphiteCfg "github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/config"
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/hashing"
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/limiter"
 	"github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/paths"
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/protocol"
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/spool"
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/metadata"
 	"github.com/Netcracker/qubership-graphite-remote-adapter/config"
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
-	"github.com/prometheus/client_golang/prometheus"
+	promconfig "github.com/prometheus/common/config"
 )
 
 const (
@@ -37,23 +48,58 @@ const (
 // Client allows sending batches of Prometheus samples to Graphite.
 type Client struct {
 	//lock           sync.RWMutex
-	cfg            *graphiteCfg.Config
-	writeTimeout   time.Duration
-	readTimeout    time.Duration
-	readDelay      time.Duration
-	ignoredSamples prometheus.Counter
-	format         paths.Format
+	cfg          *graphiteCfg.Config
+	writeTimeout time.Duration
+	readTimeout  time.Duration
+	readDelay    time.Duration
+	format       paths.Format
+	encoder      protocol.Encoder
+	tlsConfig    *tls.Config
+	// Error loading the TLS config, returned by writes instead of connecting without it.
+	tlsErr      error
+	compressors *compressors
+	httpClient  *http.Client
 
-	carbonCon               net.Conn
-	carbonLastReconnectTime time.Time
-	carbonConLock           sync.Mutex
+	// Encoder of dry runs, which show datapoints as plaintext lines whatever the carbon protocol.
+	dryRunEncoder protocol.Encoder
+
+	destinations        []*destination
+	connsPerDestination int
+	ring                *hashing.Ring
+	encodeWorkers       int
+
+	// metadata of the metric families received, nil when paths do not depend on them.
+	metadata *metadata.Cache
+
+	// Length limits of the paths written, nil when paths are not limited.
+	pathLimits *paths.Limits
+	// Original values of shortened nodes, nil when they are not recorded.
+	pathsIndex *paths.Index
+
+	// Series cardinality limiter, nil when series are not limited.
+	limiter *limiter.Limiter
+	// Time of the last log of a series over budget, in nanoseconds.
+	limitLogged atomic.Int64
+
+	spoolStop chan struct{}
+	spoolWG   sync.WaitGroup
+
+	asyncQueue         chan asyncRequest
+	asyncFlushInterval time.Duration
+	asyncStop          chan struct{}
+	asyncWG            sync.WaitGroup
+
+	// Shutdown closes channels, spools and connections once, whatever the number of calls.
+	shutdownOnce sync.Once
 
 	logger log.Logger
 }
 
-// NewClient returns a new Client.
-func NewClient(cfg *config.Config, logger log.Logger) *Client {
-	if cfg.Graphite.Write.CarbonAddress == "" && cfg.Graphite.Read.URL == "" {
+// NewClient returns a new Client. The metadata of metric families, if not nil, are matched by write rules.
+// The cardinality limiter, if not nil, tracks the active series when limits are configured, so that it is
+// shared by successive clients; a new limiter is used otherwise.
+func NewClient(cfg *config.Config, logger log.Logger, md *metadata.Cache, lim *limiter.Limiter) *Client {
+	if len(cfg.Graphite.Write.Destinations()) == 0 && cfg.Graphite.Read.URL == "" {
 		return nil
 	}
 	if cfg.Graphite.Write.EnablePathsCache {
@@ -75,31 +121,159 @@ func NewClient(cfg *config.Config, logger log.Logger) *Client {
 		}
 	}
 
-	return &Client{
+	client := &Client{
 		logger:       logger,
 		cfg:          &cfg.Graphite,
 		writeTimeout: cfg.Write.Timeout,
 		format:       format,
+		encoder:      protocol.NewEncoder(cfg.Graphite.Write.CarbonProtocol, cfg.Graphite.Write.TimestampPrecision),
+		compressors:  newCompressors(&cfg.Graphite.Write, logger),
 		readTimeout:  cfg.Read.Timeout,
 		readDelay:    cfg.Read.Delay,
-		ignoredSamples: prometheus.NewCounter(
-			prometheus.CounterOpts{
-				Namespace: "remote_adapter_graphite",
-				Name:      "ignored_samples_total",
-				Help:      "The total number of samples not sent to Graphite due to unsupported float values (Inf, -Inf, NaN).",
-			},
-		),
-		carbonCon:               nil,
-		carbonLastReconnectTime: time.Time{},
-		carbonConLock:           sync.Mutex{},
+		metadata:     md,
+	}
+
+	transport := cfg.Graphite.Write.CarbonTransport
+	if transport == "tls" || transport == "http" && cfg.Graphite.Write.CarbonTLS != nil {
+		tlsCfg := cfg.Graphite.Write.CarbonTLS
+		if tlsCfg == nil {
+			tlsCfg = &promconfig.TLSConfig{}
+		}
+		client.tlsConfig, client.tlsErr = promconfig.NewTLSConfig(tlsCfg)
+		if client.tlsErr != nil {
+			client.tlsErr = fmt.Errorf("failed to load carbon TLS config: %w", client.tlsErr)
+			_ = level.Error(logger).Log("err", client.tlsErr, "msg", "Writes to carbon fail until the TLS config is fixed")
+		}
+	}
+
+	client.connsPerDestination = cfg.Graphite.Write.CarbonConnections
+	if client.connsPerDestination < 1 {
+		client.connsPerDestination = 1
+	}
+	client.encodeWorkers = cfg.Graphite.Write.EncodeWorkers
+	if client.encodeWorkers == 0 {
+		client.encodeWorkers = runtime.GOMAXPROCS(0)
+	}
+	if transport == "http" {
+		client.encoder = protocol.NewMessageEncoder(cfg.Graphite.Write.CarbonProtocol, cfg.Graphite.Write.TimestampPrecision)
+		httpTransport := http.DefaultTransport.(*http.Transport).Clone()
+		httpTransport.TLSClientConfig = client.tlsConfig
+		httpTransport.MaxIdleConnsPerHost = client.connsPerDestination
+		client.httpClient = &http.Client{
+			Transport: httpTransport,
+			Timeout:   cfg.Graphite.Write.CarbonWriteDeadline,
+		}
+	}
+	client.dryRunEncoder = client.encoder
+	if cfg.Graphite.Write.CarbonProtocol != graphiteCfg.ProtocolPlaintext {
+		client.dryRunEncoder = protocol.NewEncoder(graphiteCfg.ProtocolPlaintext, cfg.Graphite.Write.TimestampPrecision)
+	}
+	destinations := cfg.Graphite.Write.Destinations()
+	nodes := make([]hashing.Node, 0, len(destinations))
+	for _, dest := range destinations {
+		address, node := parseDestination(dest)
+		switch transport {
+		case "unix":
+			// The destination is the path of the socket.
+			address, node = dest, hashing.Node{Server: dest}
+		case "http":
+			// The destination is the URL of the receiver.
+			address, node = dest, hashing.Node{Server: dest}
+			if u, err := url.Parse(dest); err == nil && u.Hostname() != "" {
+				node.Server = u.Hostname()
+			}
+		}
+		nodes = append(nodes, node)
+		client.destinations = append(client.destinations, newDestination(address, node, client.connsPerDestination, cfg.Graphite.Write.CarbonCircuitBreaker))
+	}
+	if len(nodes) > 1 && cfg.Graphite.Write.CarbonRouting != graphiteCfg.RoutingReplicate {
+		client.ring = hashing.NewRing(hashing.Type(cfg.Graphite.Write.CarbonHashing), nodes)
+	}
+
+	if spoolCfg := cfg.Graphite.Write.Spool; spoolCfg != nil && spoolCfg.Directory != "" {
+		interval := spoolCfg.ReplayInterval
+		if interval <= 0 {
+			interval = graphiteCfg.DefaultSpoolConfig.ReplayInterval
+		}
+		client.spoolStop = make(chan struct{})
+		for _, d := range client.destinations {
+			dCfg := *spoolCfg
+			if len(client.destinations) > 1 {
+				// Each destination has its own spool, replayed independently.
+				dCfg.Directory = filepath.Join(spoolCfg.Directory, spoolDirName(d.address))
+			}
+			s, err := spool.Open(d.address, &dCfg, log.With(logger, "component", "spool", "destination", d.address))
+			if err != nil {
+				_ = level.Error(logger).Log("err", err, "directory", dCfg.Directory, "destination", d.address, "msg", "Failed to open spool, spooling disabled")
+				continue
+			}
+			d.spool = s
+			client.spoolWG.Add(1)
+			go client.replaySpool(d, interval)
+		}
+	}
+
+	if pathLimits := cfg.Graphite.Write.PathLimits; pathLimits != nil && pathLimits.IndexFile != "" {
+		index, err := paths.OpenIndex(pathLimits.IndexFile, log.With(logger, "component", "paths_index"))
+		if err != nil {
+			_ = level.Error(logger).Log("err", err, "file", pathLimits.IndexFile, "msg", "Failed to open paths index, shortened nodes are not recorded")
+		} else {
+			client.pathsIndex = index
+		}
+	}
+	client.pathLimits = paths.NewLimits(cfg.Graphite.Write.PathLimits, client.pathsIndex)
+
+	if cfg.Graphite.Write.Limits != nil {
+		client.limiter = lim
+		if client.limiter == nil {
+			client.limiter = limiter.New(cfg.Graphite.Write.Limits)
+		}
+	}
+
+	if asyncCfg := cfg.Graphite.Write.Async; asyncCfg != nil && len(client.destinations) > 0 {
+		client.startAsync(asyncCfg)
 	}
+
+	return client
 }
 
 // Shutdown the client.
 func (client *Client) Shutdown() {
-	client.carbonConLock.Lock()
-	defer client.carbonConLock.Unlock()
-	client.disconnectFromCarbon()
+	client.shutdownOnce.Do(client.shutdown)
+}
+
+func (client *Client) shutdown() {
+	// Queued samples are sent, or spooled, before connections and spools are closed.
+	client.stopAsync()
+	if client.spoolStop != nil {
+		close(client.spoolStop)
+		client.spoolWG.Wait()
+	}
+	for _, d := range client.destinations {
+		if d.spool != nil {
+			if err := d.spool.Close(); err != nil {
+				_ = level.Error(client.logger).Log("err", err, "destination", d.address, "msg", "Failed to close spool")
+			}
+		}
+		for _, c := range d.conns {
+			c.lock.Lock()
+			client.endFrame(c)
+			client.disconnectFromCarbon(c)
+			if c.lz4 != nil {
+				_ = c.lz4.Close()
+				c.lz4 = nil
+			}
+			c.lock.Unlock()
+		}
+	}
+	if client.pathsIndex != nil {
+		if err := client.pathsIndex.Close(); err != nil {
+			_ = level.Error(client.logger).Log("err", err, "msg", "Failed to close paths index")
+		}
+	}
+	if client.httpClient != nil {
+		client.httpClient.CloseIdleConnections()
+	}
 }
 
 // Name implements the client.Client interface.
@@ -109,10 +283,17 @@ func (client *Client) Name() string {
 
 // Target respond with a more low level representation of the client's remote
 func (client *Client) Target() string {
-	if client.carbonCon == nil {
-		return "unknown"
+	for _, d := range client.destinations {
+		for _, c := range d.conns {
+			c.lock.Lock()
+			conn := c.conn
+			c.lock.Unlock()
+			if conn != nil {
+				return conn.RemoteAddr().String()
+			}
+		}
 	}
-	return client.carbonCon.RemoteAddr().String()
+	return "unknown"
 }
 
 // String implements the client.Client interface.
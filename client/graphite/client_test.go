@@ -21,6 +21,7 @@ import (
 	"testing"
 
 	"github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/config"
+	adapterconfig "github.com/Netcracker/qubership-graphite-remote-adapter/config"
 	"github.com/go-kit/log"
 )
 
@@ -56,3 +57,19 @@ func TestGetCustomGraphitePrefix(t *testing.T) {
 		t.Errorf("Expected %s, got %s", expectedPrefix, actualPrefix)
 	}
 }
+
+func TestShutdownTwice(t *testing.T) {
+	spoolCfg := config.DefaultSpoolConfig
+	spoolCfg.Directory = t.TempDir()
+	cfg := adapterconfig.DefaultConfig
+	cfg.Graphite.Write.CarbonAddress = "127.0.0.1:1"
+	cfg.Graphite.Write.Spool = &spoolCfg
+
+	client := NewClient(&cfg, log.NewNopLogger(), nil, nil)
+	if client.spoolStop == nil {
+		t.Fatalf("Expected spool to be enabled")
+	}
+	// A client used as writer and reader is shut down twice on reload.
+	client.Shutdown()
+	client.Shutdown()
+}
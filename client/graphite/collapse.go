@@ -0,0 +1,90 @@
+// Copyright 2024-2025 NetCracker Technology Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package graphite
+
+import (
+	"math"
+
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var collapsedSamples = promauto.NewCounter(
+	prometheus.CounterOpts{
+		Namespace: "remote_adapter_graphite",
+		Name:      "collapsed_samples_total",
+		Help:      "Total number of samples merged with other samples of their series in the same interval.",
+	},
+)
+
+// collapser merges the consecutive samples of a series falling in the same interval.
+type collapser struct {
+	policy config.CollapsePolicy
+	// Width of the intervals in milliseconds.
+	interval int64
+
+	// Interval of the samples being merged and their merged value, the sum of their values for avg.
+	bucket  int64
+	value   float64
+	samples int
+}
+
+// newCollapser returns a collapser of the samples of a series, nil when samples are not merged.
+func newCollapser(cfg config.CollapseConfig) *collapser {
+	if cfg.Policy == "" || cfg.Policy == config.CollapseNone {
+		return nil
+	}
+	return &collapser{policy: cfg.Policy, interval: cfg.Interval.Milliseconds()}
+}
+
+// add merges a sample with the previous ones of its interval. When it starts a new interval,
+// the merged sample of the previous interval is returned with ok set.
+func (c *collapser) add(value float64, timestamp int64) (float64, int64, bool) {
+	// Intervals are rounded like timestamps to the second, so that a second holds a single datapoint.
+	bucket := int64(math.RoundToEven(float64(timestamp) / float64(c.interval)))
+	if c.samples > 0 && bucket == c.bucket {
+		c.samples++
+		switch c.policy {
+		case config.CollapseLast:
+			c.value = value
+		case config.CollapseMin:
+			c.value = math.Min(c.value, value)
+		case config.CollapseMax:
+			c.value = math.Max(c.value, value)
+		case config.CollapseAvg:
+			c.value += value
+		}
+		return 0, 0, false
+	}
+	mergedValue, mergedTimestamp, ok := c.flush()
+	c.bucket, c.value, c.samples = bucket, value, 1
+	return mergedValue, mergedTimestamp, ok
+}
+
+// flush returns the merged sample of the current interval, if any, and resets the collapser.
+func (c *collapser) flush() (float64, int64, bool) {
+	if c.samples == 0 {
+		return 0, 0, false
+	}
+	value := c.value
+	if c.policy == config.CollapseAvg {
+		value /= float64(c.samples)
+	}
+	collapsedSamples.Add(float64(c.samples - 1))
+	c.samples = 0
+	return value, c.bucket * c.interval, true
+}
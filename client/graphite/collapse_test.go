@@ -0,0 +1,117 @@
+// Copyright 2024-2025 NetCracker Technology Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package graphite
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	graphiteconfig "github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/config"
+	"github.com/Netcracker/qubership-graphite-remote-adapter/config"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollapse(t *testing.T) {
+	// Samples of the intervals of 1s, 2s and 3s, followed by a series of a single sample.
+	series := []prompb.TimeSeries{
+		testSeries("metric_a",
+			prompb.Sample{Value: 3, Timestamp: 1000},
+			prompb.Sample{Value: 1, Timestamp: 1250},
+			prompb.Sample{Value: 5, Timestamp: 1400},
+			prompb.Sample{Value: 7, Timestamp: 1600},
+			prompb.Sample{Value: 2, Timestamp: 3000}),
+		testSeries("metric_b", prompb.Sample{Value: 9, Timestamp: 3100}),
+	}
+
+	tests := []struct {
+		policy          graphiteconfig.CollapsePolicy
+		expectOutput    []string
+		expectCollapsed float64
+	}{
+		{
+			policy: graphiteconfig.CollapseNone,
+			expectOutput: []string{
+				"metric_a 3.000000 1000", "metric_a 1.000000 1250", "metric_a 5.000000 1400",
+				"metric_a 7.000000 1600", "metric_a 2.000000 3000", "metric_b 9.000000 3100",
+			},
+		},
+		{
+			policy:          graphiteconfig.CollapseFirst,
+			expectOutput:    []string{"metric_a 3.000000 1000", "metric_a 7.000000 2000", "metric_a 2.000000 3000", "metric_b 9.000000 3000"},
+			expectCollapsed: 2,
+		},
+		{
+			policy:          graphiteconfig.CollapseLast,
+			expectOutput:    []string{"metric_a 5.000000 1000", "metric_a 7.000000 2000", "metric_a 2.000000 3000", "metric_b 9.000000 3000"},
+			expectCollapsed: 2,
+		},
+		{
+			policy:          graphiteconfig.CollapseMin,
+			expectOutput:    []string{"metric_a 1.000000 1000", "metric_a 7.000000 2000", "metric_a 2.000000 3000", "metric_b 9.000000 3000"},
+			expectCollapsed: 2,
+		},
+		{
+			policy:          graphiteconfig.CollapseMax,
+			expectOutput:    []string{"metric_a 5.000000 1000", "metric_a 7.000000 2000", "metric_a 2.000000 3000", "metric_b 9.000000 3000"},
+			expectCollapsed: 2,
+		},
+		{
+			policy:          graphiteconfig.CollapseAvg,
+			expectOutput:    []string{"metric_a 3.000000 1000", "metric_a 7.000000 2000", "metric_a 2.000000 3000", "metric_b 9.000000 3000"},
+			expectCollapsed: 2,
+		},
+	}
+	for _, test := range tests {
+		t.Run(string(test.policy), func(t *testing.T) {
+			cfg := config.DefaultConfig
+			cfg.Graphite.Write.CarbonAddress = "127.0.0.1:1"
+			cfg.Graphite.Write.TimestampPrecision = graphiteconfig.PrecisionMilliseconds
+			cfg.Graphite.Write.Collapse = graphiteconfig.CollapseConfig{Policy: test.policy, Interval: time.Second}
+			client := NewClient(&cfg, log.NewNopLogger(), nil, nil)
+			defer client.Shutdown()
+
+			collapsed := testutil.ToFloat64(collapsedSamples)
+			response, err := writeSeries(client, true, series...)
+			require.NoError(t, err)
+			require.Equal(t, strings.Join(test.expectOutput, "\n")+"\n", string(response))
+			require.Equal(t, test.expectCollapsed, testutil.ToFloat64(collapsedSamples)-collapsed)
+		})
+	}
+}
+
+func TestCollapseBeforeMarker(t *testing.T) {
+	cfg := config.DefaultConfig
+	cfg.Graphite.Write.CarbonAddress = "127.0.0.1:1"
+	cfg.Graphite.Write.TimestampPrecision = graphiteconfig.PrecisionMilliseconds
+	cfg.Graphite.Write.Collapse = graphiteconfig.CollapseConfig{Policy: graphiteconfig.CollapseLast, Interval: time.Second}
+	cfg.Graphite.Write.SpecialValues.Stale = graphiteconfig.SpecialValueConfig{Action: graphiteconfig.ActionMarker, Value: 1}
+	cfg.Graphite.Write.SpecialValues.MarkerSuffix = ".end"
+	client := NewClient(&cfg, log.NewNopLogger(), nil, nil)
+	defer client.Shutdown()
+
+	// The samples merged before a staleness marker are written before it.
+	response, err := writeSeries(client, true, testSeries("metric",
+		prompb.Sample{Value: 1, Timestamp: 1000},
+		prompb.Sample{Value: 2, Timestamp: 1200},
+		prompb.Sample{Value: staleNaN, Timestamp: 1400},
+		prompb.Sample{Value: 4, Timestamp: 2000}))
+	require.NoError(t, err)
+	require.Equal(t, "metric 2.000000 1000\nmetric.end 1.000000 1400\nmetric 4.000000 2000\n", string(response))
+}
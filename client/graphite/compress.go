@@ -0,0 +1,128 @@
+// Copyright 2024-2025 NetCracker Technology Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package graphite
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"sync"
+
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/config"
+	"github.com/Netcracker/qubership-graphite-remote-adapter/utils/lz4"
+	"github.com/go-kit/log"
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// compressors holds the writers of the codecs, which are expensive to allocate for each batch,
+// and the buffers batches are compressed into.
+type compressors struct {
+	lz4     sync.Pool
+	zstd    sync.Pool
+	gzip    sync.Pool
+	snappy  sync.Pool
+	buffers sync.Pool
+}
+
+func newCompressors(cfg *config.WriteConfig, logger log.Logger) *compressors {
+	level := cfg.CompressLevel
+	return &compressors{
+		lz4: sync.Pool{New: func() interface{} {
+			w, err := lz4.NewWriter(nil, logger, cfg.CompressLZ4Preferences)
+			if err != nil {
+				return nil
+			}
+			return w
+		}},
+		zstd: sync.Pool{New: func() interface{} {
+			zstdLevel := zstd.SpeedDefault
+			if level > 0 {
+				zstdLevel = zstd.EncoderLevelFromZstd(level)
+			}
+			// Options are valid, NewWriter cannot fail.
+			w, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstdLevel), zstd.WithEncoderConcurrency(1))
+			return w
+		}},
+		gzip: sync.Pool{New: func() interface{} {
+			gzipLevel := gzip.DefaultCompression
+			if level > 0 {
+				gzipLevel = level
+			}
+			// The level is validated with the configuration.
+			w, _ := gzip.NewWriterLevel(nil, gzipLevel)
+			return w
+		}},
+		snappy: sync.Pool{New: func() interface{} {
+			return snappy.NewBufferedWriter(nil)
+		}},
+		buffers: sync.Pool{New: func() interface{} {
+			return new(bytes.Buffer)
+		}},
+	}
+}
+
+// compress writes payload to w, compressed with the configured compression.
+func (client *Client) compress(w io.Writer, payload []byte) error {
+	switch client.cfg.Write.CompressType {
+	case config.LZ4:
+		lw, ok := client.compressors.lz4.Get().(*lz4.Writer)
+		if !ok {
+			// The pool failed to create a compression context, report why.
+			var err error
+			if lw, err = lz4.NewWriter(w, client.logger, client.cfg.Write.CompressLZ4Preferences); err != nil {
+				return err
+			}
+		}
+		lw.Reset(w)
+		_, err := lw.Write(payload)
+		lw.Reset(nil)
+		client.compressors.lz4.Put(lw)
+		return err
+	case config.Zstd:
+		zw := client.compressors.zstd.Get().(*zstd.Encoder)
+		zw.Reset(w)
+		err := writeAndClose(zw, payload)
+		zw.Reset(nil)
+		client.compressors.zstd.Put(zw)
+		return err
+	case config.Gzip:
+		zw := client.compressors.gzip.Get().(*gzip.Writer)
+		zw.Reset(w)
+		err := writeAndClose(zw, payload)
+		zw.Reset(nil)
+		client.compressors.gzip.Put(zw)
+		return err
+	case config.Snappy:
+		zw := client.compressors.snappy.Get().(*snappy.Writer)
+		zw.Reset(w)
+		err := writeAndClose(zw, payload)
+		zw.Reset(nil)
+		client.compressors.snappy.Put(zw)
+		return err
+	default:
+		_, err := w.Write(payload)
+		return err
+	}
+}
+
+func writeAndClose(w io.WriteCloser, payload []byte) error {
+	if _, err := w.Write(payload); err != nil {
+		_ = w.Close()
+		return err
+	}
+	return w.Close()
+}
@@ -0,0 +1,179 @@
+// Copyright 2024-2025 NetCracker Technology Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package graphite
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	graphiteconfig "github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/config"
+	"github.com/Netcracker/qubership-graphite-remote-adapter/config"
+	"github.com/Netcracker/qubership-graphite-remote-adapter/utils/lz4"
+	"github.com/go-kit/log"
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/require"
+)
+
+// decompress reads a stream compressed with compressType.
+func decompress(t *testing.T, compressType graphiteconfig.CompressType, data []byte) []byte {
+	var r io.Reader
+	switch compressType {
+	case graphiteconfig.LZ4:
+		lr, err := lz4.NewReader(bytes.NewReader(data), log.NewNopLogger(), 1<<16)
+		require.NoError(t, err)
+		defer lr.Close()
+		r = lr
+	case graphiteconfig.Zstd:
+		zr, err := zstd.NewReader(bytes.NewReader(data))
+		require.NoError(t, err)
+		defer zr.Close()
+		r = zr
+	case graphiteconfig.Gzip:
+		// Concatenated gzip members are read as a single stream.
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		require.NoError(t, err)
+		r = zr
+	case graphiteconfig.Snappy:
+		r = snappy.NewReader(bytes.NewReader(data))
+	default:
+		r = bytes.NewReader(data)
+	}
+	out, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return out
+}
+
+func TestCompress(t *testing.T) {
+	payload := bytes.Repeat([]byte("metric.path.node 1.000000 1600000000\n"), 1000)
+	for _, compressType := range []graphiteconfig.CompressType{
+		graphiteconfig.Plain, graphiteconfig.LZ4, graphiteconfig.Zstd, graphiteconfig.Gzip, graphiteconfig.Snappy,
+	} {
+		t.Run(string(compressType), func(t *testing.T) {
+			cfg := config.DefaultConfig
+			cfg.Graphite.Write.CarbonAddress = "127.0.0.1:1"
+			cfg.Graphite.Write.CompressType = compressType
+			client := NewClient(&cfg, log.NewNopLogger(), nil, nil)
+			defer client.Shutdown()
+
+			// Pooled writers are reused by the following batches.
+			for i := 0; i < 3; i++ {
+				var compressed bytes.Buffer
+				require.NoError(t, client.compress(&compressed, payload))
+				if compressType != graphiteconfig.Plain {
+					require.Less(t, compressed.Len(), len(payload))
+				}
+				require.Equal(t, payload, decompress(t, compressType, compressed.Bytes()))
+			}
+		})
+	}
+}
+
+func TestWriteCompressed(t *testing.T) {
+	for _, compressType := range []graphiteconfig.CompressType{graphiteconfig.Zstd, graphiteconfig.Gzip, graphiteconfig.Snappy} {
+		t.Run(string(compressType), func(t *testing.T) {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+			defer l.Close()
+			received := make(chan []byte, 1)
+			go func() {
+				c, err := l.Accept()
+				if err != nil {
+					return
+				}
+				defer c.Close()
+				_ = c.SetReadDeadline(time.Now().Add(time.Second))
+				data, _ := io.ReadAll(c)
+				received <- data
+			}()
+
+			cfg := config.DefaultConfig
+			cfg.Graphite.Write.CarbonAddress = l.Addr().String()
+			cfg.Graphite.Write.CompressType = compressType
+			cfg.Graphite.Write.CompressLevel = 3
+			client := NewClient(&cfg, log.NewNopLogger(), nil, nil)
+			// Each batch is compressed in a stream of its own.
+			for i := 0; i < 2; i++ {
+				_, err = writeSeries(client, false, testSeries("metric", prompb.Sample{Value: 1, Timestamp: 1600000000000}))
+				require.NoError(t, err)
+			}
+			client.Shutdown()
+
+			require.Equal(t, "metric 1.000000 1600000000\nmetric 1.000000 1600000000\n",
+				string(decompress(t, compressType, <-received)))
+		})
+	}
+}
+
+func TestLZ4FramePerConnection(t *testing.T) {
+	const line = "metric 1.000000 1600000000\n"
+	magic := []byte{0x04, 0x22, 0x4d, 0x18}
+	for _, framePerConnection := range []bool{false, true} {
+		t.Run(fmt.Sprintf("frame_per_connection=%v", framePerConnection), func(t *testing.T) {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+			defer l.Close()
+			conns := make(chan net.Conn, 1)
+			go func() {
+				if c, err := l.Accept(); err == nil {
+					conns <- c
+				}
+			}()
+
+			cfg := config.DefaultConfig
+			cfg.Graphite.Write.CarbonAddress = l.Addr().String()
+			cfg.Graphite.Write.CompressType = graphiteconfig.LZ4
+			cfg.Graphite.Write.CompressLZ4Preferences = &graphiteconfig.LZ4Preferences{FramePerConnection: framePerConnection}
+			client := NewClient(&cfg, log.NewNopLogger(), nil, nil)
+			for i := 0; i < 3; i++ {
+				_, err = writeSeries(client, false, testSeries("metric", prompb.Sample{Value: 1, Timestamp: 1600000000000}))
+				require.NoError(t, err)
+			}
+
+			conn := <-conns
+			defer conn.Close()
+			_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+			var raw bytes.Buffer
+			r, err := lz4.NewReader(io.TeeReader(conn, &raw), log.NewNopLogger(), 1<<16)
+			require.NoError(t, err)
+			defer r.Close()
+			// Batches are readable as soon as they are sent, before the frame ends.
+			buf := make([]byte, 3*len(line))
+			_, err = io.ReadFull(r, buf)
+			require.NoError(t, err)
+			require.Equal(t, strings.Repeat(line, 3), string(buf))
+
+			// The frame of the connection is ended when the client shuts down.
+			client.Shutdown()
+			rest, err := io.ReadAll(r)
+			require.NoError(t, err)
+			require.Empty(t, rest)
+
+			frames := 3
+			if framePerConnection {
+				frames = 1
+			}
+			require.Equal(t, frames, bytes.Count(raw.Bytes(), magic))
+		})
+	}
+}
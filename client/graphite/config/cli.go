@@ -37,10 +37,18 @@ func AddCommandLine(app *kingpin.Application, cfg *Config) {
 		"The host:port of the Graphite server to send samples to.").
 		StringVar(&cfg.Write.CarbonAddress)
 
+	app.Flag("graphite.write.carbon-destination",
+		"The host:port[:instance] of a carbon destination to shard or replicate samples to. Can be repeated.").
+		StringsVar(&cfg.Write.CarbonDestinations)
+
 	app.Flag("graphite.write.carbon-transport",
-		"Transport protocol to use to communicate with Graphite.").
+		"Transport protocol to use to communicate with Graphite: tcp, udp, tls, unix or http.").
 		StringVar(&cfg.Write.CarbonTransport)
 
+	app.Flag("graphite.write.carbon-connections",
+		"Number of parallel connections to Graphite.").
+		IntVar(&cfg.Write.CarbonConnections)
+
 	app.Flag("graphite.write.enable-paths-cache",
 		"Enables a cache to graphite paths lists for written metrics.").
 		BoolVar(&cfg.Write.EnablePathsCache)
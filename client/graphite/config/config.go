@@ -20,30 +20,78 @@ import (
 	"fmt"
 	"net/http"
 	"regexp"
+	"slices"
+	"strings"
 	"text/template"
 	"time"
 
 	graphitetmpl "github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/template"
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/metadata"
 	"github.com/Netcracker/qubership-graphite-remote-adapter/utils"
 	utilstmpl "github.com/Netcracker/qubership-graphite-remote-adapter/utils/template"
+	promconfig "github.com/prometheus/common/config"
 	"github.com/prometheus/common/model"
 	"gopkg.in/yaml.v3"
 )
 
 const (
-	LZ4fBlockSizeDefault    LZ4FBlockSize = "default"
-	LZ4fBlockSizeMax64kb    LZ4FBlockSize = "max64KB"
-	LZ4fBlockSizeMax256kb   LZ4FBlockSize = "max256KB"
-	LZ4fBlockSizeMax1mb     LZ4FBlockSize = "max1MB"
-	LZ4fBlockSizeMax4mb     LZ4FBlockSize = "max4MB"
-	LZ4                     CompressType  = "lz4"
-	Plain                   CompressType  = "plain"
-	LZ4CompressLevelDefault               = 9
+	LZ4fBlockSizeDefault    LZ4FBlockSize      = "default"
+	LZ4fBlockSizeMax64kb    LZ4FBlockSize      = "max64KB"
+	LZ4fBlockSizeMax256kb   LZ4FBlockSize      = "max256KB"
+	LZ4fBlockSizeMax1mb     LZ4FBlockSize      = "max1MB"
+	LZ4fBlockSizeMax4mb     LZ4FBlockSize      = "max4MB"
+	LZ4                     CompressType       = "lz4"
+	Plain                   CompressType       = "plain"
+	Zstd                    CompressType       = "zstd"
+	Gzip                    CompressType       = "gzip"
+	Snappy                  CompressType       = "snappy"
+	LZ4CompressLevelDefault                    = 9
+	CarbonCH                HashingType        = "carbon_ch"
+	FNV1aCH                 HashingType        = "fnv1a_ch"
+	RoutingShard            RoutingType        = "shard"
+	RoutingReplicate        RoutingType        = "replicate"
+	ProtocolPlaintext       ProtocolType       = "plaintext"
+	ProtocolPickle          ProtocolType       = "pickle"
+	ProtocolCarbonPB        ProtocolType       = "carbonpb"
+	PrecisionSeconds        TimestampPrecision = "seconds"
+	PrecisionFractional     TimestampPrecision = "fractional"
+	PrecisionMilliseconds   TimestampPrecision = "milliseconds"
+	CollapseNone            CollapsePolicy     = "none"
+	CollapseFirst           CollapsePolicy     = "first"
+	CollapseLast            CollapsePolicy     = "last"
+	CollapseMin             CollapsePolicy     = "min"
+	CollapseMax             CollapsePolicy     = "max"
+	CollapseAvg             CollapsePolicy     = "avg"
+	RelabelReplace          RelabelAction      = "replace"
+	RelabelKeep             RelabelAction      = "keep"
+	RelabelDrop             RelabelAction      = "drop"
+	RelabelHashMod          RelabelAction      = "hashmod"
+	RelabelLabelMap         RelabelAction      = "labelmap"
+	RelabelLabelDrop        RelabelAction      = "labeldrop"
+	RelabelLabelKeep        RelabelAction      = "labelkeep"
+	RelabelLowercase        RelabelAction      = "lowercase"
+	LimitReject             LimitAction        = "reject"
+	LimitOverflow           LimitAction        = "overflow"
 )
 
 type CompressType string
 type LZ4FBlockSize string
 
+// HashingType is the consistent hashing used to shard paths across carbon destinations.
+type HashingType string
+
+// RoutingType defines how datapoints are distributed across carbon destinations.
+type RoutingType string
+
+// TimestampPrecision is the precision of the timestamps of datapoints sent to carbon.
+type TimestampPrecision string
+
+// CollapsePolicy defines how samples of a series in the same interval are merged.
+type CollapsePolicy string
+
+// ProtocolType is the carbon protocol datapoints are encoded with.
+type ProtocolType string
+
 func (ct *CompressType) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	type compressionTypeDef CompressType
 	ctDef := (*compressionTypeDef)(ct)
@@ -52,7 +100,7 @@ func (ct *CompressType) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	}
 	ctVal := CompressType(*ctDef)
 	switch ctVal {
-	case LZ4, Plain:
+	case LZ4, Plain, Zstd, Gzip, Snappy:
 		*ct = ctVal
 	default:
 		*ct = Plain
@@ -77,6 +125,76 @@ func (bs *LZ4FBlockSize) UnmarshalYAML(unmarshal func(interface{}) error) error
 	return nil
 }
 
+func (ht *HashingType) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	switch HashingType(s) {
+	case CarbonCH, FNV1aCH:
+		*ht = HashingType(s)
+	default:
+		return fmt.Errorf("unsupported carbon hashing %q", s)
+	}
+	return nil
+}
+
+func (rt *RoutingType) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	switch RoutingType(s) {
+	case RoutingShard, RoutingReplicate:
+		*rt = RoutingType(s)
+	default:
+		return fmt.Errorf("unsupported carbon routing %q", s)
+	}
+	return nil
+}
+
+func (pt *ProtocolType) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	switch ProtocolType(s) {
+	case ProtocolPlaintext, ProtocolPickle, ProtocolCarbonPB:
+		*pt = ProtocolType(s)
+	default:
+		return fmt.Errorf("unsupported carbon protocol %q", s)
+	}
+	return nil
+}
+
+func (tp *TimestampPrecision) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	switch TimestampPrecision(s) {
+	case PrecisionSeconds, PrecisionFractional, PrecisionMilliseconds:
+		*tp = TimestampPrecision(s)
+	default:
+		return fmt.Errorf("unsupported timestamp precision %q", s)
+	}
+	return nil
+}
+
+func (cp *CollapsePolicy) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	switch CollapsePolicy(s) {
+	case CollapseNone, CollapseFirst, CollapseLast, CollapseMin, CollapseMax, CollapseAvg:
+		*cp = CollapsePolicy(s)
+	default:
+		return fmt.Errorf("unsupported collapse policy %q", s)
+	}
+	return nil
+}
+
 // DefaultConfig is the default graphite configuration.
 var DefaultConfig = Config{
 	DefaultPrefix:        "",
@@ -85,10 +203,40 @@ var DefaultConfig = Config{
 	Write: WriteConfig{
 		CarbonAddress:           "",
 		CarbonTransport:         "tcp",
+		CarbonHashing:           CarbonCH,
+		CarbonRouting:           RoutingShard,
+		CarbonProtocol:          ProtocolPlaintext,
+		TimestampPrecision:      PrecisionSeconds,
 		CarbonReconnectInterval: 1 * time.Hour,
+		CarbonConnections:       1,
+		CarbonWriteDeadline:     30 * time.Second,
+		CarbonKeepAlive:         30 * time.Second,
+		EncodeParallelThreshold: 10000,
+		CarbonRetry: RetryConfig{
+			MaxRetries: 3,
+			MinBackoff: 100 * time.Millisecond,
+			MaxBackoff: 5 * time.Second,
+		},
+		CarbonCircuitBreaker: CircuitBreakerConfig{
+			FailureThreshold: 5,
+			OpenTimeout:      30 * time.Second,
+		},
 		EnablePathsCache:        true,
 		PathsCacheTTL:           7 * time.Minute,
 		PathsCachePurgeInterval: 8 * time.Minute,
+		Collapse: CollapseConfig{
+			Policy:   CollapseNone,
+			Interval: time.Second,
+		},
+		SpecialValues: SpecialValuesConfig{
+			NaN:            SpecialValueConfig{Action: ActionDrop},
+			Inf:            SpecialValueConfig{Action: ActionDrop},
+			NegInf:         SpecialValueConfig{Action: ActionDrop},
+			Stale:          SpecialValueConfig{Action: ActionDrop},
+			MarkerSuffix:   ".end",
+			MarkerTagName:  "marker",
+			MarkerTagValue: "end",
+		},
 	},
 	Read: ReadConfig{
 		URL:           "",
@@ -159,20 +307,484 @@ func (c *ReadConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
 // WriteConfig is the write graphite configuration.
 type WriteConfig struct {
 	CarbonAddress           string                 `yaml:"carbon_address,omitempty" json:"carbon_address,omitempty"`
+	CarbonDestinations      []string               `yaml:"carbon_destinations,omitempty" json:"carbon_destinations,omitempty"`
+	CarbonHashing           HashingType            `yaml:"carbon_hashing,omitempty" json:"carbon_hashing,omitempty"`
+	CarbonRouting           RoutingType            `yaml:"carbon_routing,omitempty" json:"carbon_routing,omitempty"`
 	CarbonTransport         string                 `yaml:"carbon_transport,omitempty" json:"carbon_transport,omitempty"`
+	CarbonTLS               *promconfig.TLSConfig  `yaml:"carbon_tls,omitempty" json:"carbon_tls,omitempty"`
+	CarbonHTTP              *HTTPConfig            `yaml:"carbon_http,omitempty" json:"carbon_http,omitempty"`
+	CarbonProtocol          ProtocolType           `yaml:"carbon_protocol,omitempty" json:"carbon_protocol,omitempty"`
+	TimestampPrecision      TimestampPrecision     `yaml:"timestamp_precision,omitempty" json:"timestamp_precision,omitempty"`
 	CompressType            CompressType           `yaml:"compress_type,omitempty" json:"compress_type,omitempty"`
 	CompressLZ4Preferences  *LZ4Preferences        `yaml:"lz4_preferences,omitempty" json:"lz4_preferences,omitempty"`
+	CompressLevel           int                    `yaml:"compress_level,omitempty" json:"compress_level,omitempty"`
 	CarbonReconnectInterval time.Duration          `yaml:"carbon_reconnect_interval,omitempty" json:"carbon_reconnect_interval,omitempty"`
+	CarbonConnections       int                    `yaml:"carbon_connections,omitempty" json:"carbon_connections,omitempty"`
+	CarbonWriteDeadline     time.Duration          `yaml:"carbon_write_deadline,omitempty" json:"carbon_write_deadline,omitempty"`
+	CarbonKeepAlive         time.Duration          `yaml:"carbon_keepalive,omitempty" json:"carbon_keepalive,omitempty"`
+	ChunkSize               int                    `yaml:"chunk_size,omitempty" json:"chunk_size,omitempty"`
+	EncodeWorkers           int                    `yaml:"encode_workers,omitempty" json:"encode_workers,omitempty"`
+	EncodeParallelThreshold int                    `yaml:"encode_parallel_threshold,omitempty" json:"encode_parallel_threshold,omitempty"`
+	CarbonRetry             RetryConfig            `yaml:"carbon_retry,omitempty" json:"carbon_retry,omitempty"`
+	CarbonCircuitBreaker    CircuitBreakerConfig   `yaml:"carbon_circuit_breaker,omitempty" json:"carbon_circuit_breaker,omitempty"`
 	EnablePathsCache        bool                   `yaml:"enable_paths_cache,omitempty" json:"enable_paths_cache,omitempty"`
 	PathsCacheTTL           time.Duration          `yaml:"paths_cache_ttl,omitempty" json:"paths_cache_ttl,omitempty"`
 	PathsCachePurgeInterval time.Duration          `yaml:"paths_cache_purge_interval,omitempty" json:"paths_cache_purge_interval,omitempty"`
 	TemplateData            map[string]interface{} `yaml:"template_data,omitempty" json:"template_data,omitempty"`
+	WriteRelabelConfigs     []*RelabelConfig       `yaml:"write_relabel_configs,omitempty" json:"write_relabel_configs,omitempty"`
 	Rules                   []*Rule                `yaml:"rules,omitempty" json:"rules,omitempty"`
+	Spool                   *SpoolConfig           `yaml:"spool,omitempty" json:"spool,omitempty"`
+	Async                   *AsyncConfig           `yaml:"async,omitempty" json:"async,omitempty"`
+	Histograms              *HistogramsConfig      `yaml:"histograms,omitempty" json:"histograms,omitempty"`
+	SpecialValues           SpecialValuesConfig    `yaml:"special_values,omitempty" json:"special_values,omitempty"`
+	Collapse                CollapseConfig         `yaml:"collapse,omitempty" json:"collapse,omitempty"`
+	Limits                  *LimitsConfig          `yaml:"limits,omitempty" json:"limits,omitempty"`
+	PathLimits              *PathLimitsConfig      `yaml:"path_limits,omitempty" json:"path_limits,omitempty"`
+
+	// Catches all undefined fields and must be empty after parsing.
+	XXX map[string]interface{} `yaml:",inline" json:"-"`
+}
+
+// DefaultSpoolConfig is the default configuration of the on-disk spool.
+var DefaultSpoolConfig = SpoolConfig{
+	MaxSize:        1 << 30,
+	MaxAge:         24 * time.Hour,
+	SegmentSize:    64 << 20,
+	ReplayInterval: 5 * time.Second,
+}
+
+// SpoolConfig configures the on-disk queue holding batches while carbon is unreachable.
+type SpoolConfig struct {
+	// Directory where spool segments are stored. Spooling is disabled when empty.
+	Directory string `yaml:"directory,omitempty" json:"directory,omitempty"`
+	// Maximum size of the spool in bytes. The oldest batches are dropped above it.
+	MaxSize int64 `yaml:"max_size,omitempty" json:"max_size,omitempty"`
+	// Maximum age of a spooled batch. Older batches are dropped instead of replayed.
+	MaxAge time.Duration `yaml:"max_age,omitempty" json:"max_age,omitempty"`
+	// Size in bytes after which a new segment file is started.
+	SegmentSize int64 `yaml:"segment_size,omitempty" json:"segment_size,omitempty"`
+	// Interval between attempts to replay spooled batches to carbon.
+	ReplayInterval time.Duration `yaml:"replay_interval,omitempty" json:"replay_interval,omitempty"`
+
+	// Catches all undefined fields and must be empty after parsing.
+	XXX map[string]interface{} `yaml:",inline" json:"-"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *SpoolConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultSpoolConfig
+	type plain SpoolConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	if c.MaxSize < 0 || c.SegmentSize < 0 {
+		return fmt.Errorf("spool max_size and segment_size must not be negative")
+	}
+	// The oldest segment is dropped to make room, the spool holds more than one.
+	if c.MaxSize > 0 && c.SegmentSize > 0 && c.MaxSize <= c.SegmentSize {
+		return fmt.Errorf("spool max_size %d must be greater than segment_size %d", c.MaxSize, c.SegmentSize)
+	}
+
+	return utils.CheckOverflow(c.XXX, "spoolConfig")
+}
+
+// DefaultAsyncConfig is the default configuration of the asynchronous write mode.
+var DefaultAsyncConfig = AsyncConfig{
+	QueueSize:     1000,
+	Workers:       2,
+	BatchSize:     1 << 20,
+	FlushInterval: 1 * time.Second,
+}
+
+// AsyncConfig configures the asynchronous write mode, where write requests are acknowledged
+// once queued and their samples are sent to carbon in batches by background workers.
+type AsyncConfig struct {
+	// Maximum number of write requests waiting in the queue. Requests are rejected when it is full.
+	QueueSize int `yaml:"queue_size,omitempty" json:"queue_size,omitempty"`
+	// Number of workers batching and sending queued samples.
+	Workers int `yaml:"workers,omitempty" json:"workers,omitempty"`
+	// Size in bytes of encoded datapoints after which a batch is sent.
+	BatchSize int `yaml:"batch_size,omitempty" json:"batch_size,omitempty"`
+	// Interval after which a batch is sent whatever its size.
+	FlushInterval time.Duration `yaml:"flush_interval,omitempty" json:"flush_interval,omitempty"`
+
+	// Catches all undefined fields and must be empty after parsing.
+	XXX map[string]interface{} `yaml:",inline" json:"-"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *AsyncConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultAsyncConfig
+	type plain AsyncConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	if c.QueueSize <= 0 || c.Workers <= 0 || c.BatchSize <= 0 || c.FlushInterval <= 0 {
+		return fmt.Errorf("async queue_size, workers, batch_size and flush_interval must be positive")
+	}
+
+	return utils.CheckOverflow(c.XXX, "asyncConfig")
+}
+
+// LimitAction is what is done with the samples of new series over a cardinality budget.
+type LimitAction string
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (a *LimitAction) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	switch LimitAction(s) {
+	case LimitReject, LimitOverflow:
+		*a = LimitAction(s)
+	default:
+		return fmt.Errorf("unsupported limit action %q", s)
+	}
+	return nil
+}
+
+// DefaultLimitsConfig is the default configuration of the series cardinality limiter.
+var DefaultLimitsConfig = LimitsConfig{
+	PrefixNodes:  1,
+	Window:       1 * time.Hour,
+	Action:       LimitReject,
+	OverflowPath: "overflow",
+}
+
+// LimitsConfig configures the series cardinality limiter, which is disabled when it is not set.
+// A series is active while it receives samples within the window. New series are admitted while
+// the budgets are not exhausted, active series are always admitted.
+type LimitsConfig struct {
+	// Maximum number of active series, 0 for no limit.
+	MaxSeries int `yaml:"max_series,omitempty" json:"max_series,omitempty"`
+	// Maximum number of active series of a metric name, 0 for no limit.
+	MaxSeriesPerMetric int `yaml:"max_series_per_metric,omitempty" json:"max_series_per_metric,omitempty"`
+	// Maximum number of active series whose path starts with the same prefix, 0 for no limit.
+	MaxSeriesPerPrefix int `yaml:"max_series_per_prefix,omitempty" json:"max_series_per_prefix,omitempty"`
+	// Number of nodes of the paths, after the storage prefix, making their prefix.
+	PrefixNodes int `yaml:"prefix_nodes,omitempty" json:"prefix_nodes,omitempty"`
+	// Duration after which a series without samples is no longer active.
+	Window time.Duration `yaml:"window,omitempty" json:"window,omitempty"`
+	Action LimitAction   `yaml:"action,omitempty" json:"action,omitempty"`
+	// Path, after the storage prefix, the samples of series over budget are written to with the overflow action.
+	OverflowPath string `yaml:"overflow_path,omitempty" json:"overflow_path,omitempty"`
+
+	// Catches all undefined fields and must be empty after parsing.
+	XXX map[string]interface{} `yaml:",inline" json:"-"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *LimitsConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultLimitsConfig
+	type plain LimitsConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	if c.MaxSeries < 0 || c.MaxSeriesPerMetric < 0 || c.MaxSeriesPerPrefix < 0 {
+		return fmt.Errorf("limits max_series, max_series_per_metric and max_series_per_prefix must not be negative")
+	}
+	if c.PrefixNodes <= 0 || c.Window <= 0 {
+		return fmt.Errorf("limits prefix_nodes and window must be positive")
+	}
+	if c.Action == LimitOverflow && c.OverflowPath == "" {
+		return fmt.Errorf("limits overflow_path must be set with the overflow action")
+	}
+
+	return utils.CheckOverflow(c.XXX, "limitsConfig")
+}
+
+// MinNodeLength is the minimum of the maximum length of nodes, which keeps room for the hash of shortened nodes.
+const MinNodeLength = 24
+
+// DefaultPathLimitsConfig is the default configuration of the length limits of paths.
+var DefaultPathLimitsConfig = PathLimitsConfig{
+	MaxNodeLength: 255,
+}
+
+// PathLimitsConfig configures the maximum length of paths and of their nodes, which are not limited when
+// it is not set. Nodes over the limit are truncated and suffixed with a hash of their original value.
+type PathLimitsConfig struct {
+	// Maximum length in bytes of a path, 0 for no limit.
+	MaxPathLength int `yaml:"max_path_length,omitempty" json:"max_path_length,omitempty"`
+	// Maximum length in bytes of a node of a path, or of a tag value, 0 for no limit.
+	MaxNodeLength int `yaml:"max_node_length,omitempty" json:"max_node_length,omitempty"`
+	// File the original values of shortened nodes are appended to, none when empty.
+	IndexFile string `yaml:"index_file,omitempty" json:"index_file,omitempty"`
+
+	// Catches all undefined fields and must be empty after parsing.
+	XXX map[string]interface{} `yaml:",inline" json:"-"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *PathLimitsConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultPathLimitsConfig
+	type plain PathLimitsConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	if c.MaxPathLength < 0 {
+		return fmt.Errorf("path_limits max_path_length must not be negative, got %d", c.MaxPathLength)
+	}
+	if c.MaxNodeLength != 0 && c.MaxNodeLength < MinNodeLength {
+		return fmt.Errorf("path_limits max_node_length must be 0 or at least %d, got %d", MinNodeLength, c.MaxNodeLength)
+	}
+
+	return utils.CheckOverflow(c.XXX, "pathLimitsConfig")
+}
+
+// DefaultHistogramsConfig is the default configuration of the series derived from native histograms.
+var DefaultHistogramsConfig = HistogramsConfig{
+	TagName: "stat",
+	Count:   HistogramSeriesConfig{Suffix: ".count", Tag: "count"},
+	Sum:     HistogramSeriesConfig{Suffix: ".sum", Tag: "sum"},
+	Quantiles: []HistogramQuantileConfig{
+		{Quantile: 0.5, Suffix: ".p50", Tag: "p50"},
+		{Quantile: 0.9, Suffix: ".p90", Tag: "p90"},
+		{Quantile: 0.99, Suffix: ".p99", Tag: "p99"},
+	},
+}
+
+// HistogramsConfig configures the series derived from native histograms, which are dropped when it is not set.
+// A derived series is written when it has a suffix in the plain mode, or a tag in the tagged modes.
+type HistogramsConfig struct {
+	// Name of the tag telling derived series apart in the tagged modes.
+	TagName string `yaml:"tag_name,omitempty" json:"tag_name,omitempty"`
+	// Number of observations.
+	Count HistogramSeriesConfig `yaml:"count,omitempty" json:"count,omitempty"`
+	// Sum of observations.
+	Sum HistogramSeriesConfig `yaml:"sum,omitempty" json:"sum,omitempty"`
+	// Estimated quantiles of observations.
+	Quantiles []HistogramQuantileConfig `yaml:"quantiles,omitempty" json:"quantiles,omitempty"`
+	// Cumulative count of each bucket, told apart by their upper boundary.
+	Buckets HistogramSeriesConfig `yaml:"buckets,omitempty" json:"buckets,omitempty"`
+
+	// Catches all undefined fields and must be empty after parsing.
+	XXX map[string]interface{} `yaml:",inline" json:"-"`
+}
+
+// HistogramSeriesConfig names a series derived from native histograms.
+type HistogramSeriesConfig struct {
+	// Suffix appended to the paths of the histogram in the plain mode.
+	Suffix string `yaml:"suffix,omitempty" json:"suffix,omitempty"`
+	// Value of the tag added to the histogram in the tagged modes.
+	Tag string `yaml:"tag,omitempty" json:"tag,omitempty"`
 
 	// Catches all undefined fields and must be empty after parsing.
 	XXX map[string]interface{} `yaml:",inline" json:"-"`
 }
 
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *HistogramSeriesConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain HistogramSeriesConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+
+	return utils.CheckOverflow(c.XXX, "histogramSeriesConfig")
+}
+
+// HistogramQuantileConfig names a quantile derived from native histograms.
+type HistogramQuantileConfig struct {
+	Quantile float64 `yaml:"quantile" json:"quantile"`
+	Suffix   string  `yaml:"suffix,omitempty" json:"suffix,omitempty"`
+	Tag      string  `yaml:"tag,omitempty" json:"tag,omitempty"`
+
+	// Catches all undefined fields and must be empty after parsing.
+	XXX map[string]interface{} `yaml:",inline" json:"-"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *HistogramQuantileConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain HistogramQuantileConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	if c.Quantile < 0 || c.Quantile > 1 {
+		return fmt.Errorf("histogram quantile must be between 0 and 1, got %g", c.Quantile)
+	}
+
+	return utils.CheckOverflow(c.XXX, "histogramQuantileConfig")
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *HistogramsConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultHistogramsConfig
+	type plain HistogramsConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	if c.TagName == "" {
+		return fmt.Errorf("histograms tag_name must not be empty")
+	}
+
+	return utils.CheckOverflow(c.XXX, "histogramsConfig")
+}
+
+// HTTPConfig configures the http transport, posting batches to a carbon HTTP receiver.
+type HTTPConfig struct {
+	// Headers added to each request.
+	Headers map[string]string `yaml:"headers,omitempty" json:"headers,omitempty"`
+	// Status codes of a successful write. Any 2xx status is a success when empty.
+	SuccessStatusCodes []int `yaml:"success_status_codes,omitempty" json:"success_status_codes,omitempty"`
+
+	// Catches all undefined fields and must be empty after parsing.
+	XXX map[string]interface{} `yaml:",inline" json:"-"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *HTTPConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain HTTPConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+
+	return utils.CheckOverflow(c.XXX, "httpConfig")
+}
+
+// RetryConfig configures the retries of failed writes to a carbon destination.
+type RetryConfig struct {
+	// Maximum number of retries of a batch. Retries are disabled when 0.
+	MaxRetries int `yaml:"max_retries,omitempty" json:"max_retries,omitempty"`
+	// Backoff before the first retry, doubled on each retry up to MaxBackoff, with equal jitter:
+	// a random half of the backoff is jittered away.
+	MinBackoff time.Duration `yaml:"min_backoff,omitempty" json:"min_backoff,omitempty"`
+	MaxBackoff time.Duration `yaml:"max_backoff,omitempty" json:"max_backoff,omitempty"`
+
+	// Catches all undefined fields and must be empty after parsing.
+	XXX map[string]interface{} `yaml:",inline" json:"-"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *RetryConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain RetryConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+
+	return utils.CheckOverflow(c.XXX, "retryConfig")
+}
+
+// CollapseConfig configures the merging of the samples of a series falling in the same interval.
+type CollapseConfig struct {
+	Policy CollapsePolicy `yaml:"policy,omitempty" json:"policy,omitempty"`
+	// Width of the intervals. Samples are merged with those whose timestamp rounds to the same multiple
+	// of the interval, like timestamps are rounded to the second, and written at that multiple.
+	Interval time.Duration `yaml:"interval,omitempty" json:"interval,omitempty"`
+
+	// Catches all undefined fields and must be empty after parsing.
+	XXX map[string]interface{} `yaml:",inline" json:"-"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *CollapseConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain CollapseConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	if c.Interval < time.Millisecond {
+		return fmt.Errorf("collapse interval must be at least 1ms, got %s", c.Interval)
+	}
+
+	return utils.CheckOverflow(c.XXX, "collapseConfig")
+}
+
+// SpecialValueAction is what is written for a sample of a special value.
+type SpecialValueAction string
+
+const (
+	// ActionDrop drops the sample, also when the action is not set.
+	ActionDrop SpecialValueAction = "drop"
+	// ActionSubstitute writes a sentinel value instead of the sample.
+	ActionSubstitute SpecialValueAction = "substitute"
+	// ActionMarker writes a sentinel value to the end marker series of the series instead of the sample.
+	ActionMarker SpecialValueAction = "marker"
+)
+
+// SpecialValuesConfig configures what is written for samples whose value is not a number,
+// Prometheus staleness markers being told apart from other NaNs.
+type SpecialValuesConfig struct {
+	NaN    SpecialValueConfig `yaml:"nan,omitempty" json:"nan,omitempty"`
+	Inf    SpecialValueConfig `yaml:"inf,omitempty" json:"inf,omitempty"`
+	NegInf SpecialValueConfig `yaml:"neg_inf,omitempty" json:"neg_inf,omitempty"`
+	Stale  SpecialValueConfig `yaml:"stale,omitempty" json:"stale,omitempty"`
+	// Suffix appended to the paths of a series for its end marker series in the plain mode.
+	MarkerSuffix string `yaml:"marker_suffix,omitempty" json:"marker_suffix,omitempty"`
+	// Name and value of the tag added to a series for its end marker series in the tagged modes.
+	MarkerTagName  string `yaml:"marker_tag_name,omitempty" json:"marker_tag_name,omitempty"`
+	MarkerTagValue string `yaml:"marker_tag_value,omitempty" json:"marker_tag_value,omitempty"`
+
+	// Catches all undefined fields and must be empty after parsing.
+	XXX map[string]interface{} `yaml:",inline" json:"-"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *SpecialValuesConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain SpecialValuesConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+
+	return utils.CheckOverflow(c.XXX, "specialValuesConfig")
+}
+
+// SpecialValueConfig configures what is written for samples of a special value.
+type SpecialValueConfig struct {
+	Action SpecialValueAction `yaml:"action,omitempty" json:"action,omitempty"`
+	// Sentinel value written by the substitute and marker actions.
+	Value float64 `yaml:"value,omitempty" json:"value,omitempty"`
+
+	// Catches all undefined fields and must be empty after parsing.
+	XXX map[string]interface{} `yaml:",inline" json:"-"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *SpecialValueConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain SpecialValueConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	switch c.Action {
+	case "", ActionDrop, ActionSubstitute, ActionMarker:
+	default:
+		return fmt.Errorf("unsupported special value action %q, expected drop, substitute or marker", c.Action)
+	}
+
+	return utils.CheckOverflow(c.XXX, "specialValueConfig")
+}
+
+// CircuitBreakerConfig configures the circuit breaker of a carbon destination.
+type CircuitBreakerConfig struct {
+	// Number of consecutive failed writes after which writes fail fast. The breaker is disabled when 0.
+	FailureThreshold int `yaml:"failure_threshold,omitempty" json:"failure_threshold,omitempty"`
+	// Time writes fail fast before a single write probes whether carbon recovered.
+	OpenTimeout time.Duration `yaml:"open_timeout,omitempty" json:"open_timeout,omitempty"`
+
+	// Catches all undefined fields and must be empty after parsing.
+	XXX map[string]interface{} `yaml:",inline" json:"-"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *CircuitBreakerConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain CircuitBreakerConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+
+	return utils.CheckOverflow(c.XXX, "circuitBreakerConfig")
+}
+
+// Destinations returns the carbon destinations to write to, as host:port[:instance].
+func (c *WriteConfig) Destinations() []string {
+	if len(c.CarbonDestinations) > 0 {
+		return c.CarbonDestinations
+	}
+	if c.CarbonAddress != "" {
+		return []string{c.CarbonAddress}
+	}
+	return nil
+}
+
 // LZ4FrameInfo makes it possible to set or read frame parameters.
 type LZ4FrameInfo struct {
 	// The larger the block size, the (slightly) better the compression ratio.
@@ -196,6 +808,8 @@ type LZ4Preferences struct {
 	AutoFlush bool `yaml:"auto_flush,omitempty" json:"auto_flush,omitempty"`
 	// parser favors decompression speed vs compression ratio. Works for high compression modes (compression_level >= 10) only.
 	DecompressionSpeed bool `yaml:"decompression_speed,omitempty" json:"decompression_speed,omitempty"`
+	// keep a single frame open for the lifetime of a carbon connection and flush blocks for each batch. Default - false
+	FramePerConnection bool `yaml:"frame_per_connection,omitempty" json:"frame_per_connection,omitempty"`
 }
 
 // UnmarshalYAML implements the yaml.Unmarshaler interface.
@@ -204,6 +818,37 @@ func (c *WriteConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	if err := unmarshal((*plain)(c)); err != nil {
 		return err
 	}
+	if c.CarbonTransport == "udp" && c.CarbonProtocol != "" && c.CarbonProtocol != ProtocolPlaintext {
+		return fmt.Errorf("carbon protocol %q is not supported over udp", c.CarbonProtocol)
+	}
+	if c.CarbonProtocol == ProtocolCarbonPB && c.TimestampPrecision != "" && c.TimestampPrecision != PrecisionSeconds {
+		return fmt.Errorf("timestamp precision %q is not supported by the carbonpb protocol", c.TimestampPrecision)
+	}
+	if c.CompressLZ4Preferences != nil && c.CompressLZ4Preferences.FramePerConnection &&
+		(c.CarbonTransport == "udp" || c.CarbonTransport == "http") {
+		return fmt.Errorf("lz4 frame_per_connection is not supported over %s", c.CarbonTransport)
+	}
+	if c.ChunkSize < 0 {
+		return fmt.Errorf("chunk_size must not be negative, got %d", c.ChunkSize)
+	}
+	// The adapter does not start with TLS settings it cannot load, rather than connect without them.
+	if c.CarbonTLS != nil {
+		if _, err := promconfig.NewTLSConfig(c.CarbonTLS); err != nil {
+			return fmt.Errorf("invalid carbon_tls: %w", err)
+		}
+	}
+	if c.EncodeWorkers < 0 {
+		return fmt.Errorf("encode_workers must not be negative, got %d", c.EncodeWorkers)
+	}
+	if c.EncodeParallelThreshold < 0 {
+		return fmt.Errorf("encode_parallel_threshold must not be negative, got %d", c.EncodeParallelThreshold)
+	}
+	switch {
+	case c.CompressType == Gzip && (c.CompressLevel < 0 || c.CompressLevel > 9):
+		return fmt.Errorf("gzip compress_level must be 0 for the default level, or between 1 and 9, got %d", c.CompressLevel)
+	case c.CompressType == Zstd && (c.CompressLevel < 0 || c.CompressLevel > 22):
+		return fmt.Errorf("zstd compress_level must be 0 for the default level, or between 1 and 22, got %d", c.CompressLevel)
+	}
 
 	return utils.CheckOverflow(c.XXX, "writeConfig")
 }
@@ -217,10 +862,13 @@ type LabelSetRE map[model.LabelName]Regexp
 // Rule defines a templating rule that customize graphite path using the
 // Tmpl if a metric matching the labels exists.
 type Rule struct {
-	Tmpl     Template   `yaml:"template,omitempty" json:"template,omitempty"`
-	Match    LabelSet   `yaml:"match,omitempty" json:"match,omitempty"`
-	MatchRE  LabelSetRE `yaml:"match_re,omitempty" json:"match_re,omitempty"`
-	Continue bool       `yaml:"continue,omitempty" json:"continue,omitempty"`
+	Tmpl    Template   `yaml:"template,omitempty" json:"template,omitempty"`
+	Match   LabelSet   `yaml:"match,omitempty" json:"match,omitempty"`
+	MatchRE LabelSetRE `yaml:"match_re,omitempty" json:"match_re,omitempty"`
+	// Types of the metric families matched, from the metadata of remote write requests.
+	// Metrics without metadata are of the unknown type.
+	MatchType []string `yaml:"match_type,omitempty" json:"match_type,omitempty"`
+	Continue  bool     `yaml:"continue,omitempty" json:"continue,omitempty"`
 
 	// Catches all undefined fields and must be empty after parsing.
 	XXX map[string]interface{} `yaml:",inline" json:"-"`
@@ -232,10 +880,94 @@ func (r *Rule) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	if err := unmarshal((*plain)(r)); err != nil {
 		return err
 	}
+	for _, typ := range r.MatchType {
+		if !slices.Contains(metadata.Types, typ) {
+			return fmt.Errorf("unknown metric type %q in match_type, expected one of %s", typ, strings.Join(metadata.Types, ", "))
+		}
+	}
 
 	return utils.CheckOverflow(r.XXX, "rule")
 }
 
+// RelabelAction is the action of a relabel config.
+type RelabelAction string
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (a *RelabelAction) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	switch act := RelabelAction(strings.ToLower(s)); act {
+	case RelabelReplace, RelabelKeep, RelabelDrop, RelabelHashMod, RelabelLabelMap, RelabelLabelDrop, RelabelLabelKeep, RelabelLowercase:
+		*a = act
+	default:
+		return fmt.Errorf("unknown relabel action %q", s)
+	}
+	return nil
+}
+
+// relabelTarget matches the target labels of replace actions, which may reference regex groups.
+var relabelTarget = regexp.MustCompile(`^(?:(?:[a-zA-Z_]|\$(?:\{\w+\}|\w+))+\w*)+$`)
+
+// DefaultRelabelConfig is the default relabel config, as in Prometheus.
+var DefaultRelabelConfig = RelabelConfig{
+	Action:      RelabelReplace,
+	Separator:   ";",
+	Regex:       Regexp{regexp.MustCompile("^(?:(.*))$")},
+	Replacement: "$1",
+}
+
+// RelabelConfig rewrites, drops or keeps the labels of series before their paths are built,
+// with the semantics of Prometheus relabel configs.
+type RelabelConfig struct {
+	// Labels whose values are concatenated with Separator and matched by Regex.
+	SourceLabels model.LabelNames `yaml:"source_labels,flow,omitempty" json:"source_labels,omitempty"`
+	Separator    string           `yaml:"separator,omitempty" json:"separator,omitempty"`
+	Regex        Regexp           `yaml:"regex,omitempty" json:"regex,omitempty"`
+	// Modulus of the hash of the source labels values for the hashmod action.
+	Modulus     uint64        `yaml:"modulus,omitempty" json:"modulus,omitempty"`
+	TargetLabel string        `yaml:"target_label,omitempty" json:"target_label,omitempty"`
+	Replacement string        `yaml:"replacement,omitempty" json:"replacement,omitempty"`
+	Action      RelabelAction `yaml:"action,omitempty" json:"action,omitempty"`
+
+	// Catches all undefined fields and must be empty after parsing.
+	XXX map[string]interface{} `yaml:",inline" json:"-"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *RelabelConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultRelabelConfig
+	type plain RelabelConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	switch c.Action {
+	case RelabelHashMod:
+		if c.Modulus == 0 {
+			return fmt.Errorf("relabel config for hashmod action requires non-zero modulus")
+		}
+		if !model.LabelName(c.TargetLabel).IsValid() {
+			return fmt.Errorf("%q is invalid target_label for hashmod action", c.TargetLabel)
+		}
+	case RelabelReplace:
+		if !relabelTarget.MatchString(c.TargetLabel) {
+			return fmt.Errorf("%q is invalid target_label for replace action", c.TargetLabel)
+		}
+	case RelabelLowercase:
+		if !model.LabelName(c.TargetLabel).IsValid() {
+			return fmt.Errorf("%q is invalid target_label for lowercase action", c.TargetLabel)
+		}
+	case RelabelLabelDrop, RelabelLabelKeep:
+		if c.SourceLabels != nil || c.TargetLabel != DefaultRelabelConfig.TargetLabel || c.Modulus != 0 ||
+			c.Separator != DefaultRelabelConfig.Separator || c.Replacement != DefaultRelabelConfig.Replacement {
+			return fmt.Errorf("%s action requires only 'regex', and no other fields", c.Action)
+		}
+	}
+
+	return utils.CheckOverflow(c.XXX, "relabelConfig")
+}
+
 // Template is a parsable template.
 type Template struct {
 	*template.Template
@@ -16,7 +16,11 @@
 package config
 
 import (
+	"encoding/pem"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"reflect"
 	"regexp"
 	"testing"
 	"text/template"
@@ -39,8 +43,27 @@ var (
 		Write: WriteConfig{
 			CarbonAddress:           "greatCarbonAddress",
 			CarbonTransport:         "tcp",
+			CarbonHashing:           CarbonCH,
+			CarbonRouting:           RoutingShard,
+			CarbonProtocol:          ProtocolPlaintext,
 			EnablePathsCache:        true,
 			CarbonReconnectInterval: 2 * time.Minute,
+			CarbonConnections:       1,
+			CarbonWriteDeadline:     30 * time.Second,
+			CarbonKeepAlive:         30 * time.Second,
+			EncodeParallelThreshold: 10000,
+			SpecialValues:           DefaultConfig.Write.SpecialValues,
+			TimestampPrecision:      PrecisionSeconds,
+			Collapse:                DefaultConfig.Write.Collapse,
+			CarbonRetry: RetryConfig{
+				MaxRetries: 3,
+				MinBackoff: 100 * time.Millisecond,
+				MaxBackoff: 5 * time.Second,
+			},
+			CarbonCircuitBreaker: CircuitBreakerConfig{
+				FailureThreshold: 5,
+				OpenTimeout:      30 * time.Second,
+			},
 			PathsCacheTTL:           18 * time.Minute,
 			PathsCachePurgeInterval: 42 * time.Minute,
 			TemplateData: map[string]interface{}{
@@ -86,9 +109,28 @@ var (
 		Write: WriteConfig{
 			CarbonAddress:           "greatCarbonAddress",
 			CarbonTransport:         "tcp",
+			CarbonHashing:           CarbonCH,
+			CarbonRouting:           RoutingShard,
+			CarbonProtocol:          ProtocolPlaintext,
 			CompressType:            Plain,
 			EnablePathsCache:        true,
 			CarbonReconnectInterval: 2 * time.Minute,
+			CarbonConnections:       1,
+			CarbonWriteDeadline:     30 * time.Second,
+			CarbonKeepAlive:         30 * time.Second,
+			EncodeParallelThreshold: 10000,
+			SpecialValues:           DefaultConfig.Write.SpecialValues,
+			TimestampPrecision:      PrecisionSeconds,
+			Collapse:                DefaultConfig.Write.Collapse,
+			CarbonRetry: RetryConfig{
+				MaxRetries: 3,
+				MinBackoff: 100 * time.Millisecond,
+				MaxBackoff: 5 * time.Second,
+			},
+			CarbonCircuitBreaker: CircuitBreakerConfig{
+				FailureThreshold: 5,
+				OpenTimeout:      30 * time.Second,
+			},
 			PathsCacheTTL:           18 * time.Minute,
 			PathsCachePurgeInterval: 42 * time.Minute,
 			TemplateData: map[string]interface{}{
@@ -134,6 +176,9 @@ var (
 		Write: WriteConfig{
 			CarbonAddress:   "greatCarbonAddress",
 			CarbonTransport: "tcp",
+			CarbonHashing:   CarbonCH,
+			CarbonRouting:   RoutingShard,
+			CarbonProtocol:  ProtocolPlaintext,
 			CompressType:    LZ4,
 			CompressLZ4Preferences: &LZ4Preferences{
 				FrameInfo: &LZ4FrameInfo{
@@ -148,6 +193,22 @@ var (
 			},
 			EnablePathsCache:        true,
 			CarbonReconnectInterval: 2 * time.Minute,
+			CarbonConnections:       1,
+			CarbonWriteDeadline:     30 * time.Second,
+			CarbonKeepAlive:         30 * time.Second,
+			EncodeParallelThreshold: 10000,
+			SpecialValues:           DefaultConfig.Write.SpecialValues,
+			TimestampPrecision:      PrecisionSeconds,
+			Collapse:                DefaultConfig.Write.Collapse,
+			CarbonRetry: RetryConfig{
+				MaxRetries: 3,
+				MinBackoff: 100 * time.Millisecond,
+				MaxBackoff: 5 * time.Second,
+			},
+			CarbonCircuitBreaker: CircuitBreakerConfig{
+				FailureThreshold: 5,
+				OpenTimeout:      30 * time.Second,
+			},
 			PathsCacheTTL:           18 * time.Minute,
 			PathsCachePurgeInterval: 42 * time.Minute,
 			TemplateData: map[string]interface{}{
@@ -237,3 +298,329 @@ func TestUnmarshalLZ4Config(t *testing.T) {
 			"testdata/graphite.good.lz4.yml", cfg.String(), expectedConf.String())
 	}
 }
+
+func TestUnmarshalSpoolConfig(t *testing.T) {
+	cfg := &Config{}
+	err := yaml.Unmarshal([]byte("write:\n  spool:\n    directory: /var/spool/adapter\n    max_age: 1h\n"), cfg)
+	if err != nil {
+		t.Fatalf("Error parsing spool config: %s", err)
+	}
+
+	expected := DefaultSpoolConfig
+	expected.Directory = "/var/spool/adapter"
+	expected.MaxAge = time.Hour
+	if cfg.Write.Spool == nil {
+		t.Fatalf("spool config was not parsed")
+	}
+	actual := *cfg.Write.Spool
+	actual.XXX = nil
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("unexpected spool config: %+v, expecting: %+v", actual, expected)
+	}
+}
+
+func TestUnmarshalInvalidSpoolConfig(t *testing.T) {
+	for _, spool := range []string{
+		"max_size: -1",
+		"segment_size: -1",
+		"max_size: 1024\n    segment_size: 1024",
+		// The default segment size.
+		"max_size: 1048576",
+	} {
+		cfg := &Config{}
+		err := yaml.Unmarshal([]byte("write:\n  spool:\n    directory: /var/spool/adapter\n    "+spool+"\n"), cfg)
+		if err == nil {
+			t.Errorf("expected an error parsing spool config %q", spool)
+		}
+	}
+}
+
+func TestUnmarshalRetryConfig(t *testing.T) {
+	cfg := &Config{}
+	err := yaml.Unmarshal([]byte("write:\n  carbon_retry:\n    max_retries: 5\n  carbon_circuit_breaker:\n    open_timeout: 1m\n"), cfg)
+	if err != nil {
+		t.Fatalf("Error parsing retry config: %s", err)
+	}
+
+	if cfg.Write.CarbonRetry.MaxRetries != 5 || cfg.Write.CarbonRetry.MinBackoff != DefaultConfig.Write.CarbonRetry.MinBackoff ||
+		cfg.Write.CarbonRetry.MaxBackoff != DefaultConfig.Write.CarbonRetry.MaxBackoff {
+		t.Fatalf("unexpected retry config: %+v", cfg.Write.CarbonRetry)
+	}
+	if cfg.Write.CarbonCircuitBreaker.OpenTimeout != time.Minute ||
+		cfg.Write.CarbonCircuitBreaker.FailureThreshold != DefaultConfig.Write.CarbonCircuitBreaker.FailureThreshold {
+		t.Fatalf("unexpected circuit breaker config: %+v", cfg.Write.CarbonCircuitBreaker)
+	}
+}
+
+func TestUnmarshalTLSConfig(t *testing.T) {
+	srv := httptest.NewTLSServer(nil)
+	defer srv.Close()
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &Config{}
+	err := yaml.Unmarshal([]byte("write:\n  carbon_transport: tls\n  carbon_tls:\n    ca_file: "+caFile+"\n    server_name: carbon\n"), cfg)
+	if err != nil {
+		t.Fatalf("Error parsing TLS config: %s", err)
+	}
+	if cfg.Write.CarbonTLS == nil || cfg.Write.CarbonTLS.CAFile != caFile || cfg.Write.CarbonTLS.ServerName != "carbon" {
+		t.Fatalf("unexpected TLS config: %+v", cfg.Write.CarbonTLS)
+	}
+
+	err = yaml.Unmarshal([]byte("write:\n  carbon_tls:\n    cert_file: /etc/carbon/client.crt\n"), cfg)
+	if err == nil {
+		t.Fatalf("expected an error for a client certificate without key")
+	}
+
+	err = yaml.Unmarshal([]byte("write:\n  carbon_tls:\n    ca_file: "+filepath.Join(t.TempDir(), "missing.crt")+"\n"), cfg)
+	if err == nil {
+		t.Fatalf("expected an error for a CA file that cannot be read")
+	}
+}
+
+func TestUnmarshalCompressLevel(t *testing.T) {
+	cfg := &Config{}
+	err := yaml.Unmarshal([]byte("write:\n  compress_type: zstd\n  compress_level: 19\n"), cfg)
+	if err != nil {
+		t.Fatalf("Error parsing compression config: %s", err)
+	}
+	if cfg.Write.CompressType != Zstd || cfg.Write.CompressLevel != 19 {
+		t.Fatalf("unexpected compression config: %s %d", cfg.Write.CompressType, cfg.Write.CompressLevel)
+	}
+
+	err = yaml.Unmarshal([]byte("write:\n  compress_type: gzip\n  compress_level: 19\n"), &Config{})
+	if err == nil {
+		t.Fatalf("expected an error for a gzip level out of range")
+	}
+}
+
+func TestUnmarshalLZ4FramePerConnection(t *testing.T) {
+	cfg := &Config{}
+	err := yaml.Unmarshal([]byte("write:\n  compress_type: lz4\n  lz4_preferences:\n    frame_per_connection: true\n"), cfg)
+	if err != nil {
+		t.Fatalf("Error parsing lz4 config: %s", err)
+	}
+	if !cfg.Write.CompressLZ4Preferences.FramePerConnection {
+		t.Fatalf("expected frame_per_connection to be set")
+	}
+
+	err = yaml.Unmarshal([]byte("write:\n  carbon_transport: http\n  compress_type: lz4\n  lz4_preferences:\n    frame_per_connection: true\n"), &Config{})
+	if err == nil {
+		t.Fatalf("expected an error for frame_per_connection over http")
+	}
+}
+
+func TestUnmarshalAsyncConfig(t *testing.T) {
+	cfg := &Config{}
+	err := yaml.Unmarshal([]byte("write:\n  async:\n    workers: 4\n"), cfg)
+	if err != nil {
+		t.Fatalf("Error parsing async config: %s", err)
+	}
+	expected := DefaultAsyncConfig
+	expected.Workers = 4
+	if !reflect.DeepEqual(cfg.Write.Async, &expected) {
+		t.Fatalf("unexpected async config: %+v", cfg.Write.Async)
+	}
+
+	err = yaml.Unmarshal([]byte("write:\n  async:\n    flush_interval: 0s\n"), &Config{})
+	if err == nil {
+		t.Fatalf("expected an error for a zero flush interval")
+	}
+}
+
+func TestUnmarshalChunkSize(t *testing.T) {
+	cfg := &Config{}
+	err := yaml.Unmarshal([]byte("write:\n  carbon_address: localhost:2003\n"), cfg)
+	if err != nil {
+		t.Fatalf("Error parsing write config: %s", err)
+	}
+	// Streaming is opt-in.
+	if cfg.Write.ChunkSize != 0 {
+		t.Fatalf("expected no chunk size by default, got %d", cfg.Write.ChunkSize)
+	}
+
+	err = yaml.Unmarshal([]byte("write:\n  chunk_size: 1048576\n"), cfg)
+	if err != nil {
+		t.Fatalf("Error parsing write config: %s", err)
+	}
+	if cfg.Write.ChunkSize != 1<<20 {
+		t.Fatalf("unexpected chunk size %d", cfg.Write.ChunkSize)
+	}
+
+	err = yaml.Unmarshal([]byte("write:\n  chunk_size: -1\n"), &Config{})
+	if err == nil {
+		t.Fatalf("expected an error for a negative chunk size")
+	}
+}
+
+func TestUnmarshalEncodeWorkers(t *testing.T) {
+	cfg := &Config{}
+	err := yaml.Unmarshal([]byte("write:\n  encode_workers: 4\n  encode_parallel_threshold: 500\n"), cfg)
+	if err != nil {
+		t.Fatalf("Error parsing write config: %s", err)
+	}
+	if cfg.Write.EncodeWorkers != 4 || cfg.Write.EncodeParallelThreshold != 500 {
+		t.Fatalf("unexpected encoding config: %d %d", cfg.Write.EncodeWorkers, cfg.Write.EncodeParallelThreshold)
+	}
+
+	err = yaml.Unmarshal([]byte("write:\n  encode_workers: -1\n"), &Config{})
+	if err == nil {
+		t.Fatalf("expected an error for a negative number of encode workers")
+	}
+}
+
+func TestUnmarshalHistograms(t *testing.T) {
+	cfg := &Config{}
+	err := yaml.Unmarshal([]byte("write:\n  histograms: {}\n"), cfg)
+	if err != nil {
+		t.Fatalf("Error parsing write config: %s", err)
+	}
+	if !reflect.DeepEqual(*cfg.Write.Histograms, DefaultHistogramsConfig) {
+		t.Fatalf("unexpected default histograms config: %+v", *cfg.Write.Histograms)
+	}
+
+	cfg = &Config{}
+	err = yaml.Unmarshal([]byte("write:\n  histograms:\n    sum: {suffix: \"\", tag: \"\"}\n    quantiles:\n      - quantile: 0.75\n        suffix: .p75\n    buckets:\n      suffix: .bucket\n      tag: bucket\n"), cfg)
+	if err != nil {
+		t.Fatalf("Error parsing write config: %s", err)
+	}
+	histograms := cfg.Write.Histograms
+	if histograms.TagName != "stat" || histograms.Count.Suffix != ".count" || histograms.Sum.Suffix != "" || histograms.Sum.Tag != "" {
+		t.Fatalf("unexpected histograms config: %+v", *histograms)
+	}
+	if len(histograms.Quantiles) != 1 || histograms.Quantiles[0].Quantile != 0.75 || histograms.Quantiles[0].Suffix != ".p75" {
+		t.Fatalf("unexpected histogram quantiles: %+v", histograms.Quantiles)
+	}
+	if histograms.Buckets.Suffix != ".bucket" || histograms.Buckets.Tag != "bucket" {
+		t.Fatalf("unexpected histogram buckets: %+v", histograms.Buckets)
+	}
+	if len(DefaultHistogramsConfig.Quantiles) != 3 || DefaultHistogramsConfig.Quantiles[0].Quantile != 0.5 {
+		t.Fatalf("default histograms config was modified: %+v", DefaultHistogramsConfig)
+	}
+
+	err = yaml.Unmarshal([]byte("write:\n  histograms:\n    quantiles:\n      - quantile: 1.5\n"), &Config{})
+	if err == nil {
+		t.Fatalf("expected an error for a quantile out of range")
+	}
+}
+
+func TestUnmarshalSpecialValues(t *testing.T) {
+	cfg := &Config{}
+	err := yaml.Unmarshal([]byte("write:\n  special_values:\n    nan:\n      action: substitute\n      value: -1\n    stale:\n      action: marker\n    marker_suffix: .stale\n"), cfg)
+	if err != nil {
+		t.Fatalf("Error parsing write config: %s", err)
+	}
+	sv := cfg.Write.SpecialValues
+	if sv.NaN.Action != ActionSubstitute || sv.NaN.Value != -1 || sv.Stale.Action != ActionMarker {
+		t.Fatalf("unexpected special values config: %+v", sv)
+	}
+	if sv.Inf.Action != ActionDrop || sv.MarkerSuffix != ".stale" || sv.MarkerTagName != "marker" {
+		t.Fatalf("unexpected special values defaults: %+v", sv)
+	}
+
+	err = yaml.Unmarshal([]byte("write:\n  special_values:\n    inf:\n      action: clamp\n"), &Config{})
+	if err == nil {
+		t.Fatalf("expected an error for an unsupported special value action")
+	}
+}
+
+func TestUnmarshalCollapse(t *testing.T) {
+	cfg := &Config{}
+	err := yaml.Unmarshal([]byte("write:\n  timestamp_precision: milliseconds\n  collapse:\n    policy: max\n    interval: 100ms\n"), cfg)
+	if err != nil {
+		t.Fatalf("Error parsing write config: %s", err)
+	}
+	if cfg.Write.TimestampPrecision != PrecisionMilliseconds {
+		t.Fatalf("unexpected timestamp precision: %s", cfg.Write.TimestampPrecision)
+	}
+	if cfg.Write.Collapse.Policy != CollapseMax || cfg.Write.Collapse.Interval != 100*time.Millisecond {
+		t.Fatalf("unexpected collapse config: %+v", cfg.Write.Collapse)
+	}
+
+	for _, s := range []string{
+		"write:\n  timestamp_precision: microseconds\n",
+		"write:\n  collapse:\n    policy: median\n",
+		"write:\n  collapse:\n    policy: avg\n    interval: 100us\n",
+		"write:\n  carbon_protocol: carbonpb\n  timestamp_precision: fractional\n",
+	} {
+		if err := yaml.Unmarshal([]byte(s), &Config{}); err == nil {
+			t.Fatalf("expected an error parsing %q", s)
+		}
+	}
+}
+
+func TestUnmarshalWriteRelabelConfigs(t *testing.T) {
+	cfg := &Config{}
+	err := yaml.Unmarshal([]byte("write:\n  write_relabel_configs:\n  - action: labeldrop\n    regex: pod_template_hash\n  - source_labels: [instance]\n    target_label: host\n"), cfg)
+	if err != nil {
+		t.Fatalf("Error parsing write config: %s", err)
+	}
+	cfgs := cfg.Write.WriteRelabelConfigs
+	if len(cfgs) != 2 || cfgs[0].Action != RelabelLabelDrop || !cfgs[0].Regex.MatchString("pod_template_hash") {
+		t.Fatalf("unexpected write relabel configs: %+v", cfgs)
+	}
+	if cfgs[1].Action != RelabelReplace || cfgs[1].Separator != ";" || cfgs[1].Replacement != "$1" || cfgs[1].Regex.String() != "^(?:(.*))$" {
+		t.Fatalf("unexpected write relabel config defaults: %+v", cfgs[1])
+	}
+
+	for _, s := range []string{
+		"write:\n  write_relabel_configs:\n  - action: rename\n",
+		"write:\n  write_relabel_configs:\n  - action: hashmod\n    target_label: shard\n",
+		"write:\n  write_relabel_configs:\n  - action: lowercase\n",
+		"write:\n  write_relabel_configs:\n  - source_labels: [job]\n    target_label: 1job\n",
+		"write:\n  write_relabel_configs:\n  - action: labeldrop\n    source_labels: [job]\n",
+	} {
+		if err := yaml.Unmarshal([]byte(s), &Config{}); err == nil {
+			t.Fatalf("expected an error parsing %q", s)
+		}
+	}
+}
+
+func TestUnmarshalLimits(t *testing.T) {
+	cfg := &Config{}
+	err := yaml.Unmarshal([]byte("write:\n  limits:\n    max_series: 100000\n    max_series_per_metric: 1000\n    action: overflow\n"), cfg)
+	if err != nil {
+		t.Fatalf("Error parsing write config: %s", err)
+	}
+	l := cfg.Write.Limits
+	if l.MaxSeries != 100000 || l.MaxSeriesPerMetric != 1000 || l.MaxSeriesPerPrefix != 0 || l.Action != LimitOverflow {
+		t.Fatalf("unexpected limits config: %+v", l)
+	}
+	if l.PrefixNodes != 1 || l.Window != time.Hour || l.OverflowPath != "overflow" {
+		t.Fatalf("unexpected limits defaults: %+v", l)
+	}
+
+	for _, s := range []string{
+		"write:\n  limits:\n    max_series: -1\n",
+		"write:\n  limits:\n    window: 0s\n",
+		"write:\n  limits:\n    action: sample\n",
+		"write:\n  limits:\n    action: overflow\n    overflow_path: ''\n",
+	} {
+		if err := yaml.Unmarshal([]byte(s), &Config{}); err == nil {
+			t.Fatalf("expected an error parsing %q", s)
+		}
+	}
+}
+
+func TestUnmarshalPathLimits(t *testing.T) {
+	cfg := &Config{}
+	err := yaml.Unmarshal([]byte("write:\n  path_limits:\n    max_path_length: 1024\n    index_file: /data/paths-index.jsonl\n"), cfg)
+	if err != nil {
+		t.Fatalf("Error parsing write config: %s", err)
+	}
+	l := cfg.Write.PathLimits
+	if l.MaxPathLength != 1024 || l.MaxNodeLength != 255 || l.IndexFile != "/data/paths-index.jsonl" {
+		t.Fatalf("unexpected path limits config: %+v", l)
+	}
+
+	for _, s := range []string{
+		"write:\n  path_limits:\n    max_path_length: -1\n",
+		"write:\n  path_limits:\n    max_node_length: 10\n",
+	} {
+		if err := yaml.Unmarshal([]byte(s), &Config{}); err == nil {
+			t.Fatalf("expected an error parsing %q", s)
+		}
+	}
+}
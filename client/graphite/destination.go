@@ -0,0 +1,293 @@
+// Copyright 2024-2025 NetCracker Technology Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package graphite
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/breaker"
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/config"
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/hashing"
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/spool"
+	"github.com/Netcracker/qubership-graphite-remote-adapter/utils/lz4"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	destinationUp = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "remote_adapter_graphite",
+			Name:      "destination_up",
+			Help:      "Whether the last write to the carbon destination succeeded.",
+		},
+		[]string{"destination"},
+	)
+	circuitBreakerState = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "remote_adapter_graphite",
+			Name:      "circuit_breaker_state",
+			Help:      "State of the circuit breaker of the carbon destination: 0 closed, 1 open, 2 half-open.",
+		},
+		[]string{"destination"},
+	)
+)
+
+// carbonConn is a single connection of the carbon connections pool of a destination.
+type carbonConn struct {
+	address           string
+	lock              sync.Mutex
+	conn              net.Conn
+	lastReconnectTime time.Time
+	// lz4 writes the lz4 frame kept open for the lifetime of the connection into compressed.
+	lz4        *lz4.Writer
+	compressed bytes.Buffer
+}
+
+// destination is a carbon node with its own connections, spool and health.
+type destination struct {
+	address string
+	node    hashing.Node
+	conns   []*carbonConn
+	spool   *spool.Spool
+	breaker *breaker.Breaker
+	up      prometheus.Gauge
+}
+
+// parseDestination parses a carbon destination in the host:port[:instance] format of carbon-relay.
+func parseDestination(destination string) (string, hashing.Node) {
+	host, port, err := net.SplitHostPort(destination)
+	if err != nil {
+		if i := strings.LastIndexByte(destination, ':'); i > 0 {
+			if host, port, err = net.SplitHostPort(destination[:i]); err == nil {
+				return net.JoinHostPort(host, port), hashing.Node{Server: host, Instance: destination[i+1:]}
+			}
+		}
+		// Let the dialer report the malformed address.
+		return destination, hashing.Node{Server: destination}
+	}
+	return net.JoinHostPort(host, port), hashing.Node{Server: host}
+}
+
+func newDestination(address string, node hashing.Node, connections int, cbCfg config.CircuitBreakerConfig) *destination {
+	state := circuitBreakerState.WithLabelValues(address)
+	d := &destination{
+		address: address,
+		node:    node,
+		conns:   make([]*carbonConn, connections),
+		breaker: breaker.New(cbCfg.FailureThreshold, cbCfg.OpenTimeout, func(s breaker.State) { state.Set(float64(s)) }),
+		up:      destinationUp.WithLabelValues(address),
+	}
+	for i := range d.conns {
+		d.conns[i] = &carbonConn{address: address}
+	}
+	return d
+}
+
+// connIndex returns the index of the connection a path is sent with.
+// Lines of the same path always use the same connection to preserve their order.
+func connIndex(path []byte, connections int) int {
+	if connections == 1 {
+		return 0
+	}
+	return int(fnv1a32(path) % uint32(connections))
+}
+
+func fnv1a32(b []byte) uint32 {
+	h := uint32(2166136261)
+	for _, c := range b {
+		h ^= uint32(c)
+		h *= 16777619
+	}
+	return h
+}
+
+// writeDestination sends the buffers of each connection of the destination in parallel.
+// Buffers that cannot be sent are spooled if the destination has a spool.
+func (client *Client) writeDestination(ctx context.Context, d *destination, bytesBuffers [][]*bytes.Buffer) ([]byte, error) {
+	if d.spool != nil && d.spool.Len() > 0 {
+		// Keep the order of batches while the spool is being replayed.
+		if err := client.spoolBuffers(d, flattenBuffers(bytesBuffers), nil); err != nil {
+			return nil, err
+		}
+		return []byte("Spooled."), nil
+	}
+
+	if !d.breaker.Allow() {
+		// Carbon is known to be down, do not wait for it to fail again.
+		if d.spool != nil {
+			if err := client.spoolBuffers(d, flattenBuffers(bytesBuffers), breaker.ErrOpen); err != nil {
+				return nil, err
+			}
+			return []byte("Spooled."), nil
+		}
+		return nil, fmt.Errorf("%s: %w", d.address, breaker.ErrOpen)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(bytesBuffers))
+	spooled := make([]bool, len(bytesBuffers))
+	for i, buffers := range bytesBuffers {
+		if len(buffers) == 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, buffers []*bytes.Buffer) {
+			defer wg.Done()
+			spooled[i], errs[i] = client.writeBuffers(ctx, d, d.conns[i], buffers)
+		}(i, buffers)
+	}
+	wg.Wait()
+
+	response := []byte("Done.")
+	var err error
+	for i := range errs {
+		if errs[i] != nil {
+			err = errs[i]
+			break
+		}
+		if spooled[i] {
+			response = []byte("Spooled.")
+		}
+	}
+	if err != nil || string(response) != "Done." {
+		d.breaker.Failure()
+		d.up.Set(0)
+	} else {
+		d.breaker.Success()
+		d.up.Set(1)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// writeBuffers sends buffers in order using the connection c.
+// It returns true if carbon failed and the remaining buffers have been spooled.
+func (client *Client) writeBuffers(ctx context.Context, d *destination, c *carbonConn, bytesBuffers []*bytes.Buffer) (bool, error) {
+	for i, buf := range bytesBuffers {
+		if err := client.writeWithRetry(ctx, d, c, buf); err != nil {
+			if d.spool == nil {
+				return false, err
+			}
+			if spoolErr := client.spoolBuffers(d, bytesBuffers[i:], err); spoolErr != nil {
+				return false, spoolErr
+			}
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func flattenBuffers(bytesBuffers [][]*bytes.Buffer) []*bytes.Buffer {
+	var flat []*bytes.Buffer
+	for _, buffers := range bytesBuffers {
+		flat = append(flat, buffers...)
+	}
+	return flat
+}
+
+func (client *Client) connectToCarbon(c *carbonConn) (net.Conn, error) {
+	if c.conn != nil {
+		if time.Since(c.lastReconnectTime) < client.cfg.Write.CarbonReconnectInterval {
+			// Last reconnect is not too long ago, re-use the connection.
+			return c.conn, nil
+		}
+		_ = level.Debug(client.logger).Log(
+			"last", c.lastReconnectTime,
+			"msg", "Reinitializing the connection to carbon")
+		client.endFrame(c)
+		client.disconnectFromCarbon(c)
+	}
+
+	_ = level.Debug(client.logger).Log(
+		"transport", client.cfg.Write.CarbonTransport,
+		"address", c.address,
+		"timeout", client.writeTimeout,
+		"msg", "Connecting to carbon")
+	dialer := net.Dialer{
+		Timeout:   client.writeTimeout,
+		KeepAlive: client.cfg.Write.CarbonKeepAlive,
+	}
+	var conn net.Conn
+	var err error
+	switch client.cfg.Write.CarbonTransport {
+	case "tls":
+		if client.tlsErr != nil {
+			return nil, client.tlsErr
+		}
+		tlsDialer := tls.Dialer{NetDialer: &dialer, Config: client.tlsConfig}
+		conn, err = tlsDialer.Dial("tcp", c.address)
+	default:
+		conn, err = dialer.Dial(client.cfg.Write.CarbonTransport, c.address)
+	}
+	if err == nil && c.lz4 == nil && client.framePerConnection() {
+		if c.lz4, err = lz4.NewStreamWriter(&c.compressed, client.logger, client.cfg.Write.CompressLZ4Preferences); err != nil {
+			_ = conn.Close()
+		}
+	}
+	if err != nil {
+		c.conn = nil
+	} else {
+		c.lastReconnectTime = time.Now()
+		c.conn = conn
+	}
+
+	return c.conn, err
+}
+
+func (client *Client) disconnectFromCarbon(c *carbonConn) {
+	if c.conn != nil {
+		_ = c.conn.Close()
+	}
+	c.conn = nil
+	if c.lz4 != nil {
+		// The next connection starts a new frame.
+		c.lz4.Reset(&c.compressed)
+	}
+}
+
+// framePerConnection tells if a single lz4 frame is kept open for the lifetime of each carbon connection.
+func (client *Client) framePerConnection() bool {
+	prefs := client.cfg.Write.CompressLZ4Preferences
+	return client.cfg.Write.CompressType == config.LZ4 && prefs != nil && prefs.FramePerConnection
+}
+
+// endFrame writes the end of the lz4 frame of the connection c before it is closed.
+func (client *Client) endFrame(c *carbonConn) {
+	if c.lz4 == nil || c.conn == nil {
+		return
+	}
+	c.compressed.Reset()
+	if err := c.lz4.End(); err != nil {
+		return
+	}
+	if client.cfg.Write.CarbonWriteDeadline > 0 {
+		_ = c.conn.SetWriteDeadline(time.Now().Add(client.cfg.Write.CarbonWriteDeadline))
+	}
+	if _, err := c.conn.Write(c.compressed.Bytes()); err != nil {
+		_ = level.Debug(client.logger).Log("err", err, "address", c.address, "msg", "Failed to end lz4 frame")
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2024-2025 NetCracker Technology Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package hashing implements the consistent hashing of carbon-relay, so that each
+// Graphite path lands on the same node as it would when sent through carbon-relay.
+package hashing
+
+import (
+	"crypto/md5"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// Type of the consistent hashing.
+type Type string
+
+// Supported hashing types.
+const (
+	// CarbonCH is the default md5 based hashing of carbon-relay (carbon_ch).
+	CarbonCH Type = "carbon_ch"
+	// FNV1aCH is the fnv1a based hashing of carbon-relay (fnv1a_ch).
+	FNV1aCH Type = "fnv1a_ch"
+)
+
+const replicaCount = 100
+
+// Node is a destination of the ring, identified like carbon-relay does by its server and instance.
+type Node struct {
+	Server   string
+	Instance string
+}
+
+// key returns the python representation of the (server, instance) tuple carbon-relay hashes.
+func (n Node) key() string {
+	instance := "None"
+	if n.Instance != "" {
+		instance = "'" + n.Instance + "'"
+	}
+	return fmt.Sprintf("('%s', %s)", n.Server, instance)
+}
+
+type entry struct {
+	position int
+	node     int
+}
+
+// Ring is a consistent hash ring compatible with carbon-relay's ConsistentHashRing.
+type Ring struct {
+	hashType Type
+	entries  []entry
+}
+
+// NewRing builds the ring of nodes. The index of a node in nodes is what GetNode returns.
+func NewRing(hashType Type, nodes []Node) *Ring {
+	r := &Ring{hashType: hashType}
+	taken := make(map[int]struct{}, len(nodes)*replicaCount)
+	for i, node := range nodes {
+		for replica := 0; replica < replicaCount; replica++ {
+			var replicaKey string
+			if hashType == FNV1aCH {
+				instance := node.Instance
+				if instance == "" {
+					instance = "None"
+				}
+				replicaKey = strconv.Itoa(replica) + "-" + instance
+			} else {
+				replicaKey = node.key() + ":" + strconv.Itoa(replica)
+			}
+			position := r.position([]byte(replicaKey))
+			for {
+				if _, ok := taken[position]; !ok {
+					break
+				}
+				position++
+			}
+			taken[position] = struct{}{}
+			r.entries = append(r.entries, entry{position: position, node: i})
+		}
+	}
+	sort.Slice(r.entries, func(i, j int) bool { return r.entries[i].position < r.entries[j].position })
+	return r
+}
+
+func (r *Ring) position(key []byte) int {
+	if r.hashType == FNV1aCH {
+		h := fnv1a32(key)
+		return int((h >> 16) ^ (h & 0xffff))
+	}
+	// The first 4 hex digits of the md5 digest.
+	sum := md5.Sum(key)
+	return int(sum[0])<<8 | int(sum[1])
+}
+
+// GetNode returns the index of the node the key belongs to.
+func (r *Ring) GetNode(key []byte) int {
+	position := r.position(key)
+	i := sort.Search(len(r.entries), func(i int) bool { return r.entries[i].position >= position })
+	return r.entries[i%len(r.entries)].node
+}
+
+// fnv1a32 hashes the code points of key, as carbon-relay does for python strings.
+func fnv1a32(key []byte) uint32 {
+	h := uint32(0x811c9dc5)
+	for _, c := range string(key) {
+		h ^= uint32(c)
+		h *= 0x01000193
+	}
+	return h
+}
@@ -0,0 +1,61 @@
+// Copyright 2024-2025 NetCracker Technology Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package hashing
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var testNodes = []Node{
+	{Server: "10.0.0.1"},
+	{Server: "10.0.0.2", Instance: "a"},
+	{Server: "10.0.0.3", Instance: "b"},
+}
+
+func testKeys() []string {
+	var keys []string
+	for i := 0; i < 20; i++ {
+		keys = append(keys, fmt.Sprintf("metric.%d.value", i))
+	}
+	return append(keys, "météo.temp", "test;tag=value")
+}
+
+// Expected nodes are computed with carbon's ConsistentHashRing (carbon/hashing.py).
+func TestCarbonCHRing(t *testing.T) {
+	expected := []int{2, 0, 1, 2, 1, 0, 1, 0, 0, 0, 0, 0, 2, 2, 0, 0, 2, 1, 0, 2, 1, 1}
+	ring := NewRing(CarbonCH, testNodes)
+	for i, key := range testKeys() {
+		require.Equal(t, expected[i], ring.GetNode([]byte(key)), key)
+	}
+}
+
+func TestFNV1aCHRing(t *testing.T) {
+	expected := []int{2, 0, 0, 2, 0, 1, 2, 1, 0, 0, 0, 0, 1, 2, 0, 0, 1, 0, 1, 2, 2, 2}
+	ring := NewRing(FNV1aCH, testNodes)
+	for i, key := range testKeys() {
+		require.Equal(t, expected[i], ring.GetNode([]byte(key)), key)
+	}
+}
+
+func TestSingleNodeRing(t *testing.T) {
+	ring := NewRing(CarbonCH, testNodes[:1])
+	for _, key := range testKeys() {
+		require.Equal(t, 0, ring.GetNode([]byte(key)))
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright 2024-2025 NetCracker Technology Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package graphite
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/config"
+	graphitetmpl "github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/template"
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/histogram"
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/metadata"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/value"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// bucketLabel is the label of the upper boundary of bucket series in the tagged modes.
+const bucketLabel = "le"
+
+// derivedSeries is a series derived from the histograms of a time series.
+type derivedSeries struct {
+	paths [][]byte
+	value func(h *histogram.Histogram) float64
+}
+
+// appendHistograms encodes the series derived from the histograms of a time series into the batches
+// of their destination and counts the histograms. The paths of derived series are computed once for
+// all the histograms of the time series.
+// Values of derived series that are not a number, like quantiles of empty histograms, are written like
+// samples of special values, and all the values of a stale histogram like staleness markers. It returns
+// whether a histogram was stale.
+func (client *Client) appendHistograms(bytesBuffers [][][]*bytes.Buffer, counts []int, ts *prompb.TimeSeries,
+	metric model.Metric, md metadata.Metadata, paths [][]byte, graphitePrefix string, reqBufLen int) bool {
+	histograms, err := histogram.FromTimeSeries(ts)
+	if err != nil {
+		_ = level.Debug(client.logger).Log("metric", metric, "err", err)
+		ignoredSamples.Add(float64(histogram.Len(ts)))
+		return false
+	}
+	if len(histograms) == 0 {
+		return false
+	}
+
+	cfg := client.cfg.Write.Histograms
+	var derived []derivedSeries
+	add := func(series config.HistogramSeriesConfig, value func(h *histogram.Histogram) float64) {
+		if p := client.derivedPaths(metric, md, paths, series.Suffix, client.histogramTags(series.Tag, ""), graphitePrefix); len(p) > 0 {
+			derived = append(derived, derivedSeries{paths: p, value: value})
+		}
+	}
+	add(cfg.Count, func(h *histogram.Histogram) float64 { return h.Count })
+	add(cfg.Sum, func(h *histogram.Histogram) float64 { return h.Sum })
+	for _, q := range cfg.Quantiles {
+		quantile := q.Quantile
+		add(config.HistogramSeriesConfig{Suffix: q.Suffix, Tag: q.Tag}, func(h *histogram.Histogram) float64 { return h.Quantile(quantile) })
+	}
+	// Paths of bucket series by upper boundary, shared by the histograms of the time series.
+	var bucketPaths map[float64][][]byte
+	if p := client.bucketPaths(metric, md, paths, "+Inf", graphitePrefix); len(p) > 0 {
+		bucketPaths = map[float64][][]byte{math.Inf(1): p}
+	}
+
+	replicate := client.cfg.Write.CarbonRouting == config.RoutingReplicate
+	sentTo := make([]bool, len(client.destinations))
+	stale := false
+	// End marker paths of the time series, computed with its first marker.
+	var markerPaths [][]byte
+	for n := range histograms {
+		h := &histograms[n]
+		clear(sentTo)
+		// Whether the end marker of the histogram was written, once for all its derived series.
+		marked := false
+		staleHistogram := value.IsStaleNaN(h.Sum)
+		stale = stale || staleHistogram
+		write := func(seriesPaths [][]byte, v float64) {
+			if staleHistogram {
+				v = h.Sum
+			}
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				_, policy := client.specialValue(v)
+				switch policy.Action {
+				case config.ActionSubstitute:
+					v = policy.Value
+				case config.ActionMarker:
+					if !marked {
+						if markerPaths == nil {
+							markerPaths = client.markerPaths(metric, md, paths, graphitePrefix)
+						}
+						client.appendMarker(bytesBuffers, counts, markerPaths, policy.Value, h.Timestamp, reqBufLen)
+						marked = true
+					}
+					return
+				default:
+					return
+				}
+			}
+			for _, path := range seriesPaths {
+				i := 0
+				if !replicate {
+					i = client.destinationIndex(path)
+				}
+				sentTo[i] = true
+				client.appendDatapoint(bytesBuffers[i], path, v, h.Timestamp, reqBufLen)
+			}
+		}
+		for _, d := range derived {
+			write(d.paths, d.value(h))
+		}
+		if bucketPaths != nil {
+			buckets := h.Buckets()
+			if len(buckets) == 0 || !math.IsInf(buckets[len(buckets)-1].Upper, 1) {
+				buckets = append(buckets, histogram.Bucket{Upper: math.Inf(1)})
+			}
+			cumulative := 0.0
+			for _, b := range buckets {
+				cumulative += b.Count
+				p, ok := bucketPaths[b.Upper]
+				if !ok {
+					le := strconv.FormatFloat(b.Upper, 'g', -1, 64)
+					p = client.bucketPaths(metric, md, paths, le, graphitePrefix)
+					bucketPaths[b.Upper] = p
+				}
+				write(p, cumulative)
+			}
+		}
+		for i := range counts {
+			if sentTo[i] || (replicate && sentTo[0]) {
+				counts[i]++
+			}
+		}
+	}
+	return stale
+}
+
+// bucketPaths returns the paths of the bucket series of upper boundary le of the histograms of a metric.
+// In the plain mode, bucket series are also suffixed with their escaped upper boundary.
+func (client *Client) bucketPaths(metric model.Metric, md metadata.Metadata, paths [][]byte, le, graphitePrefix string) [][]byte {
+	buckets := client.cfg.Write.Histograms.Buckets
+	suffix := ""
+	if buckets.Suffix != "" {
+		suffix = buckets.Suffix + "." + string(graphitetmpl.Escape(le))
+	}
+	return client.derivedPaths(metric, md, paths, suffix, client.histogramTags(buckets.Tag, le), graphitePrefix)
+}
+
+// histogramTags returns the tags of a series derived from histograms in the tagged modes, none when
+// the series has no tag. Bucket series are also told apart by their upper boundary le.
+func (client *Client) histogramTags(tag, le string) model.LabelSet {
+	if tag == "" {
+		return nil
+	}
+	tags := model.LabelSet{model.LabelName(client.cfg.Write.Histograms.TagName): model.LabelValue(tag)}
+	if le != "" {
+		tags[bucketLabel] = model.LabelValue(le)
+	}
+	return tags
+}
@@ -0,0 +1,173 @@
+// Copyright 2024-2025 NetCracker Technology Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package graphite
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	graphiteconfig "github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/config"
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/histogram"
+	"github.com/Netcracker/qubership-graphite-remote-adapter/config"
+	"github.com/go-kit/log"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// encodeHistogram encodes an integer histogram of schema 0 with packed bucket deltas.
+func encodeHistogram(count uint64, sum float64, spans []histogram.Span, deltas []int64, timestamp int64) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.VarintType)
+	b = protowire.AppendVarint(b, count)
+	b = protowire.AppendTag(b, 3, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, math.Float64bits(sum))
+	b = protowire.AppendTag(b, 4, protowire.VarintType)
+	b = protowire.AppendVarint(b, 0)
+	for _, span := range spans {
+		var s []byte
+		s = protowire.AppendTag(s, 1, protowire.VarintType)
+		s = protowire.AppendVarint(s, protowire.EncodeZigZag(int64(span.Offset)))
+		s = protowire.AppendTag(s, 2, protowire.VarintType)
+		s = protowire.AppendVarint(s, uint64(span.Length))
+		b = protowire.AppendTag(b, 11, protowire.BytesType)
+		b = protowire.AppendBytes(b, s)
+	}
+	var packed []byte
+	for _, d := range deltas {
+		packed = protowire.AppendVarint(packed, protowire.EncodeZigZag(d))
+	}
+	b = protowire.AppendTag(b, 12, protowire.BytesType)
+	b = protowire.AppendBytes(b, packed)
+	b = protowire.AppendTag(b, 15, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(timestamp))
+}
+
+// histogramSeries returns a time series of the given encoded histograms.
+func histogramSeries(name string, histograms ...[]byte) prompb.TimeSeries {
+	ts := prompb.TimeSeries{Labels: []prompb.Label{{Name: "__name__", Value: name}, {Name: "job", Value: "app"}}}
+	for _, h := range histograms {
+		ts.XXX_unrecognized = histogram.AppendRaw(ts.XXX_unrecognized, h)
+	}
+	return ts
+}
+
+func TestWriteHistograms(t *testing.T) {
+	// Buckets (1, 2], (2, 4] and (8, 16] of 2, 4 and 3 observations, then an empty histogram.
+	series := histogramSeries("latency",
+		encodeHistogram(9, 42, []histogram.Span{{Offset: 1, Length: 2}, {Offset: 1, Length: 1}}, []int64{2, 2, -1}, 1600000000000),
+		encodeHistogram(0, 0, nil, nil, 1600000001000),
+	)
+
+	withBuckets := graphiteconfig.DefaultHistogramsConfig
+	withBuckets.Buckets = graphiteconfig.HistogramSeriesConfig{Suffix: ".bucket", Tag: "bucket"}
+
+	tests := []struct {
+		name         string
+		enableTags   bool
+		histograms   *graphiteconfig.HistogramsConfig
+		expectOutput []string
+	}{
+		{
+			name:       "plain",
+			histograms: &withBuckets,
+			expectOutput: []string{
+				"latency.job.app.count 9.000000 1600000000",
+				"latency.job.app.sum 42.000000 1600000000",
+				"latency.job.app.p50 3.250000 1600000000",
+				"latency.job.app.p90 13.600000 1600000000",
+				"latency.job.app.p99 15.760000 1600000000",
+				"latency.job.app.bucket.2 2.000000 1600000000",
+				"latency.job.app.bucket.4 6.000000 1600000000",
+				"latency.job.app.bucket.16 9.000000 1600000000",
+				"latency.job.app.bucket.+Inf 9.000000 1600000000",
+				// Quantiles of empty histograms are not written.
+				"latency.job.app.count 0.000000 1600000001",
+				"latency.job.app.sum 0.000000 1600000001",
+				"latency.job.app.bucket.+Inf 0.000000 1600000001",
+			},
+		},
+		{
+			name:       "tagged",
+			enableTags: true,
+			histograms: &withBuckets,
+			expectOutput: []string{
+				"latency;job=app;stat=count 9.000000 1600000000",
+				"latency;job=app;stat=sum 42.000000 1600000000",
+				"latency;job=app;stat=p50 3.250000 1600000000",
+				"latency;job=app;stat=p90 13.600000 1600000000",
+				"latency;job=app;stat=p99 15.760000 1600000000",
+				"latency;job=app;le=2;stat=bucket 2.000000 1600000000",
+				"latency;job=app;le=4;stat=bucket 6.000000 1600000000",
+				"latency;job=app;le=16;stat=bucket 9.000000 1600000000",
+				"latency;job=app;le=+Inf;stat=bucket 9.000000 1600000000",
+				"latency;job=app;stat=count 0.000000 1600000001",
+				"latency;job=app;stat=sum 0.000000 1600000001",
+				"latency;job=app;le=+Inf;stat=bucket 0.000000 1600000001",
+			},
+		},
+		{
+			name: "series without suffix or tag",
+			histograms: &graphiteconfig.HistogramsConfig{
+				TagName: "stat",
+				Count:   graphiteconfig.HistogramSeriesConfig{Suffix: ".count"},
+				Sum:     graphiteconfig.HistogramSeriesConfig{Tag: "sum"},
+			},
+			expectOutput: []string{
+				"latency.job.app.count 9.000000 1600000000",
+				"latency.job.app.count 0.000000 1600000001",
+			},
+		},
+		{
+			name:         "disabled",
+			expectOutput: nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := config.DefaultConfig
+			cfg.Graphite.Write.CarbonAddress = "127.0.0.1:1"
+			cfg.Graphite.EnableTags = test.enableTags
+			cfg.Graphite.Write.Histograms = test.histograms
+			client := NewClient(&cfg, log.NewNopLogger(), nil, nil)
+			defer client.Shutdown()
+
+			response, err := writeSeries(client, true, series,
+				testSeries("requests", prompb.Sample{Value: 1, Timestamp: 1600000000000}))
+			require.NoError(t, err)
+			expected := append(test.expectOutput, "requests 1.000000 1600000000")
+			require.Equal(t, strings.Join(expected, "\n")+"\n", string(response))
+		})
+	}
+}
+
+func TestWriteInvalidHistogram(t *testing.T) {
+	cfg := config.DefaultConfig
+	cfg.Graphite.Write.CarbonAddress = "127.0.0.1:1"
+	histograms := graphiteconfig.DefaultHistogramsConfig
+	cfg.Graphite.Write.Histograms = &histograms
+	client := NewClient(&cfg, log.NewNopLogger(), nil, nil)
+	defer client.Shutdown()
+
+	// A truncated histogram is dropped without failing the other series of the request.
+	valid := encodeHistogram(1, 1, nil, nil, 1600000000000)
+	response, err := writeSeries(client, true,
+		histogramSeries("latency", valid[:len(valid)-1]),
+		testSeries("requests", prompb.Sample{Value: 1, Timestamp: 1600000000000}))
+	require.NoError(t, err)
+	require.Equal(t, "requests 1.000000 1600000000\n", string(response))
+}
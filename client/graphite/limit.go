@@ -0,0 +1,93 @@
+// Copyright 2024-2025 NetCracker Technology Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package graphite
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/config"
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/limiter"
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/paths"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/common/model"
+)
+
+// Series over budget are logged at most once per limitLogInterval.
+const limitLogInterval = 10 * time.Second
+
+var (
+	limitedSamples = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "remote_adapter_graphite",
+			Name:      "limited_samples_total",
+			Help:      "Total number of samples and histograms of new series over a cardinality budget, by budget and action taken.",
+		},
+		[]string{"limit", "action"},
+	)
+	limiterActiveSeries = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "remote_adapter_graphite",
+			Name:      "limiter_active_series",
+			Help:      "Number of active series tracked by the cardinality limiter.",
+		},
+	)
+)
+
+// limitSeries checks a series against the cardinality budgets and returns the paths its samples are
+// written to: its own paths when it is admitted, the overflow path or nil when it is over budget.
+// limited is set when the series is over budget.
+func (client *Client) limitSeries(metric model.Metric, paths [][]byte, graphitePrefix string, samples int) (_ [][]byte, limited bool) {
+	cfg := client.cfg.Write.Limits
+	var prefix string
+	if cfg.MaxSeriesPerPrefix > 0 {
+		prefix = pathPrefix(paths[0], graphitePrefix, cfg.PrefixNodes, client.format)
+	}
+	name := string(metric[model.MetricNameLabel])
+	now := time.Now()
+	limit := client.limiter.Admit(metric.Fingerprint(), name, prefix, now)
+	if limit == limiter.None {
+		return paths, false
+	}
+
+	limitedSamples.WithLabelValues(string(limit), string(cfg.Action)).Add(float64(samples))
+	if last := client.limitLogged.Load(); now.UnixNano()-last >= int64(limitLogInterval) &&
+		client.limitLogged.CompareAndSwap(last, now.UnixNano()) {
+		_ = level.Warn(client.logger).Log("limit", limit, "action", cfg.Action, "metric", name, "prefix", prefix,
+			"series", metric, "active_series", client.limiter.Active(), "msg", "New series over cardinality budget")
+	}
+	if cfg.Action == config.LimitOverflow {
+		return [][]byte{[]byte(graphitePrefix + cfg.OverflowPath)}, true
+	}
+	return nil, true
+}
+
+// pathPrefix returns the first nodes of the name of a path, after the storage prefix.
+func pathPrefix(path []byte, graphitePrefix string, nodes int, format paths.Format) string {
+	path = bytes.TrimPrefix(path, []byte(graphitePrefix))
+	path = path[:paths.NameEnd(path, format)]
+	end := 0
+	for ; nodes > 0; nodes-- {
+		i := bytes.IndexByte(path[end:], '.')
+		if i < 0 {
+			return string(path)
+		}
+		end += i + 1
+	}
+	return string(path[:end-1])
+}
@@ -0,0 +1,90 @@
+// Copyright 2024-2025 NetCracker Technology Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package graphite
+
+import (
+	"testing"
+
+	graphiteconfig "github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/config"
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/limiter"
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/paths"
+	"github.com/Netcracker/qubership-graphite-remote-adapter/config"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPathPrefix(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		nodes    int
+		format   paths.Format
+		expected string
+	}{
+		{name: "carbon", path: "prefix.a.b.c", nodes: 2, format: paths.FormatCarbon, expected: "a.b"},
+		{name: "short", path: "prefix.a.b", nodes: 3, format: paths.FormatCarbon, expected: "a.b"},
+		{name: "tags", path: "prefix.a.b;job=c.d", nodes: 3, format: paths.FormatCarbonTags, expected: "a.b"},
+		{
+			name:     "openmetrics",
+			path:     `prefix.prometheus.http_requests_total{instance="a.b",job="c"}`,
+			nodes:    3,
+			format:   paths.FormatCarbonOpenMetrics,
+			expected: "prometheus.http_requests_total",
+		},
+		{
+			name:     "openmetrics escaped brace",
+			path:     `prefix.a\{b.c{job="d.e"}`,
+			nodes:    1,
+			format:   paths.FormatCarbonOpenMetrics,
+			expected: `a\{b`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.expected, pathPrefix([]byte(test.path), "prefix.", test.nodes, test.format))
+		})
+	}
+}
+
+func TestLimitedSamples(t *testing.T) {
+	cfg := config.DefaultConfig
+	cfg.Graphite.Write.CarbonAddress = "127.0.0.1:1"
+	limits := graphiteconfig.DefaultLimitsConfig
+	limits.MaxSeries = 1
+	cfg.Graphite.Write.Limits = &limits
+	histograms := graphiteconfig.HistogramsConfig{
+		TagName: "stat",
+		Count:   graphiteconfig.HistogramSeriesConfig{Suffix: ".count"},
+	}
+	cfg.Graphite.Write.Histograms = &histograms
+	client := NewClient(&cfg, log.NewNopLogger(), nil, limiter.New(&limits))
+	defer client.Shutdown()
+
+	_, err := writeSeries(client, true, testSeries("admitted", prompb.Sample{Value: 1, Timestamp: 1000}))
+	require.NoError(t, err)
+
+	// The histograms of series over budget are counted with their samples.
+	counter := limitedSamples.WithLabelValues(string(limiter.Global), string(graphiteconfig.LimitReject))
+	before := testutil.ToFloat64(counter)
+	series := histogramSeries("limited", encodeHistogram(1, 1, nil, nil, 1000), encodeHistogram(2, 2, nil, nil, 2000))
+	series.Samples = []prompb.Sample{{Value: 1, Timestamp: 1000}}
+	response, err := writeSeries(client, true, series)
+	require.NoError(t, err)
+	require.Empty(t, response)
+	require.Equal(t, 3.0, testutil.ToFloat64(counter)-before)
+}
@@ -0,0 +1,168 @@
+// Copyright 2024-2025 NetCracker Technology Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package limiter tracks the active series written to carbon and limits their cardinality
+// globally, per metric name and per path prefix.
+package limiter
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/config"
+	"github.com/prometheus/common/model"
+)
+
+// Limit is a budget of active series.
+type Limit string
+
+// Budgets a new series can exceed.
+const (
+	// None is returned when a series is admitted.
+	None   Limit = ""
+	Global Limit = "global"
+	Metric Limit = "metric"
+	Prefix Limit = "prefix"
+)
+
+// Inactive series are purged at most every window divided by purgeFraction, so that a series stays
+// active at most that much longer than the window.
+const purgeFraction = 10
+
+// Active series are spread over shardCount shards by fingerprint, so that samples of active series,
+// the most of them, are admitted concurrently.
+const shardCount = 64
+
+type series struct {
+	metric   string
+	prefix   string
+	lastSeen time.Time
+}
+
+type shard struct {
+	mu     sync.Mutex
+	series map[model.Fingerprint]*series
+}
+
+// Limiter admits the series written while their budgets are not exhausted.
+type Limiter struct {
+	cfg    atomic.Pointer[config.LimitsConfig]
+	shards [shardCount]shard
+	// Unix time in nanoseconds of the last purge.
+	lastPurge atomic.Int64
+
+	// Budgets used by the active series of all the shards, locked after the shard of a series.
+	mu        sync.Mutex
+	active    int
+	perMetric map[string]int
+	perPrefix map[string]int
+}
+
+// New returns a limiter of the series cardinality.
+func New(cfg *config.LimitsConfig) *Limiter {
+	l := &Limiter{
+		perMetric: make(map[string]int),
+		perPrefix: make(map[string]int),
+	}
+	l.cfg.Store(cfg)
+	for i := range l.shards {
+		l.shards[i].series = make(map[model.Fingerprint]*series)
+	}
+	return l
+}
+
+// SetConfig sets the budgets and the window of the limiter. Active series are kept, so that budgets
+// are not reset when the configuration is reloaded.
+func (l *Limiter) SetConfig(cfg *config.LimitsConfig) {
+	l.cfg.Store(cfg)
+}
+
+// Admit records a sample of a series at now and returns the budget it exceeds, None when it is admitted.
+// Active series are always admitted, new series only while none of their budgets is exhausted.
+func (l *Limiter) Admit(fp model.Fingerprint, metric, prefix string, now time.Time) Limit {
+	cfg := l.cfg.Load()
+	if last := l.lastPurge.Load(); now.UnixNano()-last >= int64(cfg.Window/purgeFraction) &&
+		l.lastPurge.CompareAndSwap(last, now.UnixNano()) {
+		l.purge(cfg, now)
+	}
+
+	sh := &l.shards[uint64(fp)%shardCount]
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if s, ok := sh.series[fp]; ok {
+		s.lastSeen = now
+		return None
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	switch {
+	case cfg.MaxSeries > 0 && l.active >= cfg.MaxSeries:
+		return Global
+	case cfg.MaxSeriesPerMetric > 0 && l.perMetric[metric] >= cfg.MaxSeriesPerMetric:
+		return Metric
+	case cfg.MaxSeriesPerPrefix > 0 && l.perPrefix[prefix] >= cfg.MaxSeriesPerPrefix:
+		return Prefix
+	}
+	sh.series[fp] = &series{metric: metric, prefix: prefix, lastSeen: now}
+	l.active++
+	l.perMetric[metric]++
+	l.perPrefix[prefix]++
+	return None
+}
+
+// Active returns the number of active series.
+func (l *Limiter) Active() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.active
+}
+
+// purge forgets the series without samples within the window, one shard at a time.
+func (l *Limiter) purge(cfg *config.LimitsConfig, now time.Time) {
+	var expired []*series
+	for i := range l.shards {
+		sh := &l.shards[i]
+		sh.mu.Lock()
+		expired = expired[:0]
+		for fp, s := range sh.series {
+			if now.Sub(s.lastSeen) < cfg.Window {
+				continue
+			}
+			delete(sh.series, fp)
+			expired = append(expired, s)
+		}
+		if len(expired) > 0 {
+			l.release(expired)
+		}
+		sh.mu.Unlock()
+	}
+}
+
+// release frees the budgets used by series.
+func (l *Limiter) release(series []*series) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, s := range series {
+		l.active--
+		if l.perMetric[s.metric]--; l.perMetric[s.metric] == 0 {
+			delete(l.perMetric, s.metric)
+		}
+		if l.perPrefix[s.prefix]--; l.perPrefix[s.prefix] == 0 {
+			delete(l.perPrefix, s.prefix)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2024-2025 NetCracker Technology Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package limiter
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/config"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdmit(t *testing.T) {
+	cfg := config.DefaultLimitsConfig
+	cfg.MaxSeries = 5
+	cfg.MaxSeriesPerMetric = 3
+	cfg.MaxSeriesPerPrefix = 4
+	l := New(&cfg)
+	now := time.Unix(1700000000, 0)
+
+	require.Equal(t, None, l.Admit(1, "a", "app1", now))
+	require.Equal(t, None, l.Admit(2, "a", "app1", now))
+	require.Equal(t, None, l.Admit(3, "a", "app1", now))
+	require.Equal(t, Metric, l.Admit(4, "a", "app1", now))
+	require.Equal(t, None, l.Admit(4, "b", "app1", now))
+	require.Equal(t, Prefix, l.Admit(5, "c", "app1", now))
+	require.Equal(t, None, l.Admit(5, "c", "app2", now))
+	require.Equal(t, Global, l.Admit(6, "d", "app3", now))
+	require.Equal(t, 5, l.Active())
+
+	// Active series keep flowing.
+	for fp := model.Fingerprint(1); fp <= 5; fp++ {
+		require.Equal(t, None, l.Admit(fp, "", "", now))
+	}
+}
+
+func TestAdmitWindow(t *testing.T) {
+	cfg := config.DefaultLimitsConfig
+	cfg.MaxSeriesPerMetric = 2
+	cfg.Window = time.Minute
+	l := New(&cfg)
+	now := time.Unix(1700000000, 0)
+
+	require.Equal(t, None, l.Admit(1, "a", "", now))
+	require.Equal(t, None, l.Admit(2, "a", "", now))
+	require.Equal(t, Metric, l.Admit(3, "a", "", now))
+
+	// Series 2 receives samples within the window, series 1 does not.
+	require.Equal(t, None, l.Admit(2, "a", "", now.Add(30*time.Second)))
+	require.Equal(t, Metric, l.Admit(3, "a", "", now.Add(55*time.Second)))
+	require.Equal(t, None, l.Admit(3, "a", "", now.Add(61*time.Second)))
+	require.Equal(t, 2, l.Active())
+	require.Equal(t, Metric, l.Admit(1, "a", "", now.Add(62*time.Second)))
+
+	// All series expire.
+	require.Equal(t, None, l.Admit(4, "b", "", now.Add(10*time.Minute)))
+	require.Equal(t, 1, l.Active())
+	require.Equal(t, map[string]int{"b": 1}, l.perMetric)
+}
+
+func TestSetConfig(t *testing.T) {
+	cfg := config.DefaultLimitsConfig
+	cfg.MaxSeries = 2
+	l := New(&cfg)
+	now := time.Unix(1700000000, 0)
+
+	require.Equal(t, None, l.Admit(1, "a", "", now))
+	require.Equal(t, None, l.Admit(2, "a", "", now))
+
+	// Active series are kept and still admitted, new ones are checked against the new budgets.
+	reloaded := cfg
+	reloaded.MaxSeries = 1
+	l.SetConfig(&reloaded)
+	require.Equal(t, 2, l.Active())
+	require.Equal(t, None, l.Admit(2, "a", "", now))
+	require.Equal(t, Global, l.Admit(3, "a", "", now))
+}
+
+func TestAdmitConcurrent(t *testing.T) {
+	cfg := config.DefaultLimitsConfig
+	cfg.MaxSeries = 100
+	cfg.MaxSeriesPerMetric = 60
+	l := New(&cfg)
+	now := time.Unix(1700000000, 0)
+
+	// Budgets are shared by the series of all the shards.
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				fp := model.Fingerprint(w*100 + i)
+				l.Admit(fp, []string{"a", "b"}[i%2], "", now.Add(time.Duration(i)*time.Second))
+			}
+		}(w)
+	}
+	wg.Wait()
+	require.Equal(t, 100, l.Active())
+	require.LessOrEqual(t, l.perMetric["a"], 60)
+	require.LessOrEqual(t, l.perMetric["b"], 60)
+	require.Equal(t, 100, l.perMetric["a"]+l.perMetric["b"])
+}
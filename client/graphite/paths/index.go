@@ -0,0 +1,101 @@
+// Copyright 2024-2025 NetCracker Technology Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package paths
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+// maxIndexLine is the maximum length of the lines of an index file.
+const maxIndexLine = 1 << 20
+
+// Index records the original values of shortened nodes, in a file of JSON lines appended to.
+type Index struct {
+	mu   sync.Mutex
+	file *os.File
+	// Shortened nodes already recorded.
+	recorded map[string]struct{}
+
+	logger log.Logger
+}
+
+// IndexEntry is a line of an index file.
+type IndexEntry struct {
+	Metric string `json:"metric"`
+	// Shortened node and its original value, escaped like in paths.
+	Node     string `json:"node"`
+	Original string `json:"original"`
+}
+
+// OpenIndex opens an index file, created if it does not exist, and loads the nodes already recorded.
+func OpenIndex(name string, logger log.Logger) (*Index, error) {
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	idx := &Index{file: f, recorded: make(map[string]struct{}), logger: logger}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, maxIndexLine)
+	for scanner.Scan() {
+		var e IndexEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		idx.recorded[e.Node] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	_ = level.Info(logger).Log("file", name, "nodes", len(idx.recorded), "msg", "Paths index opened")
+	return idx, nil
+}
+
+// record appends a shortened node to the index, unless it is already recorded.
+func (idx *Index) record(metric string, node, original []byte) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if _, ok := idx.recorded[string(node)]; ok || idx.file == nil {
+		return
+	}
+	line, err := json.Marshal(IndexEntry{Metric: metric, Node: string(node), Original: string(original)})
+	if err == nil {
+		_, err = idx.file.Write(append(line, '\n'))
+	}
+	if err != nil {
+		_ = level.Warn(idx.logger).Log("err", err, "node", string(node), "msg", "Failed to record shortened node in paths index")
+		return
+	}
+	idx.recorded[string(node)] = struct{}{}
+}
+
+// Close closes the index file. Nodes are no longer recorded once it is closed.
+func (idx *Index) Close() error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if idx.file == nil {
+		return nil
+	}
+	err := idx.file.Close()
+	idx.file = nil
+	return err
+}
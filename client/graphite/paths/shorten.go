@@ -0,0 +1,258 @@
+// Copyright 2024-2025 NetCracker Technology Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package paths
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"hash/fnv"
+	"sort"
+	"sync"
+
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/common/model"
+)
+
+// Shortened nodes are made of their first bytes, followed by hashSeparator and the hashLen hexadecimal
+// digits of the FNV-1a hash of their original value.
+const (
+	hashSeparator = '_'
+	hashLen       = 16
+	// Length of a node shortened to its hash alone.
+	hashedLen = hashLen + 1
+)
+
+var (
+	shortenedNodes = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "remote_adapter_graphite",
+			Name:      "shortened_nodes_total",
+			Help:      "Total number of distinct nodes of paths shortened to their length limits, by metric name.",
+		},
+		[]string{"metric"},
+	)
+	tooLongPaths = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "remote_adapter_graphite",
+			Name:      "too_long_paths_total",
+			Help:      "Total number of paths dropped as they exceed the maximum path length once shortened, by metric name.",
+		},
+		[]string{"metric"},
+	)
+)
+
+// Limits shortens the paths built to length limits.
+type Limits struct {
+	cfg   *config.PathLimitsConfig
+	index *Index
+
+	mu sync.Mutex
+	// Shortened nodes already counted, so that a node is counted once however often its paths are built.
+	counted map[string]struct{}
+}
+
+// NewLimits returns the length limits of paths, nil when cfg is nil and paths are not limited. The original
+// values of shortened nodes are recorded in index, if not nil.
+func NewLimits(cfg *config.PathLimitsConfig, index *Index) *Limits {
+	if cfg == nil {
+		return nil
+	}
+	return &Limits{cfg: cfg, index: index, counted: map[string]struct{}{}}
+}
+
+// node is the span of a node in a path.
+type node struct {
+	start, end int
+}
+
+// Paths shortens the nodes of the paths of a metric over the maximum node length, then the longest
+// nodes of the paths still over the maximum path length. Paths which cannot be shortened enough are dropped.
+// Paths are returned as is when l is nil.
+func (l *Limits) Paths(m model.Metric, paths [][]byte, format Format) [][]byte {
+	if l == nil {
+		return paths
+	}
+	n := 0
+	for _, path := range paths {
+		if path, ok := l.limitPath(m, path, format); ok {
+			paths[n] = path
+			n++
+		}
+	}
+	return paths[:n]
+}
+
+func (l *Limits) limitPath(m model.Metric, path []byte, format Format) ([]byte, bool) {
+	maxNode, maxPath := l.cfg.MaxNodeLength, l.cfg.MaxPathLength
+	if (maxNode == 0 || len(path) <= maxNode) && (maxPath == 0 || len(path) <= maxPath) {
+		return path, true
+	}
+
+	nodes := pathNodes(path, format)
+	// Lengths the nodes are shortened to.
+	lengths := make([]int, len(nodes))
+	length := len(path)
+	for i, n := range nodes {
+		lengths[i] = n.end - n.start
+		if maxNode > 0 && lengths[i] > maxNode {
+			length -= lengths[i] - maxNode
+			lengths[i] = maxNode
+		}
+	}
+	if maxPath > 0 && length > maxPath {
+		order := make([]int, len(nodes))
+		for i := range order {
+			order[i] = i
+		}
+		sort.SliceStable(order, func(a, b int) bool { return lengths[order[a]] > lengths[order[b]] })
+		for _, i := range order {
+			if length <= maxPath || lengths[i] <= hashedLen {
+				break
+			}
+			reduced := max(hashedLen, lengths[i]-(length-maxPath))
+			length -= lengths[i] - reduced
+			lengths[i] = reduced
+		}
+		if length > maxPath {
+			tooLongPaths.WithLabelValues(string(m[model.MetricNameLabel])).Inc()
+			return nil, false
+		}
+	}
+	if length == len(path) {
+		return path, true
+	}
+
+	name := string(m[model.MetricNameLabel])
+	shortened := make([]byte, 0, length)
+	prev := 0
+	for i, n := range nodes {
+		original := path[n.start:n.end]
+		if lengths[i] == len(original) {
+			continue
+		}
+		shortened = append(shortened, path[prev:n.start]...)
+		start := len(shortened)
+		shortened = appendShortNode(shortened, original, lengths[i])
+		prev = n.end
+		l.count(name, shortened[start:])
+		if l.index != nil {
+			l.index.record(name, shortened[start:], original)
+		}
+	}
+	return append(shortened, path[prev:]...), true
+}
+
+// count counts a shortened node of a metric the first time it is built.
+func (l *Limits) count(metric string, node []byte) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.counted[string(node)]; ok {
+		return
+	}
+	l.counted[string(node)] = struct{}{}
+	shortenedNodes.WithLabelValues(metric).Inc()
+}
+
+// appendShortNode appends a node shortened to at most length bytes. Escape sequences are not split.
+func appendShortNode(dst, original []byte, length int) []byte {
+	keep := 0
+	for keep < len(original) {
+		unit := 1
+		switch original[keep] {
+		case '%':
+			unit = 3
+		case '\\':
+			unit = 2
+		}
+		if keep+unit > length-hashedLen {
+			break
+		}
+		keep += unit
+	}
+	h := fnv.New64a()
+	_, _ = h.Write(original)
+	var sum [8]byte
+	binary.BigEndian.PutUint64(sum[:], h.Sum64())
+	dst = append(append(dst, original[:keep]...), hashSeparator)
+	return append(dst, hex.EncodeToString(sum[:])...)
+}
+
+// NameEnd returns the end of the name of a path: the first semicolon in the carbon tags format,
+// or the first unescaped brace in the carbon OpenMetrics format.
+func NameEnd(path []byte, format Format) int {
+	switch format {
+	case FormatCarbonTags:
+		if i := bytes.IndexByte(path, ';'); i >= 0 {
+			return i
+		}
+	case FormatCarbonOpenMetrics:
+		for i := 0; i < len(path); i++ {
+			if path[i] == '\\' {
+				i++
+			} else if path[i] == '{' {
+				return i
+			}
+		}
+	}
+	return len(path)
+}
+
+// pathNodes returns the nodes of a path: the nodes of its name separated by dots, and the values
+// of its tags or labels in the tagged formats.
+func pathNodes(path []byte, format Format) []node {
+	nameEnd := NameEnd(path, format)
+	var nodes []node
+	start := 0
+	for i := 0; i <= nameEnd; i++ {
+		if i == nameEnd || path[i] == '.' {
+			nodes = append(nodes, node{start, i})
+			start = i + 1
+		}
+	}
+
+	switch format {
+	case FormatCarbonTags:
+		// Tags are name=value pairs, each after a semicolon.
+		for i := nameEnd; i < len(path); {
+			end := len(path)
+			if j := bytes.IndexByte(path[i+1:], ';'); j >= 0 {
+				end = i + 1 + j
+			}
+			if j := bytes.IndexByte(path[i+1:end], '='); j >= 0 {
+				nodes = append(nodes, node{i + 2 + j, end})
+			}
+			i = end
+		}
+	case FormatCarbonOpenMetrics:
+		// Labels are name="value" pairs between braces, with quotes escaped in values.
+		for i := nameEnd + 1; i < len(path); i++ {
+			if path[i] != '"' {
+				continue
+			}
+			start := i + 1
+			for i = start; i < len(path) && path[i] != '"'; i++ {
+				if path[i] == '\\' {
+					i++
+				}
+			}
+			nodes = append(nodes, node{start, min(i, len(path))})
+		}
+	}
+	return nodes
+}
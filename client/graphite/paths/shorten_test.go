@@ -0,0 +1,152 @@
+// Copyright 2024-2025 NetCracker Technology Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package paths
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/config"
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/metadata"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+)
+
+func shortNode(prefix, original string) string {
+	h := fnv.New64a()
+	h.Write([]byte(original))
+	return fmt.Sprintf("%s_%016x", prefix, h.Sum64())
+}
+
+func TestShortenNodes(t *testing.T) {
+	limits := NewLimits(&config.PathLimitsConfig{MaxNodeLength: 30}, nil)
+	long := strings.Repeat("a", 12) + "/bcdefghijklmnopqrstuvwxyz"
+	m := model.Metric{model.MetricNameLabel: "test:metric", "owner": "team-X", "path": model.LabelValue(long)}
+	escaped := strings.Repeat("a", 12) + "%2Fbcdefghijklmnopqrstuvwxyz"
+	before := testutil.ToFloat64(shortenedNodes.WithLabelValues("test:metric"))
+
+	actual, err := pathsFromMetric(m, metadata.Metadata{}, FormatCarbon, "prefix.", nil, nil, limits)
+	require.NoError(t, err)
+	// The escaped slash is not split.
+	require.Equal(t, "prefix.test:metric.owner.team-X.path."+shortNode(strings.Repeat("a", 12), escaped), string(actual[0]))
+
+	actual, err = pathsFromMetric(m, metadata.Metadata{}, FormatCarbonTags, "prefix.", nil, nil, limits)
+	require.NoError(t, err)
+	// Slashes are not escaped in tags.
+	require.Equal(t, "prefix.test:metric;owner=team-X;path="+shortNode(long[:13], long), string(actual[0]))
+
+	actual, err = pathsFromMetric(m, metadata.Metadata{}, FormatCarbonOpenMetrics, "prefix.", nil, nil, limits)
+	require.NoError(t, err)
+	require.Equal(t, "prefix.test:metric{owner=\"team-X\",path=\""+shortNode(strings.Repeat("a", 12), escaped)+"\"}", string(actual[0]))
+
+	// Shortened nodes are counted once, the node shortened in the carbon and OpenMetrics formats is the same.
+	_, err = pathsFromMetric(m, metadata.Metadata{}, FormatCarbon, "prefix.", nil, nil, limits)
+	require.NoError(t, err)
+	require.Equal(t, before+2, testutil.ToFloat64(shortenedNodes.WithLabelValues("test:metric")))
+
+	// Escaped quotes do not end label values.
+	escaped = "abc!ABC:012-3!45%C3%B667~89%2E%2F\\(\\)\\{\\}\\,%3D%2E\\\"\\\\"
+	actual, err = pathsFromMetric(metric, metadata.Metadata{}, FormatCarbonOpenMetrics, "prefix.", nil, nil, limits)
+	require.NoError(t, err)
+	require.Equal(t, "prefix.test:metric{many_chars=\""+shortNode("abc!ABC:012-3", escaped)+"\",owner=\"team-X\",testlabel=\"test:value\"}", string(actual[0]))
+}
+
+func TestShortenPaths(t *testing.T) {
+	limits := NewLimits(&config.PathLimitsConfig{MaxPathLength: 60}, nil)
+	a, b := strings.Repeat("a", 40), strings.Repeat("b", 30)
+	m := model.Metric{model.MetricNameLabel: "m", "a": model.LabelValue(a), "b": model.LabelValue(b)}
+
+	// The longest node is shortened first.
+	actual, err := pathsFromMetric(m, metadata.Metadata{}, FormatCarbon, "", nil, nil, limits)
+	require.NoError(t, err)
+	require.Equal(t, "m.a."+shortNode(strings.Repeat("a", 6), a)+".b."+b, string(actual[0]))
+	require.Len(t, actual[0], 60)
+
+	// Then the next ones, down to their hash.
+	limits = NewLimits(&config.PathLimitsConfig{MaxPathLength: 41}, nil)
+	actual, err = pathsFromMetric(m, metadata.Metadata{}, FormatCarbon, "", nil, nil, limits)
+	require.NoError(t, err)
+	require.Equal(t, "m.a."+shortNode("", a)+".b."+shortNode("", b), string(actual[0]))
+
+	// Paths that cannot be shortened enough are dropped.
+	limits = NewLimits(&config.PathLimitsConfig{MaxPathLength: 20}, nil)
+	before := testutil.ToFloat64(tooLongPaths.WithLabelValues("m"))
+	actual, err = pathsFromMetric(m, metadata.Metadata{}, FormatCarbon, "", nil, nil, limits)
+	require.NoError(t, err)
+	require.Empty(t, actual)
+	require.Equal(t, before+1, testutil.ToFloat64(tooLongPaths.WithLabelValues("m")))
+}
+
+func TestIndex(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "index.jsonl")
+	index, err := OpenIndex(file, log.NewNopLogger())
+	require.NoError(t, err)
+	limits := NewLimits(&config.PathLimitsConfig{MaxNodeLength: 24}, index)
+
+	long := strings.Repeat("x", 30)
+	m := model.Metric{model.MetricNameLabel: "m", "l": model.LabelValue(long)}
+	for i := 0; i < 2; i++ {
+		_, err = pathsFromMetric(m, metadata.Metadata{}, FormatCarbon, "", nil, nil, limits)
+		require.NoError(t, err)
+	}
+	require.NoError(t, index.Close())
+
+	// Nodes already recorded are not recorded again once the index is reopened.
+	index, err = OpenIndex(file, log.NewNopLogger())
+	require.NoError(t, err)
+	limits = NewLimits(&config.PathLimitsConfig{MaxNodeLength: 24}, index)
+	_, err = pathsFromMetric(m, metadata.Metadata{}, FormatCarbonTags, "", nil, nil, limits)
+	require.NoError(t, err)
+	require.NoError(t, index.Close())
+
+	f, err := os.Open(file)
+	require.NoError(t, err)
+	defer f.Close()
+	var entries []IndexEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e IndexEntry
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &e))
+		entries = append(entries, e)
+	}
+	require.Equal(t, []IndexEntry{{Metric: "m", Node: shortNode("xxxxxxx", long), Original: long}}, entries)
+}
+
+func TestIndexClose(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "index.jsonl")
+	index, err := OpenIndex(file, log.NewNopLogger())
+	require.NoError(t, err)
+	limits := NewLimits(&config.PathLimitsConfig{MaxNodeLength: 24}, index)
+
+	// Closing twice is not an error, and nodes shortened once the index is closed are not recorded.
+	require.NoError(t, index.Close())
+	require.NoError(t, index.Close())
+	m := model.Metric{model.MetricNameLabel: "m", "l": model.LabelValue(strings.Repeat("x", 30))}
+	actual, err := pathsFromMetric(m, metadata.Metadata{}, FormatCarbon, "", nil, nil, limits)
+	require.NoError(t, err)
+	require.Len(t, actual, 1)
+	info, err := os.Stat(file)
+	require.NoError(t, err)
+	require.Zero(t, info.Size())
+}
@@ -16,11 +16,14 @@
 package paths
 
 import (
+	"slices"
+
 	"github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/config"
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/metadata"
 	"github.com/prometheus/common/model"
 )
 
-func loadContext(templateData map[string]interface{}, m model.Metric) map[string]interface{} {
+func loadContext(templateData map[string]interface{}, m model.Metric, md metadata.Metadata) map[string]interface{} {
 	ctx := make(map[string]interface{})
 	for k, v := range templateData {
 		ctx[k] = v
@@ -30,6 +33,8 @@ func loadContext(templateData map[string]interface{}, m model.Metric) map[string
 		labels[string(ln)] = string(lv)
 	}
 	ctx["labels"] = labels
+	ctx["type"] = md.Type
+	ctx["unit"] = md.Unit
 	return ctx
 }
 
@@ -46,3 +51,8 @@ func match(m model.Metric, match config.LabelSet, matchRE config.LabelSetRE) boo
 	}
 	return true
 }
+
+// matchType tells whether a metric type is one of types, any type matching when there are none.
+func matchType(typ string, types []string) bool {
+	return len(types) == 0 || slices.Contains(types, typ)
+}
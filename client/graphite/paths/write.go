@@ -24,19 +24,33 @@ import (
 
 	"github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/config"
 	graphitetmpl "github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/template"
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/metadata"
 	"github.com/patrickmn/go-cache"
 	"github.com/prometheus/common/model"
 )
 
-// ToDatapoints builds points from samples.
-func ToDatapoints(s *model.Sample, format Format, prefix string, rules []*config.Rule, templateData map[string]interface{}) ([][]byte, error) {
-	t := float64(s.Timestamp.UnixNano()) / 1e9
+// ToPaths builds the graphite paths of a sample, leaving the encoding of its datapoints to the caller.
+func ToPaths(s *model.Sample, format Format, prefix string, rules []*config.Rule, templateData map[string]interface{}) ([][]byte, error) {
 	v := float64(s.Value)
 	if math.IsNaN(v) || math.IsInf(v, 0) {
 		return nil, errors.New("invalid sample value")
 	}
 
-	paths, err := pathsFromMetric(s.Metric, format, prefix, rules, templateData)
+	return pathsFromMetric(s.Metric, metadata.Metadata{}, format, prefix, rules, templateData, nil)
+}
+
+// MetricPaths builds the graphite paths of a metric, shared by all the samples of its time series.
+// The metadata of its family, if known, are matched by rules and available to their templates.
+// Paths are shortened to limits, if not nil.
+func MetricPaths(m model.Metric, md metadata.Metadata, format Format, prefix string, rules []*config.Rule, templateData map[string]interface{}, limits *Limits) ([][]byte, error) {
+	return pathsFromMetric(m, md, format, prefix, rules, templateData, limits)
+}
+
+// ToDatapoints builds points from samples.
+func ToDatapoints(s *model.Sample, format Format, prefix string, rules []*config.Rule, templateData map[string]interface{}) ([][]byte, error) {
+	t := float64(s.Timestamp.UnixNano()) / 1e9
+	v := float64(s.Value)
+	paths, err := ToPaths(s, format, prefix, rules, templateData)
 	if err != nil {
 		return nil, err
 	}
@@ -70,36 +84,56 @@ func ToDatapoints(s *model.Sample, format Format, prefix string, rules []*config
 	return dataPoints, nil
 }
 
-func pathsFromMetric(m model.Metric, format Format, prefix string, rules []*config.Rule, templateData map[string]interface{}) ([][]byte, error) {
+func pathsFromMetric(m model.Metric, md metadata.Metadata, format Format, prefix string, rules []*config.Rule, templateData map[string]interface{}, limits *Limits) ([][]byte, error) {
 	var fingerPrint string
 	if pathsCacheEnabled {
-		ffp := m.FastFingerprint()
-		//math.MaxUint64
-		buf := make([]byte, 0, 16)
-		fingerPrintBYtes := strconv.AppendUint(buf, uint64(ffp), 16)
-		fingerPrint = string(fingerPrintBYtes)
+		fingerPrint = cacheKey(m, md)
 		cachedPaths, cached := pathsCache.Get(fingerPrint)
 		if cached {
 			return cachedPaths.([][]byte), nil
 		}
 	}
-	paths, stop, err := templatedPaths(m, rules, templateData)
+	paths, stop, err := templatedPaths(m, md, rules, templateData)
 	// if it doesn't match any rule, use default path
 	if !stop {
 		paths = append(paths, defaultPath(m, format, prefix))
 	}
+	paths = limits.Paths(m, paths, format)
 	if pathsCacheEnabled {
 		pathsCache.Set(fingerPrint, paths, cache.DefaultExpiration)
 	}
 	return paths, err
 }
 
-func templatedPaths(m model.Metric, rules []*config.Rule, templateData map[string]interface{}) ([][]byte, bool, error) {
+// EvictMetricPaths removes the paths of a metric from the paths cache, once its series ended.
+func EvictMetricPaths(m model.Metric, md metadata.Metadata) {
+	if pathsCacheEnabled {
+		pathsCache.Delete(cacheKey(m, md))
+	}
+}
+
+// cacheKey returns the key of the paths of a metric in the paths cache.
+func cacheKey(m model.Metric, md metadata.Metadata) string {
+	ffp := m.FastFingerprint()
+	//math.MaxUint64
+	buf := make([]byte, 0, 16)
+	fingerPrintBYtes := strconv.AppendUint(buf, uint64(ffp), 16)
+	// Paths also depend on the metadata of the metric, which can be received after its samples.
+	if md.Type != "" || md.Unit != "" {
+		fingerPrintBYtes = append(append(append(append(fingerPrintBYtes, ';'), md.Type...), ';'), md.Unit...)
+	}
+	return string(fingerPrintBYtes)
+}
+
+func templatedPaths(m model.Metric, md metadata.Metadata, rules []*config.Rule, templateData map[string]interface{}) ([][]byte, bool, error) {
 	var paths [][]byte
 	var stop = false
 	var err error
+	if md.Type == "" {
+		md.Type = metadata.TypeUnknown
+	}
 	for _, rule := range rules {
-		ruleMatch := match(m, rule.Match, rule.MatchRE)
+		ruleMatch := match(m, rule.Match, rule.MatchRE) && matchType(md.Type, rule.MatchType)
 		if !ruleMatch {
 			continue
 		}
@@ -108,7 +142,7 @@ func templatedPaths(m model.Metric, rules []*config.Rule, templateData map[strin
 			return nil, true, nil
 		}
 
-		context := loadContext(templateData, m)
+		context := loadContext(templateData, m, md)
 		stop = !rule.Continue
 		var path bytes.Buffer
 		err = rule.Tmpl.Execute(&path, context)
@@ -17,8 +17,10 @@ package paths
 
 import (
 	"testing"
+	"time"
 
 	"github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/config"
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/metadata"
 	"github.com/prometheus/common/model"
 	"github.com/stretchr/testify/require"
 	"gopkg.in/yaml.v3"
@@ -79,7 +81,7 @@ func TestDefaultPathsFromMetric(t *testing.T) {
 		".many_chars.abc!ABC:012-3!45%C3%B667~89%2E%2F\\(\\)\\{\\}\\,%3D%2E\\\"\\\\" +
 		".owner.team-X" +
 		".testlabel.test:value"
-	actual, err := pathsFromMetric(metric, FormatCarbon, "prefix.", nil, nil)
+	actual, err := pathsFromMetric(metric, metadata.Metadata{}, FormatCarbon, "prefix.", nil, nil, nil)
 	require.Equal(t, expected, string(actual[0]))
 	require.Empty(t, err)
 
@@ -92,7 +94,7 @@ func TestDefaultPathsFromMetric(t *testing.T) {
 		";owner=team-X" +
 		";testlabel=test:value"
 
-	actual, err = pathsFromMetric(metric, FormatCarbonTags, "prefix.", nil, nil)
+	actual, err = pathsFromMetric(metric, metadata.Metadata{}, FormatCarbonTags, "prefix.", nil, nil, nil)
 	require.Equal(t, expected, string(actual[0]))
 	require.Empty(t, err)
 
@@ -102,7 +104,7 @@ func TestDefaultPathsFromMetric(t *testing.T) {
 		",owner=\"team-X\"" +
 		",testlabel=\"test:value\"" +
 		"}"
-	actual, err = pathsFromMetric(metric, FormatCarbonOpenMetrics, "prefix.", nil, nil)
+	actual, err = pathsFromMetric(metric, metadata.Metadata{}, FormatCarbonOpenMetrics, "prefix.", nil, nil, nil)
 	require.Equal(t, expected, string(actual[0]))
 	require.Empty(t, err)
 }
@@ -120,7 +122,7 @@ func TestUnmatchedMetricPathsFromMetric(t *testing.T) {
 		".owner.team-K"+
 		".testlabel.test:value"+
 		".testlabel2.test:value2"))
-	actual, err := pathsFromMetric(unmatchedMetric, FormatCarbon, "prefix.", testConfig.Write.Rules, testConfig.Write.TemplateData)
+	actual, err := pathsFromMetric(unmatchedMetric, metadata.Metadata{}, FormatCarbon, "prefix.", testConfig.Write.Rules, testConfig.Write.TemplateData, nil)
 	require.Equal(t, expected, actual)
 	require.Empty(t, err)
 }
@@ -128,7 +130,7 @@ func TestUnmatchedMetricPathsFromMetric(t *testing.T) {
 func TestTemplatedPathsFromMetric(t *testing.T) {
 	expected := make([][]byte, 0)
 	expected = append(expected, []byte("tmpl_3.team-Y.data.foo"))
-	actual, err := pathsFromMetric(metricY, FormatCarbon, "", testConfig.Write.Rules, testConfig.Write.TemplateData)
+	actual, err := pathsFromMetric(metricY, metadata.Metadata{}, FormatCarbon, "", testConfig.Write.Rules, testConfig.Write.TemplateData, nil)
 	require.Equal(t, expected, actual)
 	require.Empty(t, err)
 }
@@ -141,7 +143,7 @@ func TestTemplatedPathsFromMetricWithDefault(t *testing.T) {
 		".many_chars.abc!ABC:012-3!45%C3%B667~89%2E%2F\\(\\)\\{\\}\\,%3D%2E\\\"\\\\"+
 		".owner.team-X"+
 		".testlabel.test:value"))
-	actual, err := pathsFromMetric(metric, FormatCarbon, "prefix.", testConfig.Write.Rules, testConfig.Write.TemplateData)
+	actual, err := pathsFromMetric(metric, metadata.Metadata{}, FormatCarbon, "prefix.", testConfig.Write.Rules, testConfig.Write.TemplateData, nil)
 	require.Equal(t, expected, actual)
 	require.Empty(t, err)
 }
@@ -156,7 +158,7 @@ func TestMultiTemplatedPathsFromMetric(t *testing.T) {
 	expected := make([][]byte, 0)
 	expected = append(expected, []byte("tmpl_1.data%2Efoo.team-X"))
 	expected = append(expected, []byte("tmpl_2.team-X.data.foo"))
-	actual, err := pathsFromMetric(multiMatchMetric, FormatCarbon, "prefix.", testConfig.Write.Rules, testConfig.Write.TemplateData)
+	actual, err := pathsFromMetric(multiMatchMetric, metadata.Metadata{}, FormatCarbon, "prefix.", testConfig.Write.Rules, testConfig.Write.TemplateData, nil)
 	require.Equal(t, expected, actual)
 	require.Empty(t, err)
 }
@@ -169,7 +171,7 @@ func TestSkipedTemplatedPathsFromMetric(t *testing.T) {
 		"testlabel2":          "test:value2",
 	}
 	t.Log(testConfig.Write.Rules[2])
-	actual, err := pathsFromMetric(skipedMetric, FormatCarbon, "", testConfig.Write.Rules, testConfig.Write.TemplateData)
+	actual, err := pathsFromMetric(skipedMetric, metadata.Metadata{}, FormatCarbon, "", testConfig.Write.Rules, testConfig.Write.TemplateData, nil)
 	require.Empty(t, actual)
 	require.Empty(t, err)
 }
@@ -186,7 +188,55 @@ write:
 	testConfigNilLabel := loadTestConfig(testConfigNilLabelStr)
 
 	t.Log(testConfigNilLabel.Write.Rules[0])
-	actual, err := pathsFromMetric(metric, FormatCarbon, "", testConfigNilLabel.Write.Rules, testConfigNilLabel.Write.TemplateData)
+	actual, err := pathsFromMetric(metric, metadata.Metadata{}, FormatCarbon, "", testConfigNilLabel.Write.Rules, testConfigNilLabel.Write.TemplateData, nil)
 	require.Empty(t, actual)
 	require.Error(t, err)
 }
+
+func TestTypedPathsFromMetric(t *testing.T) {
+	testConfigTypedStr := `
+write:
+  rules:
+  - match_type: [counter]
+    template: 'counters.{{.labels.__name__}}.{{.unit}}.rate'
+    continue: false
+  - match_type: [gauge, unknown]
+    template: '{{.type}}.{{.labels.__name__}}'
+    continue: false`
+
+	testConfigTyped := loadTestConfig(testConfigTypedStr)
+	m := model.Metric{model.MetricNameLabel: "requests"}
+
+	actual, err := pathsFromMetric(m, metadata.Metadata{Type: metadata.TypeCounter, Unit: "seconds"}, FormatCarbon, "", testConfigTyped.Write.Rules, nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte("counters.requests.seconds.rate")}, actual)
+
+	actual, err = pathsFromMetric(m, metadata.Metadata{Type: metadata.TypeGauge}, FormatCarbon, "", testConfigTyped.Write.Rules, nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte("gauge.requests")}, actual)
+
+	actual, err = pathsFromMetric(m, metadata.Metadata{}, FormatCarbon, "", testConfigTyped.Write.Rules, nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte("unknown.requests")}, actual)
+
+	actual, err = pathsFromMetric(m, metadata.Metadata{Type: metadata.TypeSummary}, FormatCarbon, "prefix.", testConfigTyped.Write.Rules, nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte("prefix.requests")}, actual)
+
+	require.Nil(t, loadTestConfig("write:\n  rules:\n  - match_type: [timer]\n"))
+}
+
+func TestEvictMetricPaths(t *testing.T) {
+	InitPathsCache(time.Minute, time.Minute)
+	t.Cleanup(func() { pathsCacheEnabled = false })
+
+	md := metadata.Metadata{Type: metadata.TypeGauge}
+	_, err := pathsFromMetric(metric, md, FormatCarbon, "", nil, nil, nil)
+	require.NoError(t, err)
+	_, cached := pathsCache.Get(cacheKey(metric, md))
+	require.True(t, cached)
+
+	EvictMetricPaths(metric, md)
+	_, cached = pathsCache.Get(cacheKey(metric, md))
+	require.False(t, cached)
+}
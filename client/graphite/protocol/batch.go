@@ -0,0 +1,69 @@
+// Copyright 2024-2025 NetCracker Technology Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package protocol encodes batches of datapoints in the carbon ingest protocols.
+//
+// Datapoints are kept in batches with a compact binary layout until they are sent,
+// so that they can be routed, spooled and replayed without being formatted or parsed.
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// ErrCorruptBatch is returned when a batch cannot be decoded.
+var ErrCorruptBatch = errors.New("corrupt datapoints batch")
+
+// Datapoint is a single value of a Graphite path.
+type Datapoint struct {
+	Path  []byte
+	Value float64
+	// Timestamp in milliseconds since epoch.
+	Timestamp int64
+}
+
+// WriteDatapoint appends a datapoint to a batch.
+func WriteDatapoint(batch *bytes.Buffer, path []byte, value float64, timestamp int64) {
+	var buf [binary.MaxVarintLen64 + 8]byte
+	n := binary.PutUvarint(buf[:], uint64(len(path)))
+	batch.Write(buf[:n])
+	batch.Write(path)
+	binary.BigEndian.PutUint64(buf[:8], math.Float64bits(value))
+	n = binary.PutVarint(buf[8:], timestamp)
+	batch.Write(buf[:8+n])
+}
+
+// ReadDatapoint decodes the first datapoint of a batch and returns the rest of the batch.
+// The path of the datapoint references the batch.
+func ReadDatapoint(batch []byte) (Datapoint, []byte, error) {
+	var dp Datapoint
+	pathLen, n := binary.Uvarint(batch)
+	if n <= 0 || uint64(len(batch)-n) < pathLen+8 {
+		return dp, nil, ErrCorruptBatch
+	}
+	batch = batch[n:]
+	dp.Path = batch[:pathLen:pathLen]
+	batch = batch[pathLen:]
+	dp.Value = math.Float64frombits(binary.BigEndian.Uint64(batch))
+	batch = batch[8:]
+	dp.Timestamp, n = binary.Varint(batch)
+	if n <= 0 {
+		return dp, nil, ErrCorruptBatch
+	}
+	return dp, batch[n:], nil
+}
@@ -0,0 +1,105 @@
+// Copyright 2024-2025 NetCracker Technology Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package protocol
+
+import (
+	"encoding/binary"
+	"math"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// carbonpbMaxMessageSize is the size above which a new carbonpb message is started.
+// It keeps messages well below the default 64MB limit of go-carbon.
+const carbonpbMaxMessageSize = 1 << 20
+
+// carbonpbEncoder encodes batches as carbonpb Payload messages, the protobuf format
+// of go-carbon and carbon-clickhouse:
+//
+//	message Point { uint32 timestamp = 1; double value = 2; }
+//	message Metric { string metric = 1; repeated Point points = 2; }
+//	message Payload { repeated Metric metrics = 1; }
+//
+// Points of the same path in a message are grouped in a single Metric.
+// Framed messages are prefixed with their length, as in the pickle protocol.
+type carbonpbEncoder struct {
+	framed bool
+}
+
+type carbonpbMetric struct {
+	path   []byte
+	points []Datapoint
+	size   int
+}
+
+func (e carbonpbEncoder) Encode(dst []byte, batch []byte) ([]byte, error) {
+	var metrics []*carbonpbMetric
+	index := make(map[string]*carbonpbMetric)
+	for len(batch) > 0 {
+		metrics = metrics[:0]
+		clear(index)
+		size := 0
+		for (!e.framed || size < carbonpbMaxMessageSize) && len(batch) > 0 {
+			dp, rest, err := ReadDatapoint(batch)
+			if err != nil {
+				return dst, err
+			}
+			batch = rest
+
+			m, ok := index[string(dp.Path)]
+			if !ok {
+				m = &carbonpbMetric{path: dp.Path}
+				m.size = protowire.SizeTag(1) + protowire.SizeBytes(len(dp.Path))
+				index[string(dp.Path)] = m
+				metrics = append(metrics, m)
+				size += protowire.SizeTag(1) + protowire.SizeBytes(m.size)
+			}
+			m.points = append(m.points, dp)
+			pointSize := protowire.SizeTag(2) + protowire.SizeBytes(carbonpbPointSize(dp))
+			size += pointSize + protowire.SizeVarint(uint64(m.size+pointSize)) - protowire.SizeVarint(uint64(m.size))
+			m.size += pointSize
+		}
+
+		if e.framed {
+			dst = binary.BigEndian.AppendUint32(dst, uint32(size))
+		}
+		for _, m := range metrics {
+			dst = protowire.AppendTag(dst, 1, protowire.BytesType)
+			dst = protowire.AppendVarint(dst, uint64(m.size))
+			dst = protowire.AppendTag(dst, 1, protowire.BytesType)
+			dst = protowire.AppendBytes(dst, m.path)
+			for _, dp := range m.points {
+				dst = protowire.AppendTag(dst, 2, protowire.BytesType)
+				dst = protowire.AppendVarint(dst, uint64(carbonpbPointSize(dp)))
+				dst = protowire.AppendTag(dst, 1, protowire.VarintType)
+				dst = protowire.AppendVarint(dst, uint64(carbonpbTimestamp(dp)))
+				dst = protowire.AppendTag(dst, 2, protowire.Fixed64Type)
+				dst = protowire.AppendFixed64(dst, math.Float64bits(dp.Value))
+			}
+		}
+	}
+	return dst, nil
+}
+
+func carbonpbPointSize(dp Datapoint) int {
+	return protowire.SizeTag(1) + protowire.SizeVarint(uint64(carbonpbTimestamp(dp))) +
+		protowire.SizeTag(2) + protowire.SizeFixed64()
+}
+
+// carbonpbTimestamp returns the timestamp of a datapoint in seconds, rounded as in the plaintext protocol.
+func carbonpbTimestamp(dp Datapoint) uint32 {
+	return uint32(math.RoundToEven(float64(dp.Timestamp*1e6) / 1e9))
+}
@@ -0,0 +1,124 @@
+// Copyright 2024-2025 NetCracker Technology Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/config"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type carbonpbPoint struct {
+	timestamp uint32
+	value     float64
+}
+
+// decodeCarbonPB decodes a carbonpb Payload into the points of each metric.
+func decodeCarbonPB(t *testing.T, payload []byte) map[string][]carbonpbPoint {
+	metrics := make(map[string][]carbonpbPoint)
+	for len(payload) > 0 {
+		num, typ, n := protowire.ConsumeTag(payload)
+		require.Equal(t, protowire.Number(1), num)
+		require.Equal(t, protowire.BytesType, typ)
+		metric, m := protowire.ConsumeBytes(payload[n:])
+		require.Positive(t, m)
+		payload = payload[n+m:]
+
+		var path string
+		for len(metric) > 0 {
+			num, _, n = protowire.ConsumeTag(metric)
+			field, m := protowire.ConsumeBytes(metric[n:])
+			require.Positive(t, m)
+			metric = metric[n+m:]
+			if num == 1 {
+				path = string(field)
+				continue
+			}
+			var point carbonpbPoint
+			for len(field) > 0 {
+				num, _, n = protowire.ConsumeTag(field)
+				if num == 1 {
+					v, m := protowire.ConsumeVarint(field[n:])
+					point.timestamp = uint32(v)
+					field = field[n+m:]
+				} else {
+					v, m := protowire.ConsumeFixed64(field[n:])
+					point.value = math.Float64frombits(v)
+					field = field[n+m:]
+				}
+			}
+			metrics[path] = append(metrics[path], point)
+		}
+	}
+	return metrics
+}
+
+func TestCarbonPBEncoder(t *testing.T) {
+	var batch bytes.Buffer
+	WriteDatapoint(&batch, []byte("a.b"), 1.5, 1600000000000)
+	WriteDatapoint(&batch, []byte("c;tag=value"), -2, 1600000000000)
+	WriteDatapoint(&batch, []byte("a.b"), 3, 1600000060000)
+
+	out, err := NewEncoder(config.ProtocolCarbonPB, config.PrecisionSeconds).Encode(nil, batch.Bytes())
+	require.NoError(t, err)
+
+	length := binary.BigEndian.Uint32(out)
+	require.Equal(t, int(length)+4, len(out))
+	require.Equal(t, map[string][]carbonpbPoint{
+		"a.b":         {{1600000000, 1.5}, {1600000060, 3}},
+		"c;tag=value": {{1600000000, -2}},
+	}, decodeCarbonPB(t, out[4:]))
+}
+
+func TestCarbonPBEncoderSplitsMessages(t *testing.T) {
+	var batch bytes.Buffer
+	for i := 0; i < 2000; i++ {
+		WriteDatapoint(&batch, []byte(fmt.Sprintf("%0999d", i)), float64(i), 1600000000000)
+	}
+
+	out, err := NewEncoder(config.ProtocolCarbonPB, config.PrecisionSeconds).Encode(nil, batch.Bytes())
+	require.NoError(t, err)
+
+	var messages, points int
+	for len(out) > 0 {
+		length := binary.BigEndian.Uint32(out)
+		require.LessOrEqual(t, int(length)+4, len(out))
+		for _, p := range decodeCarbonPB(t, out[4:4+length]) {
+			points += len(p)
+		}
+		out = out[4+length:]
+		messages++
+	}
+	require.Equal(t, 2, messages)
+	require.Equal(t, 2000, points)
+}
+
+func TestCarbonPBMessageEncoder(t *testing.T) {
+	var batch bytes.Buffer
+	for i := 0; i < 2000; i++ {
+		WriteDatapoint(&batch, []byte(fmt.Sprintf("%0999d", i)), float64(i), 1600000000000)
+	}
+
+	out, err := NewMessageEncoder(config.ProtocolCarbonPB, config.PrecisionSeconds).Encode(nil, batch.Bytes())
+	require.NoError(t, err)
+	require.Len(t, decodeCarbonPB(t, out), 2000)
+}
@@ -0,0 +1,98 @@
+// Copyright 2024-2025 NetCracker Technology Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package protocol
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/config"
+)
+
+// pickleMaxDatapoints is the number of datapoints per pickle message, as sent by carbon-relay.
+// It keeps messages well below the 1MB limit of the carbon pickle receiver.
+const pickleMaxDatapoints = 500
+
+// Opcodes of the pickle protocol 2.
+const (
+	pickleProto      = 0x80
+	pickleEmptyList  = ']'
+	pickleMark       = '('
+	pickleAppends    = 'e'
+	pickleBinUnicode = 'X'
+	pickleBinInt     = 'J'
+	pickleBinFloat   = 'G'
+	pickleTuple2     = 0x86
+	pickleStop       = '.'
+)
+
+// pickleEncoder encodes batches as pickled lists of (path, (timestamp, value)) tuples,
+// the format of the carbon pickle receiver. Framed messages are prefixed with their length.
+type pickleEncoder struct {
+	framed    bool
+	precision config.TimestampPrecision
+}
+
+func (e pickleEncoder) Encode(dst []byte, batch []byte) ([]byte, error) {
+	for len(batch) > 0 {
+		start := len(dst)
+		if e.framed {
+			// Length of the message, set once it is encoded.
+			dst = append(dst, 0, 0, 0, 0)
+		}
+		dst = append(dst, pickleProto, 2, pickleEmptyList, pickleMark)
+		for n := 0; (!e.framed || n < pickleMaxDatapoints) && len(batch) > 0; n++ {
+			dp, rest, err := ReadDatapoint(batch)
+			if err != nil {
+				return dst[:start], err
+			}
+			dst = appendPickleDatapoint(dst, dp, e.precision)
+			batch = rest
+		}
+		dst = append(dst, pickleAppends, pickleStop)
+		if e.framed {
+			binary.BigEndian.PutUint32(dst[start:], uint32(len(dst)-start-4))
+		}
+	}
+	return dst, nil
+}
+
+func appendPickleDatapoint(dst []byte, dp Datapoint, precision config.TimestampPrecision) []byte {
+	dst = append(dst, pickleBinUnicode)
+	dst = binary.LittleEndian.AppendUint32(dst, uint32(len(dp.Path)))
+	dst = append(dst, dp.Path...)
+
+	// Timestamps are rounded to the second, as in the plaintext protocol, unless more precision is asked.
+	var timestamp float64
+	switch precision {
+	case config.PrecisionMilliseconds:
+		timestamp = float64(dp.Timestamp)
+	case config.PrecisionFractional:
+		timestamp = float64(dp.Timestamp) / 1e3
+	default:
+		timestamp = math.RoundToEven(float64(dp.Timestamp*1e6) / 1e9)
+	}
+	if timestamp == math.Trunc(timestamp) && timestamp >= math.MinInt32 && timestamp <= math.MaxInt32 {
+		dst = append(dst, pickleBinInt)
+		dst = binary.LittleEndian.AppendUint32(dst, uint32(int32(timestamp)))
+	} else {
+		dst = append(dst, pickleBinFloat)
+		dst = binary.BigEndian.AppendUint64(dst, math.Float64bits(timestamp))
+	}
+	dst = append(dst, pickleBinFloat)
+	dst = binary.BigEndian.AppendUint64(dst, math.Float64bits(dp.Value))
+	return append(dst, pickleTuple2, pickleTuple2)
+}
@@ -0,0 +1,95 @@
+// Copyright 2024-2025 NetCracker Technology Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPickleEncoder(t *testing.T) {
+	var batch bytes.Buffer
+	WriteDatapoint(&batch, []byte("a.b"), 1.5, 1600000000000)
+
+	out, err := NewEncoder(config.ProtocolPickle, config.PrecisionSeconds).Encode(nil, batch.Bytes())
+	require.NoError(t, err)
+
+	// pickle.loads(out[4:]) == [('a.b', (1600000000, 1.5))]
+	expected := []byte{
+		0, 0, 0, 30,
+		0x80, 2, ']', '(',
+		'X', 3, 0, 0, 0, 'a', '.', 'b',
+		'J', 0x00, 0x10, 0x5e, 0x5f,
+		'G', 0x3f, 0xf8, 0, 0, 0, 0, 0, 0,
+		0x86, 0x86,
+		'e', '.',
+	}
+	require.Equal(t, expected, out)
+}
+
+func TestPickleEncoderSplitsMessages(t *testing.T) {
+	var batch bytes.Buffer
+	for i := 0; i < pickleMaxDatapoints+1; i++ {
+		WriteDatapoint(&batch, []byte("a.b"), float64(i), 1600000000000)
+	}
+
+	out, err := NewEncoder(config.ProtocolPickle, config.PrecisionSeconds).Encode(nil, batch.Bytes())
+	require.NoError(t, err)
+
+	var messages int
+	for len(out) > 0 {
+		length := binary.BigEndian.Uint32(out)
+		require.LessOrEqual(t, int(length)+4, len(out))
+		require.Equal(t, byte(pickleStop), out[4+length-1])
+		out = out[4+length:]
+		messages++
+	}
+	require.Equal(t, 2, messages)
+}
+
+func TestPickleMessageEncoder(t *testing.T) {
+	var batch bytes.Buffer
+	WriteDatapoint(&batch, []byte("a.b"), 1.5, 1600000000000)
+
+	framed, err := NewEncoder(config.ProtocolPickle, config.PrecisionSeconds).Encode(nil, batch.Bytes())
+	require.NoError(t, err)
+	out, err := NewMessageEncoder(config.ProtocolPickle, config.PrecisionSeconds).Encode(nil, batch.Bytes())
+	require.NoError(t, err)
+	require.Equal(t, framed[4:], out)
+}
+
+func TestPickleEncoderFractional(t *testing.T) {
+	var batch bytes.Buffer
+	WriteDatapoint(&batch, []byte("a.b"), 1.5, 1600000000250)
+
+	out, err := NewMessageEncoder(config.ProtocolPickle, config.PrecisionFractional).Encode(nil, batch.Bytes())
+	require.NoError(t, err)
+
+	// pickle.loads(out) == [('a.b', (1600000000.25, 1.5))]
+	expected := []byte{
+		0x80, 2, ']', '(',
+		'X', 3, 0, 0, 0, 'a', '.', 'b',
+		'G', 0x41, 0xd7, 0xd7, 0x84, 0, 0x10, 0, 0,
+		'G', 0x3f, 0xf8, 0, 0, 0, 0, 0, 0,
+		0x86, 0x86,
+		'e', '.',
+	}
+	require.Equal(t, expected, out)
+}
@@ -0,0 +1,101 @@
+// Copyright 2024-2025 NetCracker Technology Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package protocol
+
+import (
+	"strconv"
+
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/config"
+)
+
+// Encoder encodes batches of datapoints in a carbon protocol.
+type Encoder interface {
+	// Encode appends the payload of a batch to dst.
+	Encode(dst []byte, batch []byte) ([]byte, error)
+}
+
+// NewEncoder returns the encoder of a carbon protocol over a stream, plaintext by default.
+// Pickle and carbonpb messages are prefixed with their length.
+// Timestamps are encoded with precision, carbonpb only supporting seconds.
+func NewEncoder(protocol config.ProtocolType, precision config.TimestampPrecision) Encoder {
+	switch protocol {
+	case config.ProtocolPickle:
+		return pickleEncoder{framed: true, precision: precision}
+	case config.ProtocolCarbonPB:
+		return carbonpbEncoder{framed: true}
+	default:
+		return plaintextEncoder{precision: precision}
+	}
+}
+
+// NewMessageEncoder returns the encoder of a carbon protocol encoding a batch as a single
+// message without length prefix, as expected in the body of HTTP requests.
+func NewMessageEncoder(protocol config.ProtocolType, precision config.TimestampPrecision) Encoder {
+	switch protocol {
+	case config.ProtocolPickle:
+		return pickleEncoder{precision: precision}
+	case config.ProtocolCarbonPB:
+		return carbonpbEncoder{}
+	default:
+		return plaintextEncoder{precision: precision}
+	}
+}
+
+// ContentType returns the media type of a carbon protocol, as expected by the go-carbon HTTP receiver.
+func ContentType(protocol config.ProtocolType) string {
+	switch protocol {
+	case config.ProtocolPickle:
+		return "application/python-pickle"
+	case config.ProtocolCarbonPB:
+		return "application/protobuf"
+	default:
+		return "text/plain"
+	}
+}
+
+type plaintextEncoder struct {
+	precision config.TimestampPrecision
+}
+
+func (e plaintextEncoder) Encode(dst []byte, batch []byte) ([]byte, error) {
+	for len(batch) > 0 {
+		dp, rest, err := ReadDatapoint(batch)
+		if err != nil {
+			return dst, err
+		}
+		dst = AppendPlaintext(dst, dp, e.precision)
+		batch = rest
+	}
+	return dst, nil
+}
+
+// AppendPlaintext appends the "path value timestamp\n" line of a datapoint to dst.
+// The timestamp is in seconds, with fractional milliseconds, or in milliseconds, depending on precision.
+func AppendPlaintext(dst []byte, dp Datapoint, precision config.TimestampPrecision) []byte {
+	dst = append(dst, dp.Path...)
+	dst = append(dst, ' ')
+	dst = strconv.AppendFloat(dst, dp.Value, 'f', 6, 64)
+	dst = append(dst, ' ')
+	switch precision {
+	case config.PrecisionMilliseconds:
+		dst = strconv.AppendInt(dst, dp.Timestamp, 10)
+	case config.PrecisionFractional:
+		dst = strconv.AppendFloat(dst, float64(dp.Timestamp)/1e3, 'f', -1, 64)
+	default:
+		dst = strconv.AppendFloat(dst, float64(dp.Timestamp*1e6)/1e9, 'f', 0, 64)
+	}
+	return append(dst, '\n')
+}
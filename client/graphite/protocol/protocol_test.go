@@ -0,0 +1,62 @@
+// Copyright 2024-2025 NetCracker Technology Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package protocol
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/config"
+	"github.com/stretchr/testify/require"
+)
+
+func testBatch() []byte {
+	var batch bytes.Buffer
+	WriteDatapoint(&batch, []byte("prefix.test.metric"), 1.5, 1600000000000)
+	WriteDatapoint(&batch, []byte("test;tag=value"), -2, 1600000000500)
+	return batch.Bytes()
+}
+
+func TestReadDatapoint(t *testing.T) {
+	batch := testBatch()
+
+	dp, batch, err := ReadDatapoint(batch)
+	require.NoError(t, err)
+	require.Equal(t, Datapoint{Path: []byte("prefix.test.metric"), Value: 1.5, Timestamp: 1600000000000}, dp)
+	dp, batch, err = ReadDatapoint(batch)
+	require.NoError(t, err)
+	require.Equal(t, Datapoint{Path: []byte("test;tag=value"), Value: -2, Timestamp: 1600000000500}, dp)
+	require.Empty(t, batch)
+
+	_, _, err = ReadDatapoint(testBatch()[:10])
+	require.ErrorIs(t, err, ErrCorruptBatch)
+}
+
+func TestPlaintextEncoder(t *testing.T) {
+	out, err := NewEncoder(config.ProtocolPlaintext, config.PrecisionSeconds).Encode(nil, testBatch())
+	require.NoError(t, err)
+	require.Equal(t, "prefix.test.metric 1.500000 1600000000\ntest;tag=value -2.000000 1600000000\n", string(out))
+}
+
+func TestPlaintextEncoderPrecision(t *testing.T) {
+	out, err := NewEncoder(config.ProtocolPlaintext, config.PrecisionFractional).Encode(nil, testBatch())
+	require.NoError(t, err)
+	require.Equal(t, "prefix.test.metric 1.500000 1600000000\ntest;tag=value -2.000000 1600000000.5\n", string(out))
+
+	out, err = NewEncoder(config.ProtocolPlaintext, config.PrecisionMilliseconds).Encode(nil, testBatch())
+	require.NoError(t, err)
+	require.Equal(t, "prefix.test.metric 1.500000 1600000000000\ntest;tag=value -2.000000 1600000000500\n", string(out))
+}
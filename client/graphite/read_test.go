@@ -17,6 +17,7 @@ package graphite
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"net/url"
 	"reflect"
@@ -25,7 +26,6 @@ import (
 	"github.com/go-kit/log"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/prompb"
-	"golang.org/x/net/context"
 )
 
 var (
@@ -39,7 +39,7 @@ var (
 	}
 )
 
-func TakeFetchExpandURL(ctx context.Context, l log.Logger, u *url.URL) ([]byte, error) {
+func fetchExpandURLStub(ctx context.Context, l log.Logger, u *url.URL) ([]byte, error) {
 	var body bytes.Buffer
 	if u.String() == "http://testHost:6666/metrics/expand?format=json&leavesOnly=1&query=prometheus-prefix.test.%2A%2A" {
 		body.WriteString("{\"results\": [\"prometheus-prefix.test.owner.team-X\", \"prometheus-prefix.test.owner.team-Y\"]}")
@@ -47,7 +47,7 @@ func TakeFetchExpandURL(ctx context.Context, l log.Logger, u *url.URL) ([]byte,
 	return body.Bytes(), nil
 }
 
-func TestFetchRenderURL(ctx context.Context, l log.Logger, u *url.URL) ([]byte, error) {
+func fetchRenderURLStub(ctx context.Context, l log.Logger, u *url.URL) ([]byte, error) {
 	var body bytes.Buffer
 	if u.String() == "http://testHost:6666/render/?format=json&from=0&target=prometheus-prefix.test.owner.team-X&until=300" {
 		body.WriteString("[{\"target\": \"prometheus-prefix.test.owner.team-X\", \"datapoints\": [[18,0], [42,300]]}]")
@@ -61,7 +61,7 @@ func TestFetchRenderURL(ctx context.Context, l log.Logger, u *url.URL) ([]byte,
 }
 
 func TestQueryToTargets(t *testing.T) {
-	fetchURL = TestFetchExpandURL
+	fetchURL = fetchExpandURLStub
 	expectedTargets := []string{"prometheus-prefix.test.owner.team-X", "prometheus-prefix.test.owner.team-Y"}
 
 	labelMatchers := []*prompb.LabelMatcher{
@@ -103,7 +103,7 @@ func TestInvalidQueryToTargets(t *testing.T) {
 }
 
 func TestTargetToTimeseries(t *testing.T) {
-	fetchURL = TestFetchRenderURL
+	fetchURL = fetchRenderURLStub
 	expectedTs := &prompb.TimeSeries{
 		Labels:  expectedLabels,
 		Samples: expectedSamples,
@@ -119,7 +119,7 @@ func TestTargetToTimeseries(t *testing.T) {
 }
 
 func TestQueryTargetsWithTags(t *testing.T) {
-	fetchURL = TestFetchRenderURL
+	fetchURL = fetchRenderURLStub
 
 	labelMatchers := []*prompb.LabelMatcher{
 		{Type: prompb.LabelMatcher_EQ, Name: model.MetricNameLabel, Value: "test"},
@@ -0,0 +1,122 @@
+// Copyright 2024-2025 NetCracker Technology Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package relabel rewrites the labels of series with the semantics of Prometheus relabel configs.
+package relabel
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/config"
+	"github.com/prometheus/common/model"
+)
+
+// Process applies the relabel configs in order to a metric and returns the relabeled metric,
+// or nil if the metric is dropped. The metric is modified in place.
+func Process(m model.Metric, cfgs []*config.RelabelConfig) model.Metric {
+	for _, cfg := range cfgs {
+		if m = relabel(m, cfg); m == nil {
+			return nil
+		}
+	}
+	return m
+}
+
+func relabel(m model.Metric, cfg *config.RelabelConfig) model.Metric {
+	values := make([]string, 0, len(cfg.SourceLabels))
+	for _, name := range cfg.SourceLabels {
+		values = append(values, string(m[name]))
+	}
+	val := strings.Join(values, cfg.Separator)
+
+	switch cfg.Action {
+	case config.RelabelDrop:
+		if cfg.Regex.MatchString(val) {
+			return nil
+		}
+	case config.RelabelKeep:
+		if !cfg.Regex.MatchString(val) {
+			return nil
+		}
+	case config.RelabelReplace:
+		indexes := cfg.Regex.FindStringSubmatchIndex(val)
+		// If there is no match no replacement must take place.
+		if indexes == nil {
+			break
+		}
+		target := model.LabelName(cfg.Regex.ExpandString([]byte{}, cfg.TargetLabel, val, indexes))
+		if !target.IsValid() {
+			delete(m, model.LabelName(cfg.TargetLabel))
+			break
+		}
+		res := cfg.Regex.ExpandString([]byte{}, cfg.Replacement, val, indexes)
+		if len(res) == 0 {
+			delete(m, model.LabelName(cfg.TargetLabel))
+			break
+		}
+		m[target] = model.LabelValue(res)
+	case config.RelabelLowercase:
+		set(m, model.LabelName(cfg.TargetLabel), strings.ToLower(val))
+	case config.RelabelHashMod:
+		sum := md5.Sum([]byte(val))
+		// Like Prometheus, the hash is the last 8 bytes of the md5 sum.
+		mod := binary.BigEndian.Uint64(sum[md5.Size-8:]) % cfg.Modulus
+		set(m, model.LabelName(cfg.TargetLabel), strconv.FormatUint(mod, 10))
+	case config.RelabelLabelMap:
+		// Labels are mapped from the labels before the action, in order so that the result is stable
+		// when several labels are mapped to the same name.
+		names := make(model.LabelNames, 0, len(m))
+		for name := range m {
+			if cfg.Regex.MatchString(string(name)) {
+				names = append(names, name)
+			}
+		}
+		sort.Sort(names)
+		values := make([]model.LabelValue, len(names))
+		for i, name := range names {
+			values[i] = m[name]
+		}
+		for i, name := range names {
+			res := cfg.Regex.ReplaceAllString(string(name), cfg.Replacement)
+			set(m, model.LabelName(res), string(values[i]))
+		}
+	case config.RelabelLabelDrop:
+		for name := range m {
+			if cfg.Regex.MatchString(string(name)) {
+				delete(m, name)
+			}
+		}
+	case config.RelabelLabelKeep:
+		for name := range m {
+			if !cfg.Regex.MatchString(string(name)) {
+				delete(m, name)
+			}
+		}
+	}
+	return m
+}
+
+// set sets the value of a label, removing the label when the value is empty.
+func set(m model.Metric, name model.LabelName, value string) {
+	if value == "" {
+		delete(m, name)
+		return
+	}
+	m[name] = model.LabelValue(value)
+}
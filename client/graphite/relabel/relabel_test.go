@@ -0,0 +1,129 @@
+// Copyright 2024-2025 NetCracker Technology Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package relabel
+
+import (
+	"testing"
+
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/config"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	promrelabel "github.com/prometheus/prometheus/pkg/relabel"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+var testMetric = model.Metric{
+	model.MetricNameLabel: "http_requests_total",
+	"job":                 "api",
+	"instance":            "10.0.0.1:8080",
+	"pod":                 "api-7d9f8b6c5d-x2x7q",
+	"pod_template_hash":   "7d9f8b6c5d",
+	"meta_zone":           "eu-west-1",
+	"code":                "200",
+}
+
+func TestProcess(t *testing.T) {
+	cases := []struct {
+		name     string
+		cfgs     string
+		expected model.Metric
+	}{
+		{
+			name: "labeldrop",
+			cfgs: "- action: labeldrop\n  regex: pod_template_hash|meta_.*\n",
+			expected: model.Metric{
+				model.MetricNameLabel: "http_requests_total", "job": "api", "instance": "10.0.0.1:8080",
+				"pod": "api-7d9f8b6c5d-x2x7q", "code": "200",
+			},
+		},
+		{
+			name:     "labelkeep",
+			cfgs:     "- action: labelkeep\n  regex: __name__|job\n",
+			expected: model.Metric{model.MetricNameLabel: "http_requests_total", "job": "api"},
+		},
+		{
+			name: "replace",
+			cfgs: "- source_labels: [instance]\n  regex: '([^:]+):.*'\n  target_label: host\n" +
+				"- source_labels: [job, code]\n  separator: _\n  target_label: job\n  replacement: ${1}_v1\n" +
+				"- source_labels: [missing]\n  regex: '(.+)'\n  target_label: code\n" +
+				"- source_labels: [missing]\n  target_label: pod\n" +
+				"- action: labelkeep\n  regex: host|job|code|pod\n",
+			expected: model.Metric{"host": "10.0.0.1", "job": "api_200_v1", "code": "200"},
+		},
+		{
+			name:     "keep",
+			cfgs:     "- action: keep\n  source_labels: [job]\n  regex: api\n- action: labelkeep\n  regex: job\n",
+			expected: model.Metric{"job": "api"},
+		},
+		{
+			name: "keep drops",
+			cfgs: "- action: keep\n  source_labels: [job]\n  regex: web\n",
+		},
+		{
+			name: "drop",
+			cfgs: "- action: drop\n  source_labels: [__name__, code]\n  regex: http_.*;2..\n",
+		},
+		{
+			name:     "labelmap",
+			cfgs:     "- action: labelmap\n  regex: meta_(.+)\n- action: labelkeep\n  regex: zone|meta_zone\n",
+			expected: model.Metric{"zone": "eu-west-1", "meta_zone": "eu-west-1"},
+		},
+		{
+			name: "hashmod",
+			cfgs: "- action: hashmod\n  source_labels: [pod]\n  modulus: 16\n  target_label: shard\n" +
+				"- action: labelkeep\n  regex: shard\n",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var cfgs []*config.RelabelConfig
+			require.NoError(t, yaml.Unmarshal([]byte(c.cfgs), &cfgs))
+			res := Process(testMetric.Clone(), cfgs)
+			if c.expected != nil {
+				require.Equal(t, c.expected, res)
+			}
+
+			// Results must be those of Prometheus.
+			var promCfgs []*promrelabel.Config
+			require.NoError(t, yaml.Unmarshal([]byte(c.cfgs), &promCfgs))
+			promRes := promrelabel.Process(labels.FromMap(toMap(testMetric)), promCfgs...)
+			if promRes == nil {
+				require.Nil(t, res)
+			} else {
+				require.Equal(t, promRes.Map(), toMap(res))
+			}
+		})
+	}
+}
+
+func TestLowercase(t *testing.T) {
+	var cfgs []*config.RelabelConfig
+	require.NoError(t, yaml.Unmarshal([]byte("- action: lowercase\n  source_labels: [job, pod]\n  separator: '-'\n  target_label: app\n"), &cfgs))
+	m := Process(model.Metric{"job": "API", "pod": "Api-1"}, cfgs)
+	require.Equal(t, model.Metric{"job": "API", "pod": "Api-1", "app": "api-api-1"}, m)
+
+	m = Process(model.Metric{"job": "API", "app": "old"}, []*config.RelabelConfig{{Action: config.RelabelLowercase, TargetLabel: "app", SourceLabels: model.LabelNames{"missing"}}})
+	require.Equal(t, model.Metric{"job": "API"}, m)
+}
+
+func toMap(m model.Metric) map[string]string {
+	res := make(map[string]string, len(m))
+	for name, value := range m {
+		res[string(name)] = string(value)
+	}
+	return res
+}
@@ -0,0 +1,84 @@
+// Copyright 2024-2025 NetCracker Technology Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package graphite
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var writeRetries = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "remote_adapter_graphite",
+		Name:      "write_retries_total",
+		Help:      "Total number of retried writes to the carbon destination.",
+	},
+	[]string{"destination"},
+)
+
+// writeWithRetry sends buf using the connection c, retrying with a jittered exponential
+// backoff until it succeeds, retries are exhausted or ctx would expire before the next attempt.
+// The connection is only locked while writing, other batches can use it during the backoff.
+func (client *Client) writeWithRetry(ctx context.Context, d *destination, c *carbonConn, buf *bytes.Buffer) error {
+	retry := client.cfg.Write.CarbonRetry
+	for attempt := 0; ; attempt++ {
+		c.lock.Lock()
+		err := client.writeToCarbon(c, buf)
+		c.lock.Unlock()
+		if err == nil || attempt >= retry.MaxRetries {
+			return err
+		}
+
+		wait := backoff(attempt, retry.MinBackoff, retry.MaxBackoff)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return err
+		}
+		_ = level.Debug(client.logger).Log(
+			"err", err, "destination", d.address, "attempt", attempt+1, "backoff", wait,
+			"msg", "Retrying write to carbon")
+		writeRetries.WithLabelValues(d.address).Inc()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff returns the wait before the retry following attempt: min doubled on each attempt
+// up to max, of which a random half is jittered away to spread retries of concurrent writes.
+func backoff(attempt int, min, max time.Duration) time.Duration {
+	wait := min
+	for i := 0; i < attempt && wait < max; i++ {
+		wait *= 2
+	}
+	if max > 0 && wait > max {
+		wait = max
+	}
+	if wait <= 1 {
+		return wait
+	}
+	return wait/2 + time.Duration(rand.Int63n(int64(wait/2)))
+}
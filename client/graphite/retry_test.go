@@ -0,0 +1,122 @@
+// Copyright 2024-2025 NetCracker Technology Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package graphite
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/breaker"
+	graphiteconfig "github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/config"
+	"github.com/Netcracker/qubership-graphite-remote-adapter/config"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackoff(t *testing.T) {
+	for attempt, expected := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		expected *= time.Millisecond
+		wait := backoff(attempt, 100*time.Millisecond, time.Second)
+		require.GreaterOrEqual(t, wait, expected/2)
+		require.Less(t, wait, expected)
+	}
+	require.Zero(t, backoff(3, 0, 0))
+}
+
+func TestRetryAndCircuitBreaker(t *testing.T) {
+	addr := deadAddress(t)
+	cfg := config.DefaultConfig
+	cfg.Graphite.Write.CarbonAddress = addr
+	cfg.Graphite.Write.CarbonRetry.MaxRetries = 2
+	cfg.Graphite.Write.CarbonRetry.MinBackoff = 10 * time.Millisecond
+	cfg.Graphite.Write.CarbonCircuitBreaker.FailureThreshold = 2
+	cfg.Graphite.Write.CarbonCircuitBreaker.OpenTimeout = 200 * time.Millisecond
+	client := NewClient(&cfg, log.NewNopLogger(), nil, nil)
+	defer client.Shutdown()
+	d := client.destinations[0]
+	write := func() error {
+		_, err := writeSeries(client, false, testSeries("metric", prompb.Sample{Value: 1, Timestamp: 1000}))
+		return err
+	}
+
+	retries := testutil.ToFloat64(writeRetries.WithLabelValues(d.address))
+	require.Error(t, write())
+	require.Equal(t, retries+2, testutil.ToFloat64(writeRetries.WithLabelValues(d.address)))
+	require.Equal(t, breaker.Closed, d.breaker.State())
+
+	// The breaker opens after consecutive failures and writes fail fast.
+	require.Error(t, write())
+	require.Equal(t, breaker.Open, d.breaker.State())
+	require.ErrorIs(t, write(), breaker.ErrOpen)
+	require.Equal(t, retries+4, testutil.ToFloat64(writeRetries.WithLabelValues(d.address)))
+
+	// Carbon is given another chance after the open timeout.
+	srv := listenCarbon(t, addr)
+	time.Sleep(cfg.Graphite.Write.CarbonCircuitBreaker.OpenTimeout)
+	require.NoError(t, write())
+	require.Equal(t, breaker.Closed, d.breaker.State())
+	require.Equal(t, []string{"metric 1.000000 1"}, srv.lines(t, 1))
+}
+
+func TestRetryReleasesConnection(t *testing.T) {
+	cfg := config.DefaultConfig
+	cfg.Graphite.Write.CarbonAddress = deadAddress(t)
+	cfg.Graphite.Write.CarbonRetry.MaxRetries = 1
+	cfg.Graphite.Write.CarbonRetry.MinBackoff = time.Second
+	client := NewClient(&cfg, log.NewNopLogger(), nil, nil)
+	defer client.Shutdown()
+
+	done := make(chan error)
+	go func() {
+		_, err := writeSeries(client, false, testSeries("metric", prompb.Sample{Value: 1, Timestamp: 1000}))
+		done <- err
+	}()
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(writeRetries.WithLabelValues(client.destinations[0].address)) > 0
+	}, time.Second, time.Millisecond)
+	// The connection is not locked during the backoff.
+	c := client.destinations[0].conns[0]
+	require.True(t, c.lock.TryLock())
+	c.lock.Unlock()
+	require.Error(t, <-done)
+}
+
+func TestReplayWithOpenBreaker(t *testing.T) {
+	spoolCfg := graphiteconfig.DefaultSpoolConfig
+	spoolCfg.Directory = t.TempDir()
+	spoolCfg.ReplayInterval = time.Hour
+	cfg := config.DefaultConfig
+	cfg.Graphite.Write.CarbonAddress = deadAddress(t)
+	cfg.Graphite.Write.CarbonRetry.MaxRetries = 0
+	cfg.Graphite.Write.CarbonCircuitBreaker.FailureThreshold = 1
+	cfg.Graphite.Write.Spool = &spoolCfg
+	client := NewClient(&cfg, log.NewNopLogger(), nil, nil)
+	defer client.Shutdown()
+	d := client.destinations[0]
+
+	response, err := writeSeries(client, false, testSeries("metric", prompb.Sample{Value: 1, Timestamp: 1000}))
+	require.NoError(t, err)
+	require.Equal(t, "Spooled.", string(response))
+	require.Equal(t, breaker.Open, d.breaker.State())
+
+	// An open breaker is not mistaken for an empty spool.
+	ok, err := client.replayOne(d)
+	require.False(t, ok)
+	require.ErrorIs(t, err, breaker.ErrOpen)
+	require.Equal(t, 1, d.spool.Len())
+}
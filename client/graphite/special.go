@@ -0,0 +1,115 @@
+// Copyright 2024-2025 NetCracker Technology Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package graphite
+
+import (
+	"bytes"
+	"math"
+	"slices"
+
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/config"
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/metadata"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/value"
+)
+
+// Classes of special sample values.
+const (
+	classNaN    = "nan"
+	classInf    = "inf"
+	classNegInf = "neg_inf"
+	classStale  = "stale"
+)
+
+var (
+	ignoredSamples = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "remote_adapter_graphite",
+			Name:      "ignored_samples_total",
+			Help:      "The total number of samples not sent to Graphite due to unsupported float values (Inf, -Inf, NaN).",
+		},
+	)
+	specialSamples = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "remote_adapter_graphite",
+			Name:      "special_samples_total",
+			Help:      "Total number of samples of special values, Prometheus staleness markers apart from other NaNs, by action taken.",
+		},
+		[]string{"class", "action"},
+	)
+)
+
+// specialValue returns the class of a sample value that is not a number and the policy applied to it,
+// and counts the sample.
+func (client *Client) specialValue(v float64) (string, config.SpecialValueConfig) {
+	policies := &client.cfg.Write.SpecialValues
+	var class string
+	var policy config.SpecialValueConfig
+	switch {
+	case value.IsStaleNaN(v):
+		class, policy = classStale, policies.Stale
+	case math.IsNaN(v):
+		class, policy = classNaN, policies.NaN
+	case math.IsInf(v, 1):
+		class, policy = classInf, policies.Inf
+	default:
+		class, policy = classNegInf, policies.NegInf
+	}
+	if policy.Action == "" {
+		policy.Action = config.ActionDrop
+	}
+	specialSamples.WithLabelValues(class, string(policy.Action)).Inc()
+	return class, policy
+}
+
+// markerPaths returns the paths of the end marker series of a metric, never nil.
+func (client *Client) markerPaths(metric model.Metric, md metadata.Metadata, paths [][]byte, graphitePrefix string) [][]byte {
+	cfg := &client.cfg.Write.SpecialValues
+	var tags model.LabelSet
+	if cfg.MarkerTagName != "" && cfg.MarkerTagValue != "" {
+		tags = model.LabelSet{model.LabelName(cfg.MarkerTagName): model.LabelValue(cfg.MarkerTagValue)}
+	}
+	if markers := client.derivedPaths(metric, md, paths, cfg.MarkerSuffix, tags, graphitePrefix); markers != nil {
+		return markers
+	}
+	return [][]byte{}
+}
+
+// appendMarker encodes an end marker into the batches of the destinations of its paths and counts it
+// once for each of them.
+func (client *Client) appendMarker(bytesBuffers [][][]*bytes.Buffer, counts []int, paths [][]byte, value float64, timestamp int64, reqBufLen int) {
+	if len(paths) == 0 {
+		return
+	}
+	if client.cfg.Write.CarbonRouting == config.RoutingReplicate {
+		for _, path := range paths {
+			client.appendDatapoint(bytesBuffers[0], path, value, timestamp, reqBufLen)
+		}
+		for i := range counts {
+			counts[i]++
+		}
+		return
+	}
+	for j, path := range paths {
+		i := client.destinationIndex(path)
+		client.appendDatapoint(bytesBuffers[i], path, value, timestamp, reqBufLen)
+		if !slices.ContainsFunc(paths[:j], func(p []byte) bool { return client.destinationIndex(p) == i }) {
+			counts[i]++
+		}
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2024-2025 NetCracker Technology Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package graphite
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	graphiteconfig "github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/config"
+	"github.com/Netcracker/qubership-graphite-remote-adapter/config"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/pkg/value"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/require"
+)
+
+var staleNaN = math.Float64frombits(value.StaleNaN)
+
+func TestSpecialValues(t *testing.T) {
+	series := prompb.TimeSeries{
+		Labels: []prompb.Label{{Name: "__name__", Value: "metric"}, {Name: "job", Value: "app"}},
+		Samples: []prompb.Sample{
+			{Value: 1, Timestamp: 1000},
+			{Value: math.NaN(), Timestamp: 2000},
+			{Value: math.Inf(1), Timestamp: 3000},
+			{Value: math.Inf(-1), Timestamp: 4000},
+			{Value: staleNaN, Timestamp: 5000},
+		},
+	}
+
+	tests := []struct {
+		name          string
+		enableTags    bool
+		specialValues graphiteconfig.SpecialValuesConfig
+		expectOutput  []string
+		expectIgnored float64
+	}{
+		{
+			name:          "drop",
+			specialValues: config.DefaultConfig.Graphite.Write.SpecialValues,
+			expectOutput:  []string{"metric.job.app 1.000000 1"},
+			// Staleness markers are not ignored samples.
+			expectIgnored: 3,
+		},
+		{
+			name: "substitute and marker",
+			specialValues: graphiteconfig.SpecialValuesConfig{
+				NaN:          graphiteconfig.SpecialValueConfig{Action: graphiteconfig.ActionSubstitute, Value: -1},
+				Inf:          graphiteconfig.SpecialValueConfig{Action: graphiteconfig.ActionSubstitute, Value: 1e9},
+				Stale:        graphiteconfig.SpecialValueConfig{Action: graphiteconfig.ActionMarker, Value: 1},
+				MarkerSuffix: ".end",
+			},
+			expectOutput: []string{
+				"metric.job.app 1.000000 1",
+				"metric.job.app -1.000000 2",
+				"metric.job.app 1000000000.000000 3",
+				"metric.job.app.end 1.000000 5",
+			},
+			expectIgnored: 1,
+		},
+		{
+			name:       "tagged marker",
+			enableTags: true,
+			specialValues: graphiteconfig.SpecialValuesConfig{
+				Stale:          graphiteconfig.SpecialValueConfig{Action: graphiteconfig.ActionMarker, Value: 1},
+				MarkerTagName:  "marker",
+				MarkerTagValue: "end",
+			},
+			expectOutput: []string{
+				"metric;job=app 1.000000 1",
+				"metric;job=app;marker=end 1.000000 5",
+			},
+			expectIgnored: 3,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := config.DefaultConfig
+			cfg.Graphite.Write.CarbonAddress = "127.0.0.1:1"
+			cfg.Graphite.EnableTags = test.enableTags
+			cfg.Graphite.Write.SpecialValues = test.specialValues
+			client := NewClient(&cfg, log.NewNopLogger(), nil, nil)
+			defer client.Shutdown()
+
+			ignored := testutil.ToFloat64(ignoredSamples)
+			response, err := writeSeries(client, true, series)
+			require.NoError(t, err)
+			require.Equal(t, strings.Join(test.expectOutput, "\n")+"\n", string(response))
+			require.Equal(t, test.expectIgnored, testutil.ToFloat64(ignoredSamples)-ignored)
+		})
+	}
+}
+
+func TestSpecialHistogramValues(t *testing.T) {
+	// An empty histogram, whose quantiles are NaN, then a stale histogram.
+	stale := encodeHistogram(0, staleNaN, nil, nil, 1600000001000)
+	series := histogramSeries("latency", encodeHistogram(0, 0, nil, nil, 1600000000000), stale)
+	histograms := graphiteconfig.HistogramsConfig{
+		TagName:   "stat",
+		Count:     graphiteconfig.HistogramSeriesConfig{Suffix: ".count"},
+		Quantiles: []graphiteconfig.HistogramQuantileConfig{{Quantile: 0.5, Suffix: ".p50"}},
+	}
+
+	tests := []struct {
+		name          string
+		specialValues graphiteconfig.SpecialValuesConfig
+		expectOutput  []string
+	}{
+		{
+			name:          "drop",
+			specialValues: config.DefaultConfig.Graphite.Write.SpecialValues,
+			expectOutput:  []string{"latency.job.app.count 0.000000 1600000000"},
+		},
+		{
+			name: "substitute",
+			specialValues: graphiteconfig.SpecialValuesConfig{
+				NaN:   graphiteconfig.SpecialValueConfig{Action: graphiteconfig.ActionSubstitute, Value: -1},
+				Stale: graphiteconfig.SpecialValueConfig{Action: graphiteconfig.ActionSubstitute, Value: -2},
+			},
+			expectOutput: []string{
+				"latency.job.app.count 0.000000 1600000000",
+				"latency.job.app.p50 -1.000000 1600000000",
+				"latency.job.app.count -2.000000 1600000001",
+				"latency.job.app.p50 -2.000000 1600000001",
+			},
+		},
+		{
+			name: "marker",
+			specialValues: graphiteconfig.SpecialValuesConfig{
+				Stale:        graphiteconfig.SpecialValueConfig{Action: graphiteconfig.ActionMarker, Value: 1},
+				MarkerSuffix: ".end",
+			},
+			// A stale histogram writes a single end marker for all its derived series.
+			expectOutput: []string{
+				"latency.job.app.count 0.000000 1600000000",
+				"latency.job.app.end 1.000000 1600000001",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := config.DefaultConfig
+			cfg.Graphite.Write.CarbonAddress = "127.0.0.1:1"
+			cfg.Graphite.Write.Histograms = &histograms
+			cfg.Graphite.Write.SpecialValues = test.specialValues
+			client := NewClient(&cfg, log.NewNopLogger(), nil, nil)
+			defer client.Shutdown()
+
+			markers := testutil.ToFloat64(specialSamples.WithLabelValues(classStale, string(test.specialValues.Stale.Action)))
+			response, err := writeSeries(client, true, series)
+			require.NoError(t, err)
+			require.Equal(t, strings.Join(test.expectOutput, "\n")+"\n", string(response))
+			// Each derived value of the stale histogram is a staleness marker.
+			require.Equal(t, 2.0, testutil.ToFloat64(specialSamples.WithLabelValues(classStale, string(test.specialValues.Stale.Action)))-markers)
+		})
+	}
+}
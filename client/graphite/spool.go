@@ -0,0 +1,158 @@
+// Copyright 2024-2025 NetCracker Technology Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package graphite
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/breaker"
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/protocol"
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/spool"
+	"github.com/go-kit/log/level"
+)
+
+// spoolBuffers stores buffers in the spool of the destination to be replayed once it is reachable again.
+// carbonErr is the error which prevented the buffers from being sent, if any.
+func (client *Client) spoolBuffers(d *destination, bytesBuffers []*bytes.Buffer, carbonErr error) error {
+	for _, buf := range bytesBuffers {
+		if err := d.spool.Append(buf.Bytes()); err != nil {
+			_ = level.Error(client.logger).Log(
+				"err", err, "carbon_err", carbonErr, "destination", d.address,
+				"msg", "Failed to spool batch")
+			if carbonErr != nil {
+				return carbonErr
+			}
+			return err
+		}
+	}
+	if carbonErr != nil {
+		_ = level.Warn(client.logger).Log(
+			"err", carbonErr, "destination", d.address,
+			"msg", "Carbon is unreachable, batch spooled")
+	}
+	return nil
+}
+
+// spoolDirName returns a directory name for the spool of a destination address.
+func spoolDirName(address string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '[', ']':
+			return '_'
+		}
+		return r
+	}, address)
+}
+
+// replaySpool periodically sends the spooled batches of a destination until the client is shut down.
+func (client *Client) replaySpool(d *destination, interval time.Duration) {
+	defer client.spoolWG.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-client.spoolStop:
+			return
+		case <-ticker.C:
+			client.drainSpool(d)
+		}
+	}
+}
+
+// drainSpool sends spooled batches in order until the spool is empty or the destination fails.
+func (client *Client) drainSpool(d *destination) {
+	replayed := 0
+	for {
+		select {
+		case <-client.spoolStop:
+			return
+		default:
+		}
+
+		ok, err := client.replayOne(d)
+		if errors.Is(err, breaker.ErrOpen) {
+			// Batches are replayed once the destination is given another chance.
+			return
+		}
+		if err != nil {
+			d.up.Set(0)
+			_ = level.Warn(client.logger).Log(
+				"err", err, "destination", d.address, "replayed", replayed, "pending", d.spool.Len(),
+				"msg", "Failed to replay spooled batches")
+			return
+		}
+		if !ok {
+			if replayed > 0 {
+				d.up.Set(1)
+				_ = level.Info(client.logger).Log("destination", d.address, "replayed", replayed, "msg", "Spool replayed")
+			}
+			return
+		}
+		replayed++
+	}
+}
+
+// replayOne sends the oldest spooled batch of a destination. It returns false when the spool is empty,
+// and breaker.ErrOpen when the circuit breaker of the destination is open.
+// The datapoints of the batch are spread again over the connections of the destination.
+func (client *Client) replayOne(d *destination) (bool, error) {
+	data, token, err := d.spool.Peek()
+	if errors.Is(err, spool.ErrEmpty) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	bytesBuffers := make([][]*bytes.Buffer, len(d.conns))
+	for batch := data; len(batch) > 0; {
+		var dp protocol.Datapoint
+		if dp, batch, err = protocol.ReadDatapoint(batch); err != nil {
+			// Do not block the spool on a batch which cannot be replayed.
+			_ = level.Error(client.logger).Log("err", err, "destination", d.address, "msg", "Dropping spooled batch")
+			return true, d.spool.Drop(token, "corrupt")
+		}
+		client.appendDatapoint(bytesBuffers, dp.Path, dp.Value, dp.Timestamp, len(data))
+	}
+
+	if !d.breaker.Allow() {
+		return false, breaker.ErrOpen
+	}
+	for i, buffers := range bytesBuffers {
+		if err = client.replayBuffers(d.conns[i], buffers); err != nil {
+			d.breaker.Failure()
+			return false, err
+		}
+	}
+	d.breaker.Success()
+	return true, d.spool.Commit(token)
+}
+
+func (client *Client) replayBuffers(c *carbonConn, bytesBuffers []*bytes.Buffer) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for _, buf := range bytesBuffers {
+		if err := client.writeToCarbon(c, buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,492 @@
+// Copyright 2024-2025 NetCracker Technology Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package spool
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/config"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	segmentSuffix = ".seg"
+	cursorFile    = "cursor"
+	// length (4 bytes) + crc32 (4 bytes) + unix nano timestamp (8 bytes)
+	entryHeaderSize = 16
+)
+
+var (
+	// ErrEmpty is returned by Peek when the spool holds no entries.
+	ErrEmpty = errors.New("spool is empty")
+	// ErrFull is returned by Append when the entry does not fit into the spool.
+	ErrFull = errors.New("spool is full")
+
+	crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+	spoolSize = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "remote_adapter_graphite",
+			Name:      "spool_size_bytes",
+			Help:      "Size in bytes of the batches waiting in the on-disk spool.",
+		},
+		[]string{"spool"},
+	)
+	spoolEntries = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "remote_adapter_graphite",
+			Name:      "spool_entries",
+			Help:      "Number of batches waiting in the on-disk spool.",
+		},
+		[]string{"spool"},
+	)
+	spoolDropped = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "remote_adapter_graphite",
+			Name:      "spool_dropped_entries_total",
+			Help:      "Total number of spooled batches dropped before being replayed.",
+		},
+		[]string{"spool", "reason"},
+	)
+)
+
+// Token identifies the entry returned by Peek, to commit or drop it.
+type Token struct {
+	segment uint64
+	offset  int64
+	size    int64
+}
+
+type segment struct {
+	id      uint64
+	size    int64
+	entries int
+}
+
+// Spool is a disk-backed FIFO queue of encoded batches.
+// Entries are appended to segment files and read back in order. The read position is
+// persisted on each commit, so the spool survives restarts of the adapter.
+type Spool struct {
+	lock   sync.Mutex
+	name   string
+	cfg    config.SpoolConfig
+	logger log.Logger
+
+	size    prometheus.Gauge
+	entries prometheus.Gauge
+
+	segments []*segment
+	writer   *os.File
+	reader   *os.File
+	// offset of the next entry to read within the first segment
+	offset int64
+	// number of bytes and entries of the first segment already consumed
+	consumed        int64
+	consumedEntries int
+}
+
+// Open opens the spool stored in cfg.Directory, creating it if needed.
+// The name identifies the spool in metrics.
+func Open(name string, cfg *config.SpoolConfig, logger log.Logger) (*Spool, error) {
+	if err := os.MkdirAll(cfg.Directory, 0o750); err != nil {
+		return nil, err
+	}
+	s := &Spool{
+		name:    name,
+		cfg:     *cfg,
+		logger:  logger,
+		size:    spoolSize.WithLabelValues(name),
+		entries: spoolEntries.WithLabelValues(name),
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	s.updateMetrics()
+	_ = level.Info(logger).Log(
+		"directory", cfg.Directory, "entries", s.lenLocked(), "size", s.sizeLocked(),
+		"msg", "Spool opened")
+	return s, nil
+}
+
+func (s *Spool) load() error {
+	files, err := os.ReadDir(s.cfg.Directory)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), segmentSuffix) {
+			continue
+		}
+		id, parseErr := strconv.ParseUint(strings.TrimSuffix(f.Name(), segmentSuffix), 10, 64)
+		if parseErr != nil {
+			continue
+		}
+		s.segments = append(s.segments, &segment{id: id})
+	}
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i].id < s.segments[j].id })
+
+	for _, seg := range s.segments {
+		if err = s.scan(seg); err != nil {
+			return err
+		}
+	}
+
+	if len(s.segments) > 0 {
+		if err = s.loadCursor(); err != nil {
+			_ = level.Warn(s.logger).Log("err", err, "msg", "Ignoring invalid spool cursor")
+			s.offset, s.consumed, s.consumedEntries = 0, 0, 0
+		}
+	}
+	return nil
+}
+
+// scan counts the entries of a segment and truncates it after the last complete entry.
+func (s *Spool) scan(seg *segment) error {
+	f, err := os.OpenFile(s.segmentPath(seg.id), os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	var offset int64
+	header := make([]byte, entryHeaderSize)
+	for {
+		if _, err = f.ReadAt(header, offset); err != nil {
+			break
+		}
+		length := int64(binary.BigEndian.Uint32(header[0:4]))
+		if offset+entryHeaderSize+length > info.Size() {
+			err = io.ErrUnexpectedEOF
+			break
+		}
+		payload := make([]byte, length)
+		if _, err = f.ReadAt(payload, offset+entryHeaderSize); err != nil {
+			break
+		}
+		if crc32.Checksum(payload, crcTable) != binary.BigEndian.Uint32(header[4:8]) {
+			err = errors.New("checksum mismatch")
+			break
+		}
+		offset += entryHeaderSize + length
+		seg.entries++
+	}
+	seg.size = offset
+
+	if !errors.Is(err, io.EOF) {
+		_ = level.Warn(s.logger).Log(
+			"segment", seg.id, "offset", offset, "err", err,
+			"msg", "Truncating spool segment after last valid entry")
+	}
+	return f.Truncate(offset)
+}
+
+func (s *Spool) loadCursor() error {
+	content, err := os.ReadFile(filepath.Join(s.cfg.Directory, cursorFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var id uint64
+	var offset int64
+	var entries int
+	if _, err = fmt.Sscanf(string(content), "%d %d %d", &id, &offset, &entries); err != nil {
+		return err
+	}
+	if id != s.segments[0].id {
+		// The segment the cursor points to has already been removed.
+		return nil
+	}
+	if offset > s.segments[0].size || entries > s.segments[0].entries {
+		return fmt.Errorf("cursor %d:%d is out of segment bounds", id, offset)
+	}
+	s.offset, s.consumed, s.consumedEntries = offset, offset, entries
+	return nil
+}
+
+func (s *Spool) saveCursor() error {
+	if len(s.segments) == 0 {
+		return os.Remove(filepath.Join(s.cfg.Directory, cursorFile))
+	}
+	content := fmt.Sprintf("%d %d %d", s.segments[0].id, s.offset, s.consumedEntries)
+	return os.WriteFile(filepath.Join(s.cfg.Directory, cursorFile), []byte(content), 0o640)
+}
+
+func (s *Spool) segmentPath(id uint64) string {
+	return filepath.Join(s.cfg.Directory, fmt.Sprintf("%020d%s", id, segmentSuffix))
+}
+
+// Append adds data at the tail of the spool.
+// The oldest segments are dropped if the spool would grow beyond its maximum size.
+func (s *Spool) Append(data []byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	defer s.updateMetrics()
+
+	entrySize := int64(entryHeaderSize + len(data))
+	for s.cfg.MaxSize > 0 && s.sizeLocked()+entrySize > s.cfg.MaxSize {
+		if len(s.segments) < 2 {
+			spoolDropped.WithLabelValues(s.name, "size").Inc()
+			return ErrFull
+		}
+		if err := s.dropHead("size"); err != nil {
+			return err
+		}
+	}
+
+	last := s.lastSegment()
+	if last == nil || s.writer == nil || last.size >= s.cfg.SegmentSize {
+		if err := s.newSegment(); err != nil {
+			return err
+		}
+		last = s.lastSegment()
+	}
+
+	buf := make([]byte, entrySize)
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(data)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.Checksum(data, crcTable))
+	binary.BigEndian.PutUint64(buf[8:16], uint64(time.Now().UnixNano()))
+	copy(buf[entryHeaderSize:], data)
+	if _, err := s.writer.Write(buf); err != nil {
+		// Do not leave a partial entry behind.
+		_ = s.writer.Truncate(last.size)
+		return err
+	}
+	last.size += entrySize
+	last.entries++
+	return nil
+}
+
+func (s *Spool) newSegment() error {
+	if s.writer != nil {
+		_ = s.writer.Close()
+		s.writer = nil
+	}
+	id := uint64(1)
+	if last := s.lastSegment(); last != nil {
+		id = last.id + 1
+	}
+	f, err := os.OpenFile(s.segmentPath(id), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return err
+	}
+	s.writer = f
+	s.segments = append(s.segments, &segment{id: id})
+	return nil
+}
+
+// Peek returns the oldest entry of the spool without removing it, and the token to commit or drop it.
+// Entries older than the configured maximum age are dropped.
+func (s *Spool) Peek() ([]byte, Token, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for {
+		data, created, err := s.readHead()
+		if err != nil {
+			return nil, Token{}, err
+		}
+		size := int64(entryHeaderSize + len(data))
+		if s.cfg.MaxAge <= 0 || time.Since(created) <= s.cfg.MaxAge {
+			return data, Token{segment: s.segments[0].id, offset: s.offset, size: size}, nil
+		}
+		spoolDropped.WithLabelValues(s.name, "age").Inc()
+		if err = s.commitLocked(size); err != nil {
+			return nil, Token{}, err
+		}
+		s.updateMetrics()
+	}
+}
+
+func (s *Spool) readHead() ([]byte, time.Time, error) {
+	for len(s.segments) > 1 && s.consumedEntries >= s.segments[0].entries {
+		if err := s.removeHead(); err != nil {
+			return nil, time.Time{}, err
+		}
+	}
+	if len(s.segments) == 0 || s.consumedEntries >= s.segments[0].entries {
+		return nil, time.Time{}, ErrEmpty
+	}
+	if s.reader == nil {
+		f, err := os.Open(s.segmentPath(s.segments[0].id))
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		s.reader = f
+	}
+	header := make([]byte, entryHeaderSize)
+	if _, err := s.reader.ReadAt(header, s.offset); err != nil {
+		return nil, time.Time{}, err
+	}
+	data := make([]byte, binary.BigEndian.Uint32(header[0:4]))
+	if _, err := s.reader.ReadAt(data, s.offset+entryHeaderSize); err != nil {
+		return nil, time.Time{}, err
+	}
+	created := time.Unix(0, int64(binary.BigEndian.Uint64(header[8:16])))
+	return data, created, nil
+}
+
+// Commit removes the entry of a token returned by Peek. Entries dropped since, with their segment
+// when the spool was full, are already removed.
+func (s *Spool) Commit(token Token) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	defer s.updateMetrics()
+
+	if token.size == 0 {
+		return errors.New("commit without peek")
+	}
+	if !s.isHead(token) {
+		return nil
+	}
+	return s.commitLocked(token.size)
+}
+
+// Drop removes the entry of a token returned by Peek without replaying it, and counts it as dropped
+// for reason.
+func (s *Spool) Drop(token Token, reason string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	defer s.updateMetrics()
+
+	if token.size == 0 {
+		return errors.New("drop without peek")
+	}
+	if !s.isHead(token) {
+		return nil
+	}
+	spoolDropped.WithLabelValues(s.name, reason).Inc()
+	return s.commitLocked(token.size)
+}
+
+// isHead returns whether the entry of a token is still the oldest entry of the spool.
+func (s *Spool) isHead(token Token) bool {
+	return len(s.segments) > 0 && s.segments[0].id == token.segment && s.offset == token.offset
+}
+
+func (s *Spool) commitLocked(entrySize int64) error {
+	s.offset += entrySize
+	s.consumed += entrySize
+	s.consumedEntries++
+	if s.consumedEntries >= s.segments[0].entries && (len(s.segments) > 1 || s.segments[0].size >= s.cfg.SegmentSize) {
+		return s.removeHead()
+	}
+	return s.saveCursor()
+}
+
+// dropHead removes the oldest segment, accounting its remaining entries as dropped.
+func (s *Spool) dropHead(reason string) error {
+	spoolDropped.WithLabelValues(s.name, reason).Add(float64(s.segments[0].entries - s.consumedEntries))
+	return s.removeHead()
+}
+
+func (s *Spool) removeHead() error {
+	if s.reader != nil {
+		_ = s.reader.Close()
+		s.reader = nil
+	}
+	head := s.segments[0]
+	if len(s.segments) == 1 && s.writer != nil {
+		_ = s.writer.Close()
+		s.writer = nil
+	}
+	s.segments = s.segments[1:]
+	s.offset, s.consumed, s.consumedEntries = 0, 0, 0
+	if err := os.Remove(s.segmentPath(head.id)); err != nil {
+		return err
+	}
+	return s.saveCursor()
+}
+
+func (s *Spool) lastSegment() *segment {
+	if len(s.segments) == 0 {
+		return nil
+	}
+	return s.segments[len(s.segments)-1]
+}
+
+// Len returns the number of entries waiting in the spool.
+func (s *Spool) Len() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.lenLocked()
+}
+
+func (s *Spool) lenLocked() int {
+	n := -s.consumedEntries
+	for _, seg := range s.segments {
+		n += seg.entries
+	}
+	return n
+}
+
+// Size returns the number of bytes waiting in the spool.
+func (s *Spool) Size() int64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.sizeLocked()
+}
+
+func (s *Spool) sizeLocked() int64 {
+	size := -s.consumed
+	for _, seg := range s.segments {
+		size += seg.size
+	}
+	return size
+}
+
+func (s *Spool) updateMetrics() {
+	s.size.Set(float64(s.sizeLocked()))
+	s.entries.Set(float64(s.lenLocked()))
+}
+
+// Close releases the files held by the spool. Pending entries stay on disk.
+func (s *Spool) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var err error
+	if s.reader != nil {
+		err = s.reader.Close()
+		s.reader = nil
+	}
+	if s.writer != nil {
+		if closeErr := s.writer.Close(); closeErr != nil {
+			err = closeErr
+		}
+		s.writer = nil
+	}
+	return err
+}
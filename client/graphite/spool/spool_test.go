@@ -0,0 +1,182 @@
+// Copyright 2024-2025 NetCracker Technology Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package spool
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/config"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func testConfig(t *testing.T) *config.SpoolConfig {
+	cfg := config.DefaultSpoolConfig
+	cfg.Directory = t.TempDir()
+	return &cfg
+}
+
+func drain(t *testing.T, s *Spool) []string {
+	var out []string
+	for {
+		data, token, err := s.Peek()
+		if err == ErrEmpty {
+			return out
+		}
+		require.NoError(t, err)
+		out = append(out, string(data))
+		require.NoError(t, s.Commit(token))
+	}
+}
+
+func TestSpoolOrder(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.SegmentSize = 64
+	s, err := Open("test", cfg, log.NewNopLogger())
+	require.NoError(t, err)
+	defer s.Close()
+
+	var expected []string
+	for i := 0; i < 20; i++ {
+		line := fmt.Sprintf("test.metric.%d %d 1600000000\n", i, i)
+		expected = append(expected, line)
+		require.NoError(t, s.Append([]byte(line)))
+	}
+	require.Equal(t, 20, s.Len())
+
+	require.Equal(t, expected, drain(t, s))
+	require.Equal(t, 0, s.Len())
+	require.Equal(t, int64(0), s.Size())
+}
+
+func TestSpoolSurvivesReopen(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.SegmentSize = 100
+	s, err := Open("test", cfg, log.NewNopLogger())
+	require.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, s.Append([]byte(fmt.Sprintf("entry-%d", i))))
+	}
+	for i := 0; i < 4; i++ {
+		_, token, err := s.Peek()
+		require.NoError(t, err)
+		require.NoError(t, s.Commit(token))
+	}
+	require.NoError(t, s.Close())
+
+	s, err = Open("test", cfg, log.NewNopLogger())
+	require.NoError(t, err)
+	defer s.Close()
+	require.Equal(t, 6, s.Len())
+	require.NoError(t, s.Append([]byte("entry-10")))
+	require.Equal(t, []string{"entry-4", "entry-5", "entry-6", "entry-7", "entry-8", "entry-9", "entry-10"}, drain(t, s))
+}
+
+func TestSpoolTruncatesPartialEntry(t *testing.T) {
+	cfg := testConfig(t)
+	s, err := Open("test", cfg, log.NewNopLogger())
+	require.NoError(t, err)
+	require.NoError(t, s.Append([]byte("complete")))
+	require.NoError(t, s.Close())
+
+	f, err := os.OpenFile(filepath.Join(cfg.Directory, fmt.Sprintf("%020d%s", 1, segmentSuffix)), os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	_, err = f.Write([]byte{0, 0, 0, 42, 1, 2})
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	s, err = Open("test", cfg, log.NewNopLogger())
+	require.NoError(t, err)
+	defer s.Close()
+	require.Equal(t, []string{"complete"}, drain(t, s))
+}
+
+func TestSpoolMaxSize(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.SegmentSize = 2 * (entryHeaderSize + 10)
+	cfg.MaxSize = 4 * (entryHeaderSize + 10)
+	s, err := Open("test", cfg, log.NewNopLogger())
+	require.NoError(t, err)
+	defer s.Close()
+
+	for i := 0; i < 6; i++ {
+		require.NoError(t, s.Append([]byte(fmt.Sprintf("entry-%04d", i))))
+	}
+	// The oldest segment has been dropped to make room for the newest entries.
+	require.Equal(t, []string{"entry-0002", "entry-0003", "entry-0004", "entry-0005"}, drain(t, s))
+
+	require.ErrorIs(t, s.Append(make([]byte, cfg.MaxSize)), ErrFull)
+}
+
+func TestSpoolMaxAge(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.MaxAge = 50 * time.Millisecond
+	s, err := Open("test", cfg, log.NewNopLogger())
+	require.NoError(t, err)
+	defer s.Close()
+
+	require.NoError(t, s.Append([]byte("old")))
+	time.Sleep(2 * cfg.MaxAge)
+	require.NoError(t, s.Append([]byte("new")))
+
+	require.Equal(t, []string{"new"}, drain(t, s))
+}
+
+func TestSpoolCommitDroppedHead(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.SegmentSize = 2 * (entryHeaderSize + 10)
+	cfg.MaxSize = 4 * (entryHeaderSize + 10)
+	s, err := Open("test", cfg, log.NewNopLogger())
+	require.NoError(t, err)
+	defer s.Close()
+
+	for i := 0; i < 4; i++ {
+		require.NoError(t, s.Append([]byte(fmt.Sprintf("entry-%04d", i))))
+	}
+	data, token, err := s.Peek()
+	require.NoError(t, err)
+	require.Equal(t, "entry-0000", string(data))
+
+	// The segment of the peeked entry is dropped while it is replayed, the commit has nothing left to remove.
+	require.NoError(t, s.Append([]byte("entry-0004")))
+	require.NoError(t, s.Commit(token))
+	require.Equal(t, []string{"entry-0002", "entry-0003", "entry-0004"}, drain(t, s))
+
+	require.Error(t, s.Commit(Token{}))
+}
+
+func TestSpoolDrop(t *testing.T) {
+	s, err := Open("test", testConfig(t), log.NewNopLogger())
+	require.NoError(t, err)
+	defer s.Close()
+
+	require.NoError(t, s.Append([]byte("corrupt")))
+	require.NoError(t, s.Append([]byte("valid")))
+	dropped := testutil.ToFloat64(spoolDropped.WithLabelValues("test", "corrupt"))
+	_, token, err := s.Peek()
+	require.NoError(t, err)
+	require.NoError(t, s.Drop(token, "corrupt"))
+	// Dropping an entry already removed neither removes the next one nor counts it.
+	require.NoError(t, s.Drop(token, "corrupt"))
+	require.Equal(t, dropped+1, testutil.ToFloat64(spoolDropped.WithLabelValues("test", "corrupt")))
+	require.Equal(t, []string{"valid"}, drain(t, s))
+}
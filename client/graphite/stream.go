@@ -0,0 +1,161 @@
+// Copyright 2024-2025 NetCracker Technology Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package graphite
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"time"
+
+	adapter "github.com/Netcracker/qubership-graphite-remote-adapter/client"
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/config"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// streamStep is the number of samples encoded between two checks of the size of the chunks,
+// the samples of a time series are always encoded together.
+const streamStep = 64
+
+// chunkSender sends the chunks of a connection of a destination in order.
+// A chunk holds several batches when its samples were encoded in parallel.
+type chunkSender struct {
+	destination int
+	conn        int
+	chunks      chan []*bytes.Buffer
+}
+
+// writeStream encodes samples and sends them to carbon in chunks of about chunkSize bytes per
+// connection while the following samples are encoded. A connection holds at most a chunk being
+// encoded, a chunk waiting to be sent and a chunk being sent, whatever the size of the request.
+// When samples are encoded in parallel, they are encoded by windows of the parallel threshold.
+func (client *Client) writeStream(ctx context.Context, series []prompb.TimeSeries, graphitePrefix string, chunkSize int) ([]byte, error) {
+	replicate := client.cfg.Write.CarbonRouting == config.RoutingReplicate
+	begin := time.Now()
+
+	var (
+		mtx       sync.Mutex
+		wg        sync.WaitGroup
+		errs      = make([]error, len(client.destinations))
+		responses = make([][]byte, len(client.destinations))
+	)
+	senders := make([][]*chunkSender, len(client.destinations))
+	for i, d := range client.destinations {
+		senders[i] = make([]*chunkSender, client.connsPerDestination)
+		for j := range senders[i] {
+			s := &chunkSender{destination: i, conn: j, chunks: make(chan []*bytes.Buffer, 1)}
+			senders[i][j] = s
+			wg.Add(1)
+			go func(d *destination, s *chunkSender) {
+				defer wg.Done()
+				client.sendChunks(ctx, d, s, &mtx, errs, responses)
+			}(d, s)
+		}
+	}
+
+	// Chunks are handed over to the senders of their connection once they are big enough.
+	dispatch := func(bytesBuffers [][][]*bytes.Buffer, full bool) {
+		for i, destinationBuffers := range bytesBuffers {
+			if i > 0 && replicate {
+				break
+			}
+			for j, buffers := range destinationBuffers {
+				size := 0
+				for _, buf := range buffers {
+					size += buf.Len()
+				}
+				if size == 0 || (full && size < chunkSize) {
+					continue
+				}
+				if replicate {
+					// Senders only read chunks, so destinations share them.
+					for k := range senders {
+						senders[k][j].chunks <- buffers
+					}
+				} else {
+					senders[i][j].chunks <- buffers
+				}
+				destinationBuffers[j] = nil
+			}
+		}
+	}
+
+	// Buffers are allocated with the capacity of a chunk.
+	reqBufLen := chunkSize * len(client.destinations) * client.connsPerDestination
+	step := streamStep
+	if client.encodeWorkers > 1 {
+		step = max(step, client.cfg.Write.EncodeParallelThreshold)
+	}
+	bytesBuffers, counts := client.newBuffers()
+	for start := 0; start < len(series); {
+		end, pending := start, 0
+		for end < len(series) && pending < step {
+			pending += seriesSize(&series[end])
+			end++
+		}
+		client.encodeSeries(bytesBuffers, counts, series[start:end], graphitePrefix, reqBufLen)
+		dispatch(bytesBuffers, true)
+		start = end
+	}
+	dispatch(bytesBuffers, false)
+
+	for i := range senders {
+		for _, s := range senders[i] {
+			close(s.chunks)
+		}
+	}
+	wg.Wait()
+
+	report := adapter.WriteReportFromContext(ctx)
+	for i, d := range client.destinations {
+		if counts[i] == 0 {
+			continue
+		}
+		report.Add(adapter.DestinationReport{
+			Target:   d.address,
+			Samples:  counts[i],
+			Duration: time.Since(begin),
+			Err:      errs[i],
+		})
+	}
+	return client.writeResult(responses, errs, counts)
+}
+
+// sendChunks writes the chunks of s to the destination d until its channel is closed.
+// Once a chunk failed, the following chunks of the destination are dropped.
+func (client *Client) sendChunks(ctx context.Context, d *destination, s *chunkSender, mtx *sync.Mutex, errs []error, responses [][]byte) {
+	bytesBuffers := make([][]*bytes.Buffer, client.connsPerDestination)
+	for chunk := range s.chunks {
+		mtx.Lock()
+		failed := errs[s.destination] != nil
+		mtx.Unlock()
+		if failed {
+			continue
+		}
+
+		bytesBuffers[s.conn] = chunk
+		response, err := client.writeDestination(ctx, d, bytesBuffers)
+
+		mtx.Lock()
+		if err != nil && errs[s.destination] == nil {
+			errs[s.destination] = err
+		}
+		if string(response) == "Spooled." {
+			responses[s.destination] = response
+		}
+		mtx.Unlock()
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2024-2025 NetCracker Technology Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package graphite
+
+import (
+	"bytes"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	graphiteconfig "github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/config"
+	"github.com/Netcracker/qubership-graphite-remote-adapter/config"
+	"github.com/go-kit/log"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/require"
+)
+
+// streamSeries returns series of metrics metric_0 to metric_<n-1> with samples at the timestamps
+// 1000 to 1000+samples-1 seconds, each sample in its own time series.
+func streamSeries(n, samples int) []prompb.TimeSeries {
+	var series []prompb.TimeSeries
+	for ts := 0; ts < samples; ts++ {
+		for i := 0; i < n; i++ {
+			series = append(series, testSeries(fmt.Sprintf("metric_%d", i), prompb.Sample{Value: 1, Timestamp: int64(1000+ts) * 1000}))
+		}
+	}
+	return series
+}
+
+func TestWriteStream(t *testing.T) {
+	for _, routing := range []graphiteconfig.RoutingType{graphiteconfig.RoutingShard, graphiteconfig.RoutingReplicate} {
+		t.Run(string(routing), func(t *testing.T) {
+			servers := []*carbonServer{newCarbonServer(t), newCarbonServer(t)}
+			cfg := config.DefaultConfig
+			cfg.Graphite.Write.CarbonDestinations = []string{servers[0].Addr(), servers[1].Addr()}
+			cfg.Graphite.Write.CarbonConnections = 3
+			cfg.Graphite.Write.CarbonRouting = routing
+			cfg.Graphite.Write.ChunkSize = 200
+			client := NewClient(&cfg, log.NewNopLogger(), nil, nil)
+			defer client.Shutdown()
+
+			_, err := writeSeries(client, false, streamSeries(50, 20)...)
+			require.NoError(t, err)
+
+			total := 0
+			for i, srv := range servers {
+				expected := 1000
+				if client.ring != nil {
+					expected = 0
+					for j := 0; j < 50; j++ {
+						if client.ring.GetNode([]byte(fmt.Sprintf("metric_%d", j))) == i {
+							expected += 20
+						}
+					}
+				}
+				for _, lines := range srv.connLines(t, expected) {
+					last := map[string]string{}
+					for _, line := range lines {
+						// Chunks of a connection are sent in order.
+						fields := strings.Fields(line)
+						require.Less(t, last[fields[0]], fields[2], line)
+						last[fields[0]] = fields[2]
+						total++
+					}
+				}
+			}
+			if routing == graphiteconfig.RoutingReplicate {
+				require.Equal(t, 2000, total)
+			} else {
+				require.Equal(t, 1000, total)
+			}
+		})
+	}
+}
+
+func TestWriteStreamChunkSize(t *testing.T) {
+	receiver := &httpReceiver{}
+	srv := httptest.NewServer(receiver)
+	defer srv.Close()
+
+	cfg := config.DefaultConfig
+	cfg.Graphite.Write.CarbonAddress = srv.URL + "/"
+	cfg.Graphite.Write.CarbonTransport = "http"
+	cfg.Graphite.Write.ChunkSize = 1000
+	client := NewClient(&cfg, log.NewNopLogger(), nil, nil)
+	defer client.Shutdown()
+
+	series := streamSeries(50, 20)
+	_, err := writeSeries(client, false, series...)
+	require.NoError(t, err)
+
+	receiver.mtx.Lock()
+	defer receiver.mtx.Unlock()
+	// Each chunk is posted on its own, once it reached the chunk size.
+	require.Greater(t, len(receiver.bodies), 10)
+	var received []byte
+	for _, body := range receiver.bodies {
+		require.LessOrEqual(t, len(body), cfg.Graphite.Write.ChunkSize+streamStep*len("metric_00 1.000000 1000000000\n"))
+		received = append(received, body...)
+	}
+	require.Equal(t, len(series), bytes.Count(received, []byte("\n")))
+}
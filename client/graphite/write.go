@@ -17,197 +17,543 @@ package graphite
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
-	"io"
-	"net"
+	"math"
 	"net/http"
 	"strconv"
+	"sync"
 	"syscall"
 	"time"
 
+	adapter "github.com/Netcracker/qubership-graphite-remote-adapter/client"
 	"github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/config"
 	gpaths "github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/paths"
-	"github.com/Netcracker/qubership-graphite-remote-adapter/utils/lz4"
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/protocol"
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/relabel"
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/histogram"
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/metadata"
 	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
 )
 
 const udpMaxBytes = 1024
 
-func (client *Client) connectToCarbon() (net.Conn, error) {
-	if client.carbonCon != nil {
-		if time.Since(client.carbonLastReconnectTime) < client.cfg.Write.CarbonReconnectInterval {
-			// Last reconnect is not too long ago, re-use the connection.
-			return client.carbonCon, nil
-		}
-		_ = level.Debug(client.logger).Log(
-			"last", client.carbonLastReconnectTime,
-			"msg", "Reinitializing the connection to carbon")
-		client.disconnectFromCarbon()
+var relabelDroppedSeries = promauto.NewCounter(
+	prometheus.CounterOpts{
+		Namespace: "remote_adapter_graphite",
+		Name:      "relabel_dropped_series_total",
+		Help:      "Total number of series dropped by write relabel configs.",
+	},
+)
+
+// appendDatapoint appends a datapoint to the last batch of the connection it is sent with.
+func (client *Client) appendDatapoint(bytesBuffers [][]*bytes.Buffer, path []byte, value float64, timestamp int64, reqBufLen int) {
+	i := connIndex(path, len(bytesBuffers))
+	if len(bytesBuffers[i]) == 0 {
+		bytesBuffers[i] = append(bytesBuffers[i],
+			bytes.NewBuffer(make([]byte, 0, reqBufLen/(len(client.destinations)*client.connsPerDestination))))
 	}
+	protocol.WriteDatapoint(bytesBuffers[i][len(bytesBuffers[i])-1], path, value, timestamp)
+}
 
-	_ = level.Debug(client.logger).Log(
-		"transport", client.cfg.Write.CarbonTransport,
-		"address", client.cfg.Write.CarbonAddress,
-		"timeout", client.writeTimeout,
-		"msg", "Connecting to carbon")
-	conn, err := net.DialTimeout(client.cfg.Write.CarbonTransport, client.cfg.Write.CarbonAddress, client.writeTimeout)
-	if err != nil {
-		client.carbonCon = nil
-	} else {
-		client.carbonLastReconnectTime = time.Now()
-		client.carbonCon = conn
+// destinationIndex returns the index of the destination a path is sharded to.
+func (client *Client) destinationIndex(path []byte) int {
+	if client.ring == nil {
+		return 0
 	}
+	return client.ring.GetNode(path)
+}
 
-	return client.carbonCon, err
+// newBuffers returns empty batches grouped by destination and by the connection they are sent with,
+// and the counts of samples of each destination.
+// When datapoints are replicated, all destinations share the same buffers.
+func (client *Client) newBuffers() ([][][]*bytes.Buffer, []int) {
+	bytesBuffers := make([][][]*bytes.Buffer, len(client.destinations))
+	for i := range bytesBuffers {
+		if client.cfg.Write.CarbonRouting == config.RoutingReplicate && i > 0 {
+			bytesBuffers[i] = bytesBuffers[0]
+			continue
+		}
+		bytesBuffers[i] = make([][]*bytes.Buffer, client.connsPerDestination)
+	}
+	return bytesBuffers, make([]int, len(client.destinations))
 }
 
-func (client *Client) disconnectFromCarbon() {
-	if client.carbonCon != nil {
-		_ = client.carbonCon.Close()
+// seriesMetric returns the metric of the labels of a time series.
+func seriesMetric(labels []prompb.Label) model.Metric {
+	metric := make(model.Metric, len(labels))
+	for _, l := range labels {
+		metric[model.LabelName(l.Name)] = model.LabelValue(l.Value)
 	}
-	client.carbonCon = nil
+	return metric
 }
 
-func (client *Client) prepareWrite(samples model.Samples, reqBufLen int, r *http.Request) ([]*bytes.Buffer, error) {
-	_ = level.Debug(client.logger).Log("num_samples", len(samples), "storage", client.Name(), "msg", "Remote write")
+// derivedPaths returns the paths of a series derived from a metric: its paths followed by suffix in the
+// plain mode, or the paths of the metric with the tags in the tagged modes. Nothing is returned when
+// the series is not written in the current mode, without suffix or tags.
+func (client *Client) derivedPaths(metric model.Metric, md metadata.Metadata, paths [][]byte, suffix string, tags model.LabelSet, graphitePrefix string) [][]byte {
+	if client.format == gpaths.FormatCarbon {
+		if suffix == "" {
+			return nil
+		}
+		derived := make([][]byte, 0, len(paths))
+		for _, path := range paths {
+			derived = append(derived, append(append(make([]byte, 0, len(path)+len(suffix)), path...), suffix...))
+		}
+		// Paths within the limits can exceed them once suffixed.
+		return client.pathLimits.Paths(metric, derived, client.format)
+	}
 
-	graphitePrefix := client.cfg.StoragePrefixFromRequest(r)
+	if len(tags) == 0 {
+		return nil
+	}
+	m := metric.Clone()
+	for name, value := range tags {
+		m[name] = value
+	}
+	derived, err := gpaths.MetricPaths(m, md, client.format, graphitePrefix, client.cfg.Write.Rules, client.cfg.Write.TemplateData, client.pathLimits)
+	if err != nil {
+		_ = level.Debug(client.logger).Log("metric", m, "err", err)
+		return nil
+	}
+	return derived
+}
 
-	var currentBuf *bytes.Buffer
-	if client.cfg.Write.CarbonTransport == "udp" {
-		buf := make([]byte, 0, udpMaxBytes)
-		currentBuf = bytes.NewBuffer(buf)
-	} else {
-		buf := make([]byte, 0, reqBufLen)
-		currentBuf = bytes.NewBuffer(buf)
+// lookupMetadata returns the metadata of the family of a metric, empty when unknown.
+func (client *Client) lookupMetadata(metric model.Metric) metadata.Metadata {
+	if client.metadata == nil {
+		return metadata.Metadata{}
 	}
+	md, _ := client.metadata.Lookup(string(metric[model.MetricNameLabel]))
+	return md
+}
+
+// appendSeries encodes the samples and the histograms of time series into the batches of their destination
+// and counts them.
+// The paths of a time series, and their destinations, are computed once for all its samples.
+func (client *Client) appendSeries(bytesBuffers [][][]*bytes.Buffer, counts []int, series []prompb.TimeSeries, graphitePrefix string, reqBufLen int) {
+	replicate := client.cfg.Write.CarbonRouting == config.RoutingReplicate
+	var pathDestinations []int
+	// Whether a path of the time series is sent to each destination.
+	sentTo := make([]bool, len(client.destinations))
+	collapse := newCollapser(client.cfg.Write.Collapse)
 
-	bytesBuffers := []*bytes.Buffer{currentBuf}
-	for _, s := range samples {
-		datapoints, err := gpaths.ToDatapoints(s, client.format, graphitePrefix, client.cfg.Write.Rules, client.cfg.Write.TemplateData)
-		//_ = level.Debug(c.logger).Log("sample", s.String())
+	for n := range series {
+		ts := &series[n]
+		histograms := client.cfg.Write.Histograms != nil && len(ts.XXX_unrecognized) > 0
+		if len(ts.Samples) == 0 && !histograms {
+			continue
+		}
+		metric := seriesMetric(ts.Labels)
+		// The metadata are those of the family of the series as sent, whatever its relabeled name.
+		md := client.lookupMetadata(metric)
+		if len(client.cfg.Write.WriteRelabelConfigs) > 0 {
+			if metric = relabel.Process(metric, client.cfg.Write.WriteRelabelConfigs); metric == nil {
+				relabelDroppedSeries.Inc()
+				continue
+			}
+		}
+		paths, err := gpaths.MetricPaths(metric, md, client.format, graphitePrefix, client.cfg.Write.Rules, client.cfg.Write.TemplateData, client.pathLimits)
 		if err != nil {
-			_ = level.Debug(client.logger).Log("sample", s, "err", err)
-			client.ignoredSamples.Inc()
+			_ = level.Debug(client.logger).Log("metric", metric, "err", err)
+			ignoredSamples.Add(float64(len(ts.Samples)))
 			continue
 		}
-		for _, str := range datapoints {
-			if client.cfg.Write.CarbonTransport == "udp" && (currentBuf.Len()+len(str)) > udpMaxBytes {
-				currentBuf = bytes.NewBuffer(make([]byte, 0, udpMaxBytes))
-				bytesBuffers = append(bytesBuffers, currentBuf)
+		if len(paths) == 0 {
+			continue
+		}
+		// Samples of series over budget are not written to paths of their own, nor to derived paths.
+		limited := false
+		if client.limiter != nil {
+			if paths, limited = client.limitSeries(metric, paths, graphitePrefix, seriesSize(ts)); paths == nil {
+				continue
+			}
+		}
+
+		pathDestinations = pathDestinations[:0]
+		clear(sentTo)
+		for _, path := range paths {
+			i := 0
+			if !replicate {
+				i = client.destinationIndex(path)
+			}
+			pathDestinations = append(pathDestinations, i)
+			sentTo[i] = true
+		}
+
+		valid := 0
+		stale := false
+		// End marker paths of the time series, computed with its first marker.
+		var markerPaths [][]byte
+		for _, s := range ts.Samples {
+			value := s.Value
+			if math.IsNaN(value) || math.IsInf(value, 0) {
+				class, policy := client.specialValue(value)
+				stale = stale || class == classStale
+				switch policy.Action {
+				case config.ActionSubstitute:
+					value = policy.Value
+				case config.ActionMarker:
+					if limited {
+						continue
+					}
+					if markerPaths == nil {
+						markerPaths = client.markerPaths(metric, md, paths, graphitePrefix)
+					}
+					// Datapoints of the time series are written in timestamp order, the samples merged
+					// before the marker first.
+					if collapse != nil {
+						if value, timestamp, ok := collapse.flush(); ok {
+							client.appendPaths(bytesBuffers, paths, pathDestinations, value, timestamp, reqBufLen)
+						}
+					}
+					client.appendMarker(bytesBuffers, counts, markerPaths, policy.Value, s.Timestamp, reqBufLen)
+					continue
+				default:
+					if class != classStale {
+						_ = level.Debug(client.logger).Log("metric", metric, "value", value, "err", "invalid sample value")
+						ignoredSamples.Inc()
+					}
+					continue
+				}
+			}
+			valid++
+			timestamp := s.Timestamp
+			if collapse != nil {
+				var ok bool
+				if value, timestamp, ok = collapse.add(value, timestamp); !ok {
+					continue
+				}
+			}
+			client.appendPaths(bytesBuffers, paths, pathDestinations, value, timestamp, reqBufLen)
+		}
+		if collapse != nil {
+			if value, timestamp, ok := collapse.flush(); ok {
+				client.appendPaths(bytesBuffers, paths, pathDestinations, value, timestamp, reqBufLen)
 			}
-			currentBuf.Write(str)
-			//level.Debug(c.logger).Log("line", str, "msg", "Sending")
 		}
+		for i := range counts {
+			if replicate || sentTo[i] {
+				counts[i] += valid
+			}
+		}
+
+		if histograms && !limited {
+			if client.appendHistograms(bytesBuffers, counts, ts, metric, md, paths, graphitePrefix, reqBufLen) {
+				stale = true
+			}
+		}
+		// The series ended, its paths are computed again if it comes back.
+		if stale {
+			gpaths.EvictMetricPaths(metric, md)
+		}
+	}
+	if client.limiter != nil {
+		limiterActiveSeries.Set(float64(client.limiter.Active()))
+	}
+}
+
+// appendPaths encodes a datapoint of each path of a time series into the batches of their destination.
+func (client *Client) appendPaths(bytesBuffers [][][]*bytes.Buffer, paths [][]byte, pathDestinations []int, value float64, timestamp int64, reqBufLen int) {
+	for j, path := range paths {
+		client.appendDatapoint(bytesBuffers[pathDestinations[j]], path, value, timestamp, reqBufLen)
+	}
+}
+
+// seriesSize returns the number of samples and histograms of a time series.
+func seriesSize(ts *prompb.TimeSeries) int {
+	if len(ts.XXX_unrecognized) == 0 {
+		return len(ts.Samples)
 	}
-	return bytesBuffers, nil
+	return len(ts.Samples) + histogram.Len(ts)
+}
+
+// encodeSeries encodes time series like appendSeries. When they hold at least the parallel threshold of samples,
+// contiguous shards of the time series are encoded concurrently and the batches of each shard appended in order,
+// so that the samples of a time series keep their order.
+func (client *Client) encodeSeries(bytesBuffers [][][]*bytes.Buffer, counts []int, series []prompb.TimeSeries, graphitePrefix string, reqBufLen int) {
+	total := 0
+	for i := range series {
+		total += seriesSize(&series[i])
+	}
+	if client.encodeWorkers < 2 || len(series) < 2 || total < client.cfg.Write.EncodeParallelThreshold {
+		client.appendSeries(bytesBuffers, counts, series, graphitePrefix, reqBufLen)
+		return
+	}
+
+	// Shards hold about the same number of samples.
+	var shards [][]prompb.TimeSeries
+	target := (total + client.encodeWorkers - 1) / client.encodeWorkers
+	start, pending := 0, 0
+	for i := range series {
+		pending += seriesSize(&series[i])
+		if pending >= target || i == len(series)-1 {
+			shards = append(shards, series[start:i+1])
+			start, pending = i+1, 0
+		}
+	}
+
+	shardBuffers := make([][][][]*bytes.Buffer, len(shards))
+	shardCounts := make([][]int, len(shards))
+	var wg sync.WaitGroup
+	for k, shard := range shards {
+		shardBuffers[k], shardCounts[k] = client.newBuffers()
+		wg.Add(1)
+		go func(k int, shard []prompb.TimeSeries) {
+			defer wg.Done()
+			client.appendSeries(shardBuffers[k], shardCounts[k], shard, graphitePrefix, reqBufLen/len(shards))
+		}(k, shard)
+	}
+	wg.Wait()
+
+	replicate := client.cfg.Write.CarbonRouting == config.RoutingReplicate
+	for k := range shards {
+		for i := range counts {
+			counts[i] += shardCounts[k][i]
+		}
+		for i, destinationBuffers := range shardBuffers[k] {
+			if i > 0 && replicate {
+				break
+			}
+			for j, buffers := range destinationBuffers {
+				bytesBuffers[i][j] = append(bytesBuffers[i][j], buffers...)
+			}
+		}
+	}
+}
+
+// bufferedBytes returns the size of the encoded datapoints of batches.
+func (client *Client) bufferedBytes(bytesBuffers [][][]*bytes.Buffer) int {
+	size := 0
+	for i, destinationBuffers := range bytesBuffers {
+		if i > 0 && client.cfg.Write.CarbonRouting == config.RoutingReplicate {
+			break
+		}
+		for _, buffers := range destinationBuffers {
+			for _, buf := range buffers {
+				size += buf.Len()
+			}
+		}
+	}
+	return size
+}
+
+// prepareWrite encodes the samples of a request into batches, grouped by destination and by the connection
+// they are sent with, and counts the samples sent to each destination.
+// When datapoints are replicated, all destinations share the same buffers.
+func (client *Client) prepareWrite(req *prompb.WriteRequest, r *http.Request) ([][][]*bytes.Buffer, []int) {
+	bytesBuffers, counts := client.newBuffers()
+	client.encodeSeries(bytesBuffers, counts, req.Timeseries, client.cfg.StoragePrefixFromRequest(r), req.Size())
+	return bytesBuffers, counts
 }
 
 // Write implements the client.Writer interface.
-func (client *Client) Write(samples model.Samples, reqBufLen int, r *http.Request, dryRun bool) ([]byte, error) {
-	if client.cfg.Write.CarbonAddress == "" {
+func (client *Client) Write(ctx context.Context, req *prompb.WriteRequest, r *http.Request, dryRun bool) ([]byte, error) {
+	if len(client.destinations) == 0 {
 		return []byte("Skipped: Not set carbon address."), nil
 	}
-
-	bytesBuffers, err := client.prepareWrite(samples, reqBufLen, r)
-	if err != nil {
-		return nil, err
+	if client.asyncQueue != nil && !dryRun {
+		// The request is reused once Write returns, its time series are not.
+		series := append([]prompb.TimeSeries(nil), req.Timeseries...)
+		if err := client.enqueue(series, client.cfg.StoragePrefixFromRequest(r)); err != nil {
+			return nil, err
+		}
+		return []byte("Queued."), nil
 	}
+	_ = level.Debug(client.logger).Log("num_series", len(req.Timeseries), "storage", client.Name(), "msg", "Remote write")
 
 	if dryRun {
+		bytesBuffers, _ := client.prepareWrite(req, r)
+
 		dryRunResponse := make([]byte, 0)
-		for _, buf := range bytesBuffers {
-			dryRunResponse = append(dryRunResponse, buf.Bytes()...)
+		var err error
+		for i, destinationBuffers := range bytesBuffers {
+			if i > 0 && client.cfg.Write.CarbonRouting == config.RoutingReplicate {
+				break
+			}
+			for _, buffers := range destinationBuffers {
+				for _, buf := range buffers {
+					if dryRunResponse, err = client.dryRunEncoder.Encode(dryRunResponse, buf.Bytes()); err != nil {
+						return nil, err
+					}
+				}
+			}
 		}
 		return dryRunResponse, nil
-
 	}
-	// We are going to use the socket, lock it.
-	client.carbonConLock.Lock()
-	defer client.carbonConLock.Unlock()
 
 	select {
-	case <-r.Context().Done():
+	case <-ctx.Done():
 		return []byte("context cancelled."), fmt.Errorf("request context cancelled")
 	default:
 	}
 
-	for _, buf := range bytesBuffers {
-		var conn net.Conn
-		conn, err = client.connectToCarbon()
-		if err != nil {
-			return nil, err
-		}
-		pipeReader, pipeWriter := io.Pipe()
+	// Retries are bounded by the request context and the write timeout.
+	if client.writeTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, client.writeTimeout)
+		defer cancel()
+	}
 
-		switch client.cfg.Write.CompressType {
-		case config.LZ4:
-			go func() {
-				defer client.closePipeWrite(pipeWriter)
+	if client.cfg.Write.ChunkSize > 0 {
+		return client.writeStream(ctx, req.Timeseries, client.cfg.StoragePrefixFromRequest(r), client.cfg.Write.ChunkSize)
+	}
 
-				_, err = client.compressLZ4(pipeWriter, buf)
-			}()
-		case config.Plain:
-			fallthrough
-		default:
-			go func() {
-				defer client.closePipeWrite(pipeWriter)
+	bytesBuffers, counts := client.prepareWrite(req, r)
+	responses, errs := client.send(ctx, bytesBuffers, counts)
+	return client.writeResult(responses, errs, counts)
+}
 
-				_, err = buf.WriteTo(pipeWriter)
-			}()
+// writeResult merges the responses and errors of the destinations written to.
+// In replicate mode the write fails only when every destination failed: Prometheus would resend
+// the request and duplicate the datapoints of the destinations which succeeded. Destinations which
+// failed lose their datapoints, unless they have a spool.
+func (client *Client) writeResult(responses [][]byte, errs []error, counts []int) ([]byte, error) {
+	replicate := client.cfg.Write.CarbonRouting == config.RoutingReplicate
+	response := []byte("Done.")
+	var err error
+	written := 0
+	for i := range errs {
+		if counts[i] == 0 {
+			continue
 		}
-
-		var written int64
-		written, err = io.Copy(conn, pipeReader)
-		if err != nil {
-			if errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNRESET) {
-				_ = level.Error(client.logger).Log("msg", "Pipe is broken. Connection closed")
+		if errs[i] != nil {
+			if !replicate {
+				return nil, errs[i]
 			}
-			client.disconnectFromCarbon()
-			return nil, err
+			_ = level.Warn(client.logger).Log("err", errs[i], "destination", client.destinations[i].address, "msg", "Failed to replicate datapoints")
+			if err == nil {
+				err = errs[i]
+			}
+			continue
 		}
-
-		_ = level.Debug(client.logger).Log("msg", conn.LocalAddr().String()+"->"+conn.RemoteAddr().String(), "sent", strconv.FormatInt(written, 10))
-
-		err = pipeReader.Close()
-		if err != nil {
-			_ = level.Error(client.logger).Log("err", err.Error(), "msg", "failed to close pipe reader")
+		written++
+		if responses[i] != nil && string(responses[i]) != string(response) {
+			response = responses[i]
 		}
 	}
+	if err != nil && written == 0 {
+		return nil, err
+	}
+	return response, nil
+}
 
-	return []byte("Done."), err
+// send writes batches to each destination in parallel and reports the result of each destination
+// in the write report of ctx.
+func (client *Client) send(ctx context.Context, bytesBuffers [][][]*bytes.Buffer, counts []int) ([][]byte, []error) {
+	report := adapter.WriteReportFromContext(ctx)
+	var wg sync.WaitGroup
+	errs := make([]error, len(client.destinations))
+	responses := make([][]byte, len(client.destinations))
+	for i, d := range client.destinations {
+		if counts[i] == 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, d *destination) {
+			defer wg.Done()
+			begin := time.Now()
+			responses[i], errs[i] = client.writeDestination(ctx, d, bytesBuffers[i])
+			report.Add(adapter.DestinationReport{
+				Target:   d.address,
+				Samples:  counts[i],
+				Duration: time.Since(begin),
+				Err:      errs[i],
+			})
+		}(i, d)
+	}
+	wg.Wait()
+	return responses, errs
 }
 
-func (client *Client) compressLZ4(pipeWriter *io.PipeWriter, buf *bytes.Buffer) (written int64, err error) {
-	var lz4Writer *lz4.Writer
-	lz4Writer, err = lz4.NewWriter(pipeWriter, client.logger, client.cfg.Write.CompressLZ4Preferences)
+// writeToCarbon encodes a batch in the carbon protocol and sends it using the connection c.
+func (client *Client) writeToCarbon(c *carbonConn, buf *bytes.Buffer) error {
+	payload, err := client.encoder.Encode(nil, buf.Bytes())
 	if err != nil {
-		_ = level.Error(client.logger).Log("err", err)
+		return err
+	}
+	switch client.cfg.Write.CarbonTransport {
+	case "http":
+		return client.postToCarbon(c, payload)
+	case "udp":
+		return client.sendDatagrams(c, payload)
+	default:
+		return client.sendToCarbon(c, payload)
 	}
-	defer func(lz4Writer *lz4.Writer) {
-		errClose := lz4Writer.Close()
-		if errClose != nil {
-			_ = level.Error(client.logger).Log("err", errClose.Error(), "msg", "failed to close pipe writer")
-			err = errClose
+}
+
+// sendDatagrams sends plaintext lines in datagrams of at most udpMaxBytes.
+func (client *Client) sendDatagrams(c *carbonConn, payload []byte) error {
+	for len(payload) > 0 {
+		end := len(payload)
+		if end > udpMaxBytes {
+			end = bytes.LastIndexByte(payload[:udpMaxBytes], '\n') + 1
+			if end == 0 {
+				// A single line longer than a datagram.
+				if end = bytes.IndexByte(payload, '\n') + 1; end == 0 {
+					end = len(payload)
+				}
+			}
 		}
-	}(lz4Writer) // Make sure the writer is closed
+		if err := client.sendToCarbon(c, payload[:end]); err != nil {
+			return err
+		}
+		payload = payload[end:]
+	}
+	return nil
+}
 
-	// Compress the input.
-	written, err = io.Copy(lz4Writer, bytes.NewReader(buf.Bytes()))
+// sendToCarbon compresses an encoded batch and writes it with the connection c.
+func (client *Client) sendToCarbon(c *carbonConn, payload []byte) error {
+	conn, err := client.connectToCarbon(c)
 	if err != nil {
-		if !errors.Is(err, io.ErrShortWrite) {
-			_ = level.Error(client.logger).Log("err", err)
+		return err
+	}
+
+	data := payload
+	switch {
+	case c.lz4 != nil:
+		// Blocks of the batch are flushed in the frame of the connection.
+		c.compressed.Reset()
+		if _, err = c.lz4.Write(payload); err == nil {
+			err = c.lz4.Flush()
 		}
+		data = c.compressed.Bytes()
+	case client.cfg.Write.CompressType != "" && client.cfg.Write.CompressType != config.Plain:
+		buf := client.compressors.buffers.Get().(*bytes.Buffer)
+		buf.Reset()
+		defer client.compressors.buffers.Put(buf)
+		err = client.compress(buf, payload)
+		data = buf.Bytes()
+	}
+	if err != nil {
+		if c.lz4 != nil {
+			// The frame of the connection cannot be continued.
+			client.disconnectFromCarbon(c)
+		}
+		return err
 	}
-	return
-}
 
-func (client *Client) closePipeWrite(pipeWriter *io.PipeWriter) {
-	err := pipeWriter.Close()
+	if client.cfg.Write.CarbonWriteDeadline > 0 {
+		if err = conn.SetWriteDeadline(time.Now().Add(client.cfg.Write.CarbonWriteDeadline)); err != nil {
+			_ = level.Warn(client.logger).Log("err", err, "msg", "Failed to set carbon write deadline")
+		}
+	}
+
+	written, err := conn.Write(data)
 	if err != nil {
-		_ = level.Error(client.logger).Log("err", err.Error(), "msg", "failed to close pipe writer")
+		if errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNRESET) {
+			_ = level.Error(client.logger).Log("msg", "Pipe is broken. Connection closed")
+		}
+		client.disconnectFromCarbon(c)
+		return err
 	}
-	return
+
+	_ = level.Debug(client.logger).Log("msg", conn.LocalAddr().String()+"->"+conn.RemoteAddr().String(), "sent", strconv.Itoa(written))
+	return nil
 }
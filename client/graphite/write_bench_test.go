@@ -16,14 +16,20 @@
 package graphite
 
 import (
+	"io"
 	"math/rand"
+	"net"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/Netcracker/qubership-graphite-remote-adapter/config"
+	"github.com/go-kit/log"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/common/promlog"
+	"github.com/prometheus/prometheus/prompb"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var (
@@ -64,13 +70,31 @@ func BenchmarkTestProcessPrepareWrite1000(b *testing.B) {
 	benchmarkTestProcessPrepareWrite(b, 1000)
 }
 
+// The same number of samples is written, in time series of 1, 10 and 100 samples.
+// The paths of a time series are computed once for all its samples.
+func BenchmarkTestProcessPrepareWriteSamplesPerSeries1(b *testing.B) {
+	benchmarkTestProcessPrepareWriteSeries(b, 1000, 1)
+}
+
+func BenchmarkTestProcessPrepareWriteSamplesPerSeries10(b *testing.B) {
+	benchmarkTestProcessPrepareWriteSeries(b, 100, 10)
+}
+
+func BenchmarkTestProcessPrepareWriteSamplesPerSeries100(b *testing.B) {
+	benchmarkTestProcessPrepareWriteSeries(b, 10, 100)
+}
+
 func benchmarkTestProcessPrepareWrite(b *testing.B, n int) {
+	benchmarkTestProcessPrepareWriteSeries(b, n, 1)
+}
+
+func benchmarkTestProcessPrepareWriteSeries(b *testing.B, n int, samplesPerSeries int) {
 	var err error
 	var response []byte
 
 	b.ReportAllocs()
 
-	samples, bufSize := prepareSamples(n)
+	req := prepareSeries(n, samplesPerSeries)
 
 	lvl := &promlog.AllowedLevel{}
 	err = lvl.Set("error")
@@ -78,37 +102,99 @@ func benchmarkTestProcessPrepareWrite(b *testing.B, n int) {
 	logger := promlog.New(&promlog.Config{Level: lvl, Format: &promlog.AllowedFormat{}})
 	cfg := &config.DefaultConfig
 	cfg.Graphite.Write.CarbonAddress = "127.0.0.1"
-	client := NewClient(cfg, logger)
+	client := NewClient(cfg, logger, nil, nil)
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		response, err = client.Write(samples, bufSize, httptest.NewRequest("POST", "http://example.com/write", nil), true)
+		r := httptest.NewRequest("POST", "http://example.com/write", nil)
+		response, err = client.Write(r.Context(), req, r, true)
 		assert.NotEmpty(b, response)
 		assert.Nil(b, err)
 	}
+	b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*n*samplesPerSeries), "ns/sample")
+}
+
+func BenchmarkEncodeSeries1000(b *testing.B) {
+	b.ReportAllocs()
+
+	req := prepareSeries(1000, 1)
+	cfg := config.DefaultConfig
+	cfg.Graphite.Write.CarbonAddress = "127.0.0.1:1"
+	client := NewClient(&cfg, log.NewNopLogger(), nil, nil)
+	defer client.Shutdown()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		bytesBuffers, counts := client.newBuffers()
+		client.encodeSeries(bytesBuffers, counts, req.Timeseries, "", req.Size())
+	}
+	b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*1000), "ns/sample")
 }
 
-func prepareSamples(n int) (samples model.Samples, bufSize int) {
+// The samples are encoded and sent to a carbon server discarding them.
+func BenchmarkWrite1000(b *testing.B) {
+	benchmarkWrite(b, 1000, 0)
+}
+
+func BenchmarkWriteStream1000(b *testing.B) {
+	benchmarkWrite(b, 1000, 1<<20)
+}
+
+func benchmarkWrite(b *testing.B, n int, chunkSize int) {
+	b.ReportAllocs()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(b, err)
+	defer l.Close()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(c net.Conn) {
+				defer c.Close()
+				_, _ = io.Copy(io.Discard, c)
+			}(c)
+		}
+	}()
+
+	req := prepareSeries(n, 1)
+	cfg := config.DefaultConfig
+	cfg.Graphite.Write.CarbonAddress = l.Addr().String()
+	cfg.Graphite.Write.ChunkSize = chunkSize
+	client := NewClient(&cfg, log.NewNopLogger(), nil, nil)
+	defer client.Shutdown()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r := httptest.NewRequest("POST", "http://example.com/write", nil)
+		if _, err = client.Write(r.Context(), req, r, false); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*n), "ns/sample")
+}
+
+func prepareSeries(n int, samplesPerSeries int) *prompb.WriteRequest {
+	req := &prompb.WriteRequest{}
 	for i := 0; i < n; i++ {
-		metric := model.Metric{model.MetricNameLabel: lName[rand.Intn(20)], "cluster": "paas-kubernetes", "endpoint": "https-metrics",
+		metric := model.Metric{model.MetricNameLabel: lName[rand.Intn(len(lName))], "cluster": "paas-kubernetes", "endpoint": "https-metrics",
 			"id":    "/systemd/system.slice/kubepods-burstable-podb270ecd5_78cc_4232_9187_1dd035045cb1.slice:cri-containerd:169763650b87dfa9ebb90ee4dc704c57eb38abdd308a930cda1f45aab3bb7e6c",
-			"image": "registry:17001/k8s.gcr.io/pause:3.2", "instance": "169763650b87dfa9ebb90ee4dc704c57eb38abdd308a930cda1f45aab3bb7e6c", "namespace": namespaces[rand.Intn(20)],
-			"pod": namespaces[rand.Intn(20)], "prometheus": "monitoring/k8s", "prometheus_replica": "prometheus-k8s-0", "service": "kubelet", "team": "test_team"}
+			"image": "registry:17001/k8s.gcr.io/pause:3.2", "instance": "169763650b87dfa9ebb90ee4dc704c57eb38abdd308a930cda1f45aab3bb7e6c", "namespace": namespaces[rand.Intn(len(namespaces))],
+			"pod": namespaces[rand.Intn(len(namespaces))], "prometheus": "monitoring/k8s", "prometheus_replica": "prometheus-k8s-0", "service": "kubelet", "team": "test_team"}
+		ts := prompb.TimeSeries{}
 		for key, value := range metric {
-			bufSize += len(key)
-			bufSize += len(value)
+			ts.Labels = append(ts.Labels, prompb.Label{Name: string(key), Value: string(value)})
 		}
-		value := model.SampleValue(rand.Float64())
-		//math.MaxInt64 + '.' + 6 precision symbols
-		bufSize += 26
 		tt := model.Now()
-		//math.MaxFloat64 + 0 precision symbols
-		bufSize += 309
-		sample := &model.Sample{
-			Metric:    metric,
-			Value:     value,
-			Timestamp: tt}
-		samples = append(samples, sample)
+		for j := 0; j < samplesPerSeries; j++ {
+			ts.Samples = append(ts.Samples, prompb.Sample{
+				Value:     rand.Float64(),
+				Timestamp: int64(tt.Add(time.Duration(j) * time.Minute)),
+			})
+		}
+		req.Timeseries = append(req.Timeseries, ts)
 	}
-	return
+	return req
 }
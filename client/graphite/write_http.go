@@ -0,0 +1,94 @@
+// Copyright 2024-2025 NetCracker Technology Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package graphite
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/config"
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/protocol"
+	"github.com/go-kit/log/level"
+	"github.com/golang/snappy"
+)
+
+// postToCarbon posts an encoded batch to the carbon HTTP receiver of the connection c.
+// Unlike a socket write, the status code of the response acknowledges the batch.
+func (client *Client) postToCarbon(c *carbonConn, payload []byte) error {
+	body := payload
+	var contentEncoding string
+	switch client.cfg.Write.CompressType {
+	case config.Snappy:
+		// Bodies are snappy compressed in the block format, as in remote write.
+		body = snappy.Encode(nil, payload)
+		contentEncoding = string(config.Snappy)
+	case config.LZ4, config.Zstd, config.Gzip:
+		var compressed bytes.Buffer
+		if err := client.compress(&compressed, payload); err != nil {
+			return err
+		}
+		body = compressed.Bytes()
+		contentEncoding = string(client.cfg.Write.CompressType)
+	}
+
+	if client.tlsErr != nil {
+		return client.tlsErr
+	}
+	req, err := http.NewRequest(http.MethodPost, c.address, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", protocol.ContentType(client.cfg.Write.CarbonProtocol))
+	if contentEncoding != "" {
+		req.Header.Set("Content-Encoding", contentEncoding)
+	}
+	if httpCfg := client.cfg.Write.CarbonHTTP; httpCfg != nil {
+		for name, value := range httpCfg.Headers {
+			req.Header.Set(name, value)
+		}
+	}
+
+	resp, err := client.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if !client.httpSuccess(resp.StatusCode) {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("carbon HTTP receiver %s responded with %s: %s", c.address, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	// Drain the body to reuse the connection.
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	_ = level.Debug(client.logger).Log("msg", "POST "+c.address, "status", resp.StatusCode, "sent", len(body))
+	return nil
+}
+
+func (client *Client) httpSuccess(status int) bool {
+	if httpCfg := client.cfg.Write.CarbonHTTP; httpCfg != nil && len(httpCfg.SuccessStatusCodes) > 0 {
+		for _, code := range httpCfg.SuccessStatusCodes {
+			if status == code {
+				return true
+			}
+		}
+		return false
+	}
+	return status >= 200 && status < 300
+}
@@ -0,0 +1,154 @@
+// Copyright 2024-2025 NetCracker Technology Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package graphite
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	graphiteconfig "github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/config"
+	"github.com/Netcracker/qubership-graphite-remote-adapter/config"
+	"github.com/go-kit/log"
+	"github.com/golang/snappy"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/require"
+)
+
+// httpReceiver is a carbon HTTP receiver recording the requests it received.
+// It responds to each request with the next status of statuses, then with 200.
+type httpReceiver struct {
+	mtx      sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (h *httpReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	h.requests = append(h.requests, r)
+	h.bodies = append(h.bodies, body)
+	status := http.StatusOK
+	if len(h.statuses) > 0 {
+		status, h.statuses = h.statuses[0], h.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func TestWriteHTTP(t *testing.T) {
+	tests := []struct {
+		name            string
+		compressType    graphiteconfig.CompressType
+		protocol        graphiteconfig.ProtocolType
+		statuses        []int
+		successCodes    []int
+		expectErr       bool
+		expectRequests  int
+		contentType     string
+		contentEncoding string
+	}{
+		{
+			name:           "plaintext",
+			expectRequests: 1,
+			contentType:    "text/plain",
+		},
+		{
+			name:           "retried after unavailable",
+			statuses:       []int{http.StatusServiceUnavailable},
+			expectRequests: 2,
+			contentType:    "text/plain",
+		},
+		{
+			name:            "snappy",
+			compressType:    graphiteconfig.Snappy,
+			expectRequests:  1,
+			contentType:     "text/plain",
+			contentEncoding: "snappy",
+		},
+		{
+			name:            "carbonpb lz4",
+			compressType:    graphiteconfig.LZ4,
+			protocol:        graphiteconfig.ProtocolCarbonPB,
+			expectRequests:  1,
+			contentType:     "application/protobuf",
+			contentEncoding: "lz4",
+		},
+		{
+			name:           "unexpected success code",
+			statuses:       []int{http.StatusAccepted, http.StatusAccepted},
+			successCodes:   []int{http.StatusOK},
+			expectErr:      true,
+			expectRequests: 2,
+			contentType:    "text/plain",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			receiver := &httpReceiver{statuses: test.statuses}
+			srv := httptest.NewServer(receiver)
+			defer srv.Close()
+
+			cfg := config.DefaultConfig
+			cfg.Graphite.Write.CarbonAddress = srv.URL + "/"
+			cfg.Graphite.Write.CarbonTransport = "http"
+			cfg.Graphite.Write.CarbonRetry.MaxRetries = 1
+			cfg.Graphite.Write.CarbonRetry.MinBackoff = time.Millisecond
+			cfg.Graphite.Write.CompressType = test.compressType
+			if test.protocol != "" {
+				cfg.Graphite.Write.CarbonProtocol = test.protocol
+			}
+			cfg.Graphite.Write.CarbonHTTP = &graphiteconfig.HTTPConfig{
+				Headers:            map[string]string{"Authorization": "Bearer token"},
+				SuccessStatusCodes: test.successCodes,
+			}
+			client := NewClient(&cfg, log.NewNopLogger(), nil, nil)
+			defer client.Shutdown()
+
+			_, err := writeSeries(client, false, testSeries("metric", prompb.Sample{Value: 1, Timestamp: 1600000000000}))
+			if test.expectErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+
+			receiver.mtx.Lock()
+			defer receiver.mtx.Unlock()
+			require.Len(t, receiver.requests, test.expectRequests)
+			for _, r := range receiver.requests {
+				require.Equal(t, http.MethodPost, r.Method)
+				require.Equal(t, test.contentType, r.Header.Get("Content-Type"))
+				require.Equal(t, test.contentEncoding, r.Header.Get("Content-Encoding"))
+				require.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+			}
+			body := receiver.bodies[len(receiver.bodies)-1]
+			switch test.compressType {
+			case "":
+				if test.protocol == "" {
+					require.Equal(t, "metric 1.000000 1600000000\n", string(body))
+				}
+			case graphiteconfig.Snappy:
+				decoded, err := snappy.Decode(nil, body)
+				require.NoError(t, err)
+				require.Equal(t, "metric 1.000000 1600000000\n", string(decoded))
+			}
+		})
+	}
+}
@@ -18,24 +18,34 @@ package graphite
 import (
 	"bufio"
 	"bytes"
+	"crypto/tls"
+	"encoding/pem"
 	"errors"
+	"fmt"
 	"io"
 	"net"
-	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
-	"graphite-remote-adapter/utils/lz4"
-	"graphite-remote-adapter/web"
-
+	adapter "github.com/Netcracker/qubership-graphite-remote-adapter/client"
 	graphiteconfig "github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/config"
 	"github.com/Netcracker/qubership-graphite-remote-adapter/config"
+	"github.com/Netcracker/qubership-graphite-remote-adapter/utils/lz4"
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
+	"github.com/golang/snappy"
+	promconfig "github.com/prometheus/common/config"
+	"github.com/prometheus/common/model"
 	"github.com/prometheus/common/promlog"
+	"github.com/prometheus/prometheus/prompb"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 type Server interface {
@@ -80,15 +90,11 @@ func (t *TCPServer) Run(wg *sync.WaitGroup) (err error) {
 	for {
 		conn, srvErr := t.server.Accept()
 		if srvErr != nil {
-			if !errors.Is(srvErr, net.ErrClosed) {
-				err = errors.New("could not accept connection")
-				_ = level.Error(t.logger).Log("err", srvErr.Error(), "msg", "failed to accept connection")
-				break
+			if errors.Is(srvErr, net.ErrClosed) {
+				return nil
 			}
-		}
-		if conn == nil {
-			err = errors.New("could not create connection")
-			break
+			_ = level.Error(t.logger).Log("err", srvErr.Error(), "msg", "failed to accept connection")
+			return errors.New("could not accept connection")
 		}
 		// Handle the connection in a new goroutine.
 		// The loop then returns to accepting, so that
@@ -96,42 +102,44 @@ func (t *TCPServer) Run(wg *sync.WaitGroup) (err error) {
 		switch t.compressType {
 		case graphiteconfig.LZ4:
 			go func(c net.Conn) {
-				var lz4reader *lz4.Reader
-				lz4reader, err = lz4.NewReader(c, t.logger, 1<<18)
+				lz4reader, lz4Err := lz4.NewReader(c, t.logger, 1<<18)
+				if lz4Err != nil {
+					_ = level.Error(t.logger).Log("err", lz4Err, "msg", "failed to create lz4 reader")
+					_ = c.Close()
+					return
+				}
 				defer func(lz4reader *lz4.Reader) {
-					errClose := lz4reader.Close()
-					if errClose != nil {
-						_ = level.Error(t.logger).Log("err", errClose.Error(), "msg", "failed to close pipe reader")
-						err = errClose
+					if errClose := lz4reader.Close(); errClose != nil {
+						_ = level.Error(t.logger).Log("err", errClose.Error(), "msg", "failed to close lz4 reader")
 					}
 				}(lz4reader)
-				_, err = io.CopyBuffer(t.writer, lz4reader, make([]byte, 1<<18))
-				if err != nil {
-					_ = level.Error(t.logger).Log("err", err)
+				if _, copyErr := io.CopyBuffer(t.writer, lz4reader, make([]byte, 1<<18)); copyErr != nil {
+					_ = level.Error(t.logger).Log("err", copyErr)
 				}
 				// Shut down the connection.
-				err = conn.Close()
-				if err != nil {
-					_ = level.Error(t.logger).Log("err", err.Error(), "msg", "failed to close connection")
+				if closeErr := c.Close(); closeErr != nil {
+					_ = level.Error(t.logger).Log("err", closeErr.Error(), "msg", "failed to close connection")
 				}
 			}(conn)
 		case graphiteconfig.Plain:
 			fallthrough
 		default:
 			go func(c net.Conn) {
-				_, err = io.CopyBuffer(t.writer, c, make([]byte, 1<<18))
-				if err != nil {
-					_ = level.Error(t.logger).Log("err", err)
+				if _, copyErr := io.CopyBuffer(t.writer, c, make([]byte, 1<<18)); copyErr != nil {
+					_ = level.Error(t.logger).Log("err", copyErr)
 				}
 				// Shut down the connection.
-				err = c.Close()
-				if err != nil {
-					_ = level.Error(t.logger).Log("err", err.Error(), "msg", "failed to close connection")
+				if closeErr := c.Close(); closeErr != nil {
+					_ = level.Error(t.logger).Log("err", closeErr.Error(), "msg", "failed to close connection")
 				}
 			}(conn)
 		}
 	}
-	return
+}
+
+// Addr returns the address the TCP Server listens on.
+func (t *TCPServer) Addr() string {
+	return t.server.Addr().String()
 }
 
 // Close shuts down the TCP Server
@@ -141,267 +149,485 @@ func (t *TCPServer) Close() (err error) {
 	return t.server.Close()
 }
 
-func TestCompression(t *testing.T) {
+// testWrite sends the snappy encoded remote write request of the file reqFile to a carbon server
+// and checks that the server received the content of the file sampleFile.
+func testWrite(t *testing.T, reqFile, sampleFile string, compressType graphiteconfig.CompressType) {
 	debugLevel := &promlog.AllowedLevel{}
 	err := debugLevel.Set("debug")
 	assert.NoError(t, err)
 	logger := promlog.New(&promlog.Config{Level: debugLevel, Format: &promlog.AllowedFormat{}})
 
-	cfg := config.DefaultConfig
-	cfg.Web.ListenAddress = "127.0.0.1:9201"
-	cfg.Graphite.Write.CarbonAddress = ":2003"
-	cfg.Graphite.Write.CompressType = graphiteconfig.LZ4
-
-	webHandler := web.New(log.With(logger, "component", "web"), &cfg)
-	assert.NoError(t, err)
-
-	go func() {
-		err = webHandler.Run()
-		if err != nil {
-			_ = level.Error(logger).Log("err", err)
-		}
-	}()
-
 	var srv Server
-	srv, err = NewServer("tcp", cfg.Graphite.Write.CarbonAddress, cfg.Graphite.Write.CompressType, logger)
+	srv, err = NewServer("tcp", "127.0.0.1:0", compressType, logger)
 	assert.NoError(t, err, "error starting TCP server")
 
 	var wg sync.WaitGroup
 	wg.Add(1)
 	go func() {
-		err = srv.Run(&wg)
-		assert.NoError(t, err, "error running TCP server")
-		err = srv.Close()
-		assert.NoError(t, err, "error closing TCP server")
+		runErr := srv.Run(&wg)
+		assert.NoError(t, runErr, "error running TCP server")
 	}()
 	wg.Wait()
+	defer srv.Close()
 
-	file, err := os.Open("./testdata/req.sz")
-	assert.NoError(t, err)
+	cfg := config.DefaultConfig
+	cfg.Graphite.Write.CarbonAddress = srv.(*TCPServer).Addr()
+	cfg.Graphite.Write.CompressType = compressType
+	client := NewClient(&cfg, log.With(logger, "component", "graphite"), nil, nil)
 
-	defer file.Close()
-	stats, statsErr := file.Stat()
-	assert.NoError(t, statsErr)
-	var size = stats.Size()
-	metrics := make([]byte, size)
-	buffer := bufio.NewReader(file)
-	_, err = buffer.Read(metrics)
+	compressed, err := os.ReadFile(reqFile)
+	assert.NoError(t, err)
+	data, err := snappy.Decode(nil, compressed)
 	assert.NoError(t, err)
+	var req prompb.WriteRequest
+	assert.NoError(t, req.Unmarshal(data))
 
 	var inputBuffer []byte
-	inputBuffer, err = os.ReadFile("./testdata/sample.txt")
+	inputBuffer, err = os.ReadFile(sampleFile)
 	assert.NoError(t, err)
 
-	posturl := "http://" + cfg.Web.ListenAddress + "/write"
-	r, err := http.NewRequest("POST", posturl, bytes.NewBuffer(metrics))
+	r := httptest.NewRequest("POST", "/write", nil)
+	_, err = client.Write(r.Context(), &req, r, false)
 	assert.NoError(t, err)
-
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		client := &http.Client{}
-		var res *http.Response
-		res, err = client.Do(r)
-		assert.NoError(t, err)
-		defer func(Body io.ReadCloser) {
-			respErr := Body.Close()
-			if respErr != nil {
-				_ = level.Error(logger).Log("err", respErr, "msg", "failed to close response body")
-			}
-		}(res.Body)
-		assert.NotEmpty(t, res)
-		assert.Equal(t, http.StatusOK, res.StatusCode)
-	}()
-	wg.Wait()
+	// Shutting down the client ends the lz4 frame of its connections.
+	client.Shutdown()
 
 	b := make([]byte, len(inputBuffer))
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		reader := srv.(*TCPServer).reader
-		_, err = io.ReadFull(reader, b)
-		assert.NoError(t, err)
-	}()
-	wg.Wait()
+	_, err = io.ReadFull(srv.(*TCPServer).reader, b)
+	assert.NoError(t, err)
 
 	assert.NotEmpty(t, b)
 	assert.True(t, len(inputBuffer) == len(b))
-	assert.True(t, bytes.Compare(inputBuffer, b) == 0)
+	assert.True(t, bytes.Equal(inputBuffer, b))
+}
+
+func TestCompression(t *testing.T) {
+	testWrite(t, "./testdata/req.sz", "./testdata/sample.txt", graphiteconfig.LZ4)
 }
 
 func TestShortSizeCompression(t *testing.T) {
-	debugLevel := &promlog.AllowedLevel{}
-	err := debugLevel.Set("debug")
-	assert.NoError(t, err)
-	logger := promlog.New(&promlog.Config{Level: debugLevel, Format: &promlog.AllowedFormat{}})
+	testWrite(t, "./testdata/short_req.sz", "./testdata/short_sample.txt", graphiteconfig.LZ4)
+}
 
-	cfg := config.DefaultConfig
-	cfg.Web.ListenAddress = "127.0.0.1:9202"
-	cfg.Graphite.Write.CarbonAddress = ":2004"
-	cfg.Graphite.Write.CompressType = graphiteconfig.LZ4
+func TestWithoutCompression(t *testing.T) {
+	testWrite(t, "./testdata/req.sz", "./testdata/sample.txt", graphiteconfig.Plain)
+}
 
-	webHandler := web.New(log.With(logger, "component", "web"), &cfg)
-	assert.NoError(t, err)
+// carbonServer is a plaintext carbon server recording the lines received on each connection.
+type carbonServer struct {
+	listener net.Listener
+	mtx      sync.Mutex
+	conns    [][]string
+}
+
+func newCarbonServer(t *testing.T) *carbonServer {
+	return listenCarbon(t, "127.0.0.1:0")
+}
 
+func listenCarbon(t *testing.T, addr string) *carbonServer {
+	l, err := net.Listen("tcp", addr)
+	require.NoError(t, err)
+	return serveCarbon(t, l)
+}
+
+// serveCarbon records the lines received on the connections of a listener.
+func serveCarbon(t *testing.T, l net.Listener) *carbonServer {
+	s := &carbonServer{listener: l}
+	t.Cleanup(func() { _ = l.Close() })
 	go func() {
-		err = webHandler.Run()
-		if err != nil {
-			_ = level.Error(logger).Log("err", err)
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			s.mtx.Lock()
+			i := len(s.conns)
+			s.conns = append(s.conns, nil)
+			s.mtx.Unlock()
+			go func(c net.Conn) {
+				defer c.Close()
+				scanner := bufio.NewScanner(c)
+				for scanner.Scan() {
+					s.mtx.Lock()
+					s.conns[i] = append(s.conns[i], scanner.Text())
+					s.mtx.Unlock()
+				}
+			}(c)
 		}
 	}()
+	return s
+}
 
-	var srv Server
-	srv, err = NewServer("tcp", cfg.Graphite.Write.CarbonAddress, cfg.Graphite.Write.CompressType, logger)
-	assert.NoError(t, err, "error starting TCP server")
+func (s *carbonServer) Addr() string {
+	return s.listener.Addr().String()
+}
 
-	var wg sync.WaitGroup
-	wg.Add(1)
-	go func() {
-		err = srv.Run(&wg)
-		assert.NoError(t, err, "error running TCP server")
-		err = srv.Close()
-		assert.NoError(t, err, "error closing TCP server")
-	}()
-	wg.Wait()
+// connLines waits until n lines have been received and returns the lines received on each connection.
+func (s *carbonServer) connLines(t *testing.T, n int) [][]string {
+	var conns [][]string
+	require.Eventually(t, func() bool {
+		s.mtx.Lock()
+		defer s.mtx.Unlock()
+		conns = make([][]string, len(s.conns))
+		total := 0
+		for i, lines := range s.conns {
+			conns[i] = slices.Clone(lines)
+			total += len(lines)
+		}
+		return total >= n
+	}, 5*time.Second, 10*time.Millisecond, "carbon did not receive %d lines", n)
+	return conns
+}
 
-	file, err := os.Open("./testdata/short_req.sz")
-	assert.NoError(t, err)
+// lines waits until n lines have been received and returns them sorted.
+func (s *carbonServer) lines(t *testing.T, n int) []string {
+	var lines []string
+	for _, connLines := range s.connLines(t, n) {
+		lines = append(lines, connLines...)
+	}
+	slices.Sort(lines)
+	return lines
+}
 
-	defer file.Close()
-	stats, statsErr := file.Stat()
-	assert.NoError(t, statsErr)
-	var size = stats.Size()
-	metrics := make([]byte, size)
-	buffer := bufio.NewReader(file)
-	_, err = buffer.Read(metrics)
-	assert.NoError(t, err)
+// deadAddress returns the address of a port nobody listens on.
+func deadAddress(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	require.NoError(t, l.Close())
+	return addr
+}
 
-	var inputBuffer []byte
-	inputBuffer, err = os.ReadFile("./testdata/short_sample.txt")
-	assert.NoError(t, err)
+func testSeries(name string, samples ...prompb.Sample) prompb.TimeSeries {
+	return prompb.TimeSeries{
+		Labels:  []prompb.Label{{Name: model.MetricNameLabel, Value: name}},
+		Samples: samples,
+	}
+}
 
-	posturl := "http://" + cfg.Web.ListenAddress + "/write"
-	r, err := http.NewRequest("POST", posturl, bytes.NewBuffer(metrics))
-	assert.NoError(t, err)
+// writeSeries writes the series with a remote write request without prefix.
+func writeSeries(client *Client, dryRun bool, series ...prompb.TimeSeries) ([]byte, error) {
+	r := httptest.NewRequest("POST", "/write", nil)
+	return client.Write(r.Context(), &prompb.WriteRequest{Timeseries: series}, r, dryRun)
+}
 
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		client := &http.Client{}
-		var res *http.Response
-		res, err = client.Do(r)
-		assert.NoError(t, err)
-		defer func(Body io.ReadCloser) {
-			respErr := Body.Close()
-			if respErr != nil {
-				_ = level.Error(logger).Log("err", respErr, "msg", "failed to close response body")
+func TestConnectionsPool(t *testing.T) {
+	srv := newCarbonServer(t)
+	cfg := config.DefaultConfig
+	cfg.Graphite.Write.CarbonAddress = srv.Addr()
+	cfg.Graphite.Write.CarbonConnections = 4
+	client := NewClient(&cfg, log.NewNopLogger(), nil, nil)
+	defer client.Shutdown()
+
+	var series []prompb.TimeSeries
+	for i := 0; i < 50; i++ {
+		series = append(series, testSeries(fmt.Sprintf("metric_%d", i),
+			prompb.Sample{Value: 1, Timestamp: 1000},
+			prompb.Sample{Value: 2, Timestamp: 2000},
+			prompb.Sample{Value: 3, Timestamp: 3000}))
+	}
+	_, err := writeSeries(client, false, series...)
+	require.NoError(t, err)
+
+	conns := srv.connLines(t, 150)
+	require.Greater(t, len(conns), 1)
+	require.LessOrEqual(t, len(conns), 4)
+	seen := map[string]bool{}
+	for _, lines := range conns {
+		for i, line := range lines {
+			path := strings.Fields(line)[0]
+			if i > 0 && strings.Fields(lines[i-1])[0] == path {
+				continue
 			}
-		}(res.Body)
-		assert.NotEmpty(t, res)
-		assert.Equal(t, http.StatusOK, res.StatusCode)
-	}()
-	wg.Wait()
+			// The lines of a path are sent in order on a single connection.
+			require.False(t, seen[path], "path %s sent on several connections", path)
+			seen[path] = true
+			require.Equal(t, []string{path + " 1.000000 1", path + " 2.000000 2", path + " 3.000000 3"}, lines[i:i+3])
+		}
+	}
+	require.Len(t, seen, 50)
+	require.Equal(t, srv.Addr(), client.Target())
+}
 
-	b := make([]byte, len(inputBuffer))
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		reader := srv.(*TCPServer).reader
-		_, err = io.ReadFull(reader, b)
-		assert.NoError(t, err)
-	}()
-	wg.Wait()
+func TestShardDestinations(t *testing.T) {
+	var servers []*carbonServer
+	cfg := config.DefaultConfig
+	for i := 0; i < 3; i++ {
+		srv := newCarbonServer(t)
+		servers = append(servers, srv)
+		cfg.Graphite.Write.CarbonDestinations = append(cfg.Graphite.Write.CarbonDestinations, fmt.Sprintf("%s:%c", srv.Addr(), 'a'+i))
+	}
+	cfg.Graphite.Write.CarbonConnections = 2
+	client := NewClient(&cfg, log.NewNopLogger(), nil, nil)
+	defer client.Shutdown()
 
-	assert.NotEmpty(t, b)
-	assert.True(t, len(inputBuffer) == len(b))
-	assert.True(t, bytes.Compare(inputBuffer, b) == 0)
+	var series []prompb.TimeSeries
+	for i := 0; i < 60; i++ {
+		series = append(series, testSeries(fmt.Sprintf("metric_%d", i), prompb.Sample{Value: 1, Timestamp: 1000}))
+	}
+	_, err := writeSeries(client, false, series...)
+	require.NoError(t, err)
+
+	expected := make([]int, len(servers))
+	for _, s := range series {
+		expected[client.ring.GetNode([]byte(s.Labels[0].Value))]++
+	}
+	for i, srv := range servers {
+		require.NotZero(t, expected[i])
+		lines := srv.lines(t, expected[i])
+		require.Len(t, lines, expected[i])
+		for _, line := range lines {
+			// Paths are always sent to the same destination of the ring.
+			require.Equal(t, i, client.ring.GetNode([]byte(strings.Fields(line)[0])))
+		}
+	}
 }
 
-func TestWithoutCompression(t *testing.T) {
-	debugLevel := &promlog.AllowedLevel{}
-	err := debugLevel.Set("debug")
-	assert.NoError(t, err)
-	logger := promlog.New(&promlog.Config{Level: debugLevel, Format: &promlog.AllowedFormat{}})
+func TestReplicateDestinations(t *testing.T) {
+	for _, chunkSize := range []int{0, 1 << 20} {
+		t.Run(fmt.Sprintf("chunk_size=%d", chunkSize), func(t *testing.T) {
+			srv1, srv2 := newCarbonServer(t), newCarbonServer(t)
+			dead := deadAddress(t)
+			cfg := config.DefaultConfig
+			cfg.Graphite.Write.CarbonDestinations = []string{srv1.Addr(), srv2.Addr(), dead}
+			cfg.Graphite.Write.CarbonRouting = graphiteconfig.RoutingReplicate
+			cfg.Graphite.Write.CarbonConnections = 2
+			cfg.Graphite.Write.CarbonRetry.MaxRetries = 0
+			cfg.Graphite.Write.ChunkSize = chunkSize
+			client := NewClient(&cfg, log.NewNopLogger(), nil, nil)
+			defer client.Shutdown()
+
+			var series []prompb.TimeSeries
+			for i := 0; i < 30; i++ {
+				series = append(series, testSeries(fmt.Sprintf("metric_%d", i), prompb.Sample{Value: 1, Timestamp: 1000}))
+			}
+			r := httptest.NewRequest("POST", "/write", nil)
+			ctx, report := adapter.WithWriteReport(r.Context())
+			// The write succeeds as long as a destination stored the datapoints.
+			response, err := client.Write(ctx, &prompb.WriteRequest{Timeseries: series}, r, false)
+			require.NoError(t, err)
+			require.Equal(t, "Done.", string(response))
+			require.Equal(t, srv1.lines(t, 30), srv2.lines(t, 30))
+			require.Len(t, srv1.lines(t, 30), 30)
+
+			destinations := report.Destinations()
+			require.Len(t, destinations, 3)
+			for _, d := range destinations {
+				require.Equal(t, 30, d.Samples)
+				if d.Target == dead {
+					require.Error(t, d.Err)
+				} else {
+					require.NoError(t, d.Err)
+				}
+			}
 
+			// Datapoints are shown once by dry runs.
+			response, err = writeSeries(client, true, series...)
+			require.NoError(t, err)
+			require.Equal(t, 30, strings.Count(string(response), "\n"))
+		})
+	}
+}
+
+func TestReplicateAllDestinationsFailed(t *testing.T) {
 	cfg := config.DefaultConfig
-	cfg.Web.ListenAddress = "127.0.0.1:9203"
-	cfg.Graphite.Write.CarbonAddress = ":2005"
-	cfg.Graphite.Write.CompressType = graphiteconfig.Plain
+	cfg.Graphite.Write.CarbonDestinations = []string{deadAddress(t), deadAddress(t)}
+	cfg.Graphite.Write.CarbonRouting = graphiteconfig.RoutingReplicate
+	cfg.Graphite.Write.CarbonRetry.MaxRetries = 0
+	client := NewClient(&cfg, log.NewNopLogger(), nil, nil)
+	defer client.Shutdown()
+
+	_, err := writeSeries(client, false, testSeries("metric", prompb.Sample{Value: 1, Timestamp: 1000}))
+	require.Error(t, err)
+}
 
-	webHandler := web.New(log.With(logger, "component", "web"), &cfg)
-	err = webHandler.ApplyConfig(&cfg)
-	assert.NoError(t, err)
+func TestDryRunPlaintext(t *testing.T) {
+	for _, protocol := range []graphiteconfig.ProtocolType{
+		graphiteconfig.ProtocolPlaintext, graphiteconfig.ProtocolPickle, graphiteconfig.ProtocolCarbonPB,
+	} {
+		t.Run(string(protocol), func(t *testing.T) {
+			cfg := config.DefaultConfig
+			cfg.Graphite.Write.CarbonAddress = "127.0.0.1:1"
+			cfg.Graphite.Write.CarbonProtocol = protocol
+			client := NewClient(&cfg, log.NewNopLogger(), nil, nil)
+			defer client.Shutdown()
+
+			// Whatever the carbon protocol, dry runs show datapoints as plaintext lines.
+			response, err := writeSeries(client, true,
+				testSeries("metric_a", prompb.Sample{Value: 1, Timestamp: 1000}),
+				testSeries("metric_b", prompb.Sample{Value: 2, Timestamp: 2000}))
+			require.NoError(t, err)
+			require.Equal(t, "metric_a 1.000000 1\nmetric_b 2.000000 2\n", string(response))
+		})
+	}
+}
 
-	go func() {
-		err = webHandler.Run()
-		if err != nil {
-			_ = level.Error(logger).Log("err", err)
+func TestEncodeSeriesParallel(t *testing.T) {
+	// Samples of a path are spread over series of all the shards.
+	series := streamSeries(50, 20)
+	encode := func(workers int, routing graphiteconfig.RoutingType) ([][][]byte, []int) {
+		cfg := config.DefaultConfig
+		cfg.Graphite.Write.CarbonDestinations = []string{"127.0.0.1:1", "127.0.0.1:2"}
+		cfg.Graphite.Write.CarbonConnections = 3
+		cfg.Graphite.Write.CarbonRouting = routing
+		cfg.Graphite.Write.EncodeWorkers = workers
+		cfg.Graphite.Write.EncodeParallelThreshold = 10
+		client := NewClient(&cfg, log.NewNopLogger(), nil, nil)
+		defer client.Shutdown()
+
+		bytesBuffers, counts := client.newBuffers()
+		client.encodeSeries(bytesBuffers, counts, series, "", 0)
+		encoded := make([][][]byte, len(bytesBuffers))
+		for i, destinationBuffers := range bytesBuffers {
+			encoded[i] = make([][]byte, len(destinationBuffers))
+			for j, buffers := range destinationBuffers {
+				for _, buf := range buffers {
+					encoded[i][j] = append(encoded[i][j], buf.Bytes()...)
+				}
+			}
 		}
-	}()
-
-	var srv Server
-	srv, err = NewServer("tcp", cfg.Graphite.Write.CarbonAddress, cfg.Graphite.Write.CompressType, logger)
-	assert.NoError(t, err, "error starting TCP server")
+		return encoded, counts
+	}
 
-	var wg sync.WaitGroup
-	wg.Add(1)
-	go func() {
-		err = srv.Run(&wg)
-		assert.NoError(t, err, "error running TCP server")
-		err = srv.Close()
-		assert.NoError(t, err, "error closing TCP server")
-	}()
-	wg.Wait()
+	for _, routing := range []graphiteconfig.RoutingType{graphiteconfig.RoutingShard, graphiteconfig.RoutingReplicate} {
+		t.Run(string(routing), func(t *testing.T) {
+			expected, expectedCounts := encode(1, routing)
+			total := 0
+			for _, count := range expectedCounts {
+				total += count
+			}
+			if routing == graphiteconfig.RoutingReplicate {
+				require.Equal(t, 2*len(series), total)
+			} else {
+				require.Equal(t, len(series), total)
+			}
 
-	file, err := os.Open("./testdata/req.sz")
-	assert.NoError(t, err)
+			// Shards are merged in order, datapoints of each connection are the same as when encoded sequentially.
+			encoded, counts := encode(4, routing)
+			require.Equal(t, expectedCounts, counts)
+			require.Equal(t, expected, encoded)
+		})
+	}
+}
 
-	defer file.Close()
-	stats, statsErr := file.Stat()
-	assert.NoError(t, statsErr)
-	var size = stats.Size()
-	metrics := make([]byte, size)
-	buffer := bufio.NewReader(file)
-	_, err = buffer.Read(metrics)
-	assert.NoError(t, err)
+func TestPathLimits(t *testing.T) {
+	// The path of the series fits the limit, the paths of its derived series do not.
+	long := strings.Repeat("x", 40)
+	series := histogramSeries("m", encodeHistogram(1, 1, nil, nil, 1000))
+	series.Labels = []prompb.Label{{Name: model.MetricNameLabel, Value: "m"}, {Name: "l", Value: long}}
+	series.Samples = []prompb.Sample{{Value: 1, Timestamp: 1000}, {Value: staleNaN, Timestamp: 2000}}
+	newClient := func(pathLimits *graphiteconfig.PathLimitsConfig) *Client {
+		cfg := config.DefaultConfig
+		cfg.Graphite.Write.CarbonAddress = "127.0.0.1:1"
+		cfg.Graphite.Write.EnablePathsCache = false
+		cfg.Graphite.Write.PathLimits = pathLimits
+		histograms := graphiteconfig.HistogramsConfig{
+			TagName: "stat",
+			Count:   graphiteconfig.HistogramSeriesConfig{Suffix: ".count"},
+			Buckets: graphiteconfig.HistogramSeriesConfig{Suffix: ".bucket"},
+		}
+		cfg.Graphite.Write.Histograms = &histograms
+		cfg.Graphite.Write.SpecialValues.Stale = graphiteconfig.SpecialValueConfig{Action: graphiteconfig.ActionMarker, Value: 1}
+		cfg.Graphite.Write.SpecialValues.MarkerSuffix = ".end"
+		client := NewClient(&cfg, log.NewNopLogger(), nil, nil)
+		t.Cleanup(client.Shutdown)
+		return client
+	}
+	limited := newClient(&graphiteconfig.PathLimitsConfig{MaxPathLength: 44})
+	// Limits are those of each client.
+	unlimited := newClient(nil)
+
+	response, err := writeSeries(limited, true, series)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(string(response), "\n"), "\n")
+	require.Len(t, lines, 4)
+	require.Equal(t, "m.l."+long+" 1.000000 1", lines[0])
+	for i, suffix := range []string{".end", ".count", ".bucket.+Inf"} {
+		path := strings.Fields(lines[i+1])[0]
+		require.LessOrEqual(t, len(path), 44, path)
+		require.True(t, strings.HasPrefix(path, "m.l.xxxx"), path)
+		require.True(t, strings.HasSuffix(path, suffix), path)
+		require.NotContains(t, path, long)
+	}
 
-	var inputBuffer []byte
-	inputBuffer, err = os.ReadFile("./testdata/sample.txt")
-	assert.NoError(t, err)
+	response, err = writeSeries(unlimited, true, series)
+	require.NoError(t, err)
+	require.Contains(t, string(response), "m.l."+long+".bucket.+Inf 0.000000 1\n")
+}
 
-	posturl := "http://" + cfg.Web.ListenAddress + "/write"
-	r, err := http.NewRequest("POST", posturl, bytes.NewBuffer(metrics))
-	assert.NoError(t, err)
+func TestWriteTransports(t *testing.T) {
+	tlsServer := httptest.NewTLSServer(nil)
+	defer tlsServer.Close()
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tlsServer.Certificate().Raw}), 0o600))
+
+	tests := []struct {
+		name      string
+		transport string
+		listen    func(t *testing.T) net.Listener
+		tls       *promconfig.TLSConfig
+	}{
+		{
+			name:      "tls",
+			transport: "tls",
+			listen: func(t *testing.T) net.Listener {
+				l, err := tls.Listen("tcp", "127.0.0.1:0", tlsServer.TLS)
+				require.NoError(t, err)
+				return l
+			},
+			// The certificate of the test server is valid for example.com.
+			tls: &promconfig.TLSConfig{CAFile: caFile, ServerName: "example.com"},
+		},
+		{
+			name:      "unix",
+			transport: "unix",
+			listen: func(t *testing.T) net.Listener {
+				l, err := net.Listen("unix", filepath.Join(t.TempDir(), "carbon.sock"))
+				require.NoError(t, err)
+				return l
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv := serveCarbon(t, test.listen(t))
+			cfg := config.DefaultConfig
+			cfg.Graphite.Write.CarbonAddress = srv.Addr()
+			cfg.Graphite.Write.CarbonTransport = test.transport
+			cfg.Graphite.Write.CarbonTLS = test.tls
+			client := NewClient(&cfg, log.NewNopLogger(), nil, nil)
+			defer client.Shutdown()
+
+			_, err := writeSeries(client, false,
+				testSeries("metric_a", prompb.Sample{Value: 1, Timestamp: 1000}),
+				testSeries("metric_b", prompb.Sample{Value: 2, Timestamp: 2000}))
+			require.NoError(t, err)
+			require.Equal(t, []string{"metric_a 1.000000 1", "metric_b 2.000000 2"}, srv.lines(t, 2))
+		})
+	}
+}
 
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		client := &http.Client{}
-		var res *http.Response
-		res, err = client.Do(r)
-		assert.NoError(t, err)
-		defer func(Body io.ReadCloser) {
-			respErr := Body.Close()
-			if respErr != nil {
-				_ = level.Error(logger).Log("err", respErr, "msg", "failed to close response body")
+func TestWriteTLSConfigError(t *testing.T) {
+	for _, transport := range []string{"tls", "http"} {
+		t.Run(transport, func(t *testing.T) {
+			srv := newCarbonServer(t)
+			cfg := config.DefaultConfig
+			cfg.Graphite.Write.CarbonAddress = srv.Addr()
+			if transport == "http" {
+				cfg.Graphite.Write.CarbonAddress = "https://" + srv.Addr()
 			}
-		}(res.Body)
-		assert.NotEmpty(t, res)
-		assert.Equal(t, http.StatusOK, res.StatusCode)
-	}()
-	wg.Wait()
-
-	b := make([]byte, len(inputBuffer))
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		reader := srv.(*TCPServer).reader
-		_, err = io.ReadFull(reader, b)
-		assert.NoError(t, err)
-	}()
-	wg.Wait()
-
-	assert.NotEmpty(t, b)
-	assert.True(t, len(inputBuffer) == len(b))
-	assert.True(t, bytes.Compare(inputBuffer, b) == 0)
+			cfg.Graphite.Write.CarbonTransport = transport
+			cfg.Graphite.Write.CarbonTLS = &promconfig.TLSConfig{CAFile: filepath.Join(t.TempDir(), "missing.crt")}
+			cfg.Graphite.Write.CarbonRetry.MaxRetries = 0
+			client := NewClient(&cfg, log.NewNopLogger(), nil, nil)
+			defer client.Shutdown()
+
+			// Writes fail rather than connect without the configured CA.
+			_, err := writeSeries(client, false, testSeries("metric", prompb.Sample{Value: 1, Timestamp: 1000}))
+			require.ErrorContains(t, err, "failed to load carbon TLS config")
+			srv.mtx.Lock()
+			defer srv.mtx.Unlock()
+			require.Empty(t, srv.conns)
+		})
+	}
 }
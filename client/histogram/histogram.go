@@ -0,0 +1,334 @@
+// Copyright 2024-2025 NetCracker Technology Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package histogram decodes the native histograms of remote write time series.
+//
+// The vendored prompb predates native histograms: they are kept, still encoded, in the
+// unrecognized fields of the time series, as field 4 of the remote write 1.0 TimeSeries.
+package histogram
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/Netcracker/qubership-graphite-remote-adapter/utils"
+	"github.com/prometheus/prometheus/prompb"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// timeSeriesField is the number of the histograms field of a remote write 1.0 TimeSeries.
+const timeSeriesField = 4
+
+// customBucketsSchema is the schema of histograms with custom bucket boundaries.
+const customBucketsSchema = -53
+
+var errInvalidHistogram = errors.New("invalid native histogram")
+
+// Span is a run of consecutive buckets. The offset of the first span is the index of its first bucket,
+// the offset of the other spans is the gap with the previous span.
+type Span struct {
+	Offset int32
+	Length uint32
+}
+
+// Histogram is a native histogram with absolute bucket counts, of integer and float histograms alike.
+type Histogram struct {
+	Count          float64
+	Sum            float64
+	Schema         int32
+	ZeroThreshold  float64
+	ZeroCount      float64
+	NegativeSpans  []Span
+	NegativeCounts []float64
+	PositiveSpans  []Span
+	PositiveCounts []float64
+	CustomValues   []float64
+	Timestamp      int64
+}
+
+// Bucket is a bucket of a histogram, holding the observations in (Lower, Upper].
+type Bucket struct {
+	Lower float64
+	Upper float64
+	Count float64
+}
+
+// AppendRaw appends an encoded histogram to the unrecognized fields of a time series.
+func AppendRaw(unrecognized []byte, raw []byte) []byte {
+	unrecognized = protowire.AppendTag(unrecognized, timeSeriesField, protowire.BytesType)
+	return protowire.AppendBytes(unrecognized, raw)
+}
+
+// Len returns the number of histograms of a time series, without decoding them.
+func Len(ts *prompb.TimeSeries) int {
+	n := 0
+	_ = utils.WalkFields(ts.XXX_unrecognized, func(num protowire.Number, typ protowire.Type, _ []byte) error {
+		if num == timeSeriesField && typ == protowire.BytesType {
+			n++
+		}
+		return nil
+	})
+	return n
+}
+
+// FromTimeSeries decodes the histograms of a time series.
+func FromTimeSeries(ts *prompb.TimeSeries) ([]Histogram, error) {
+	var histograms []Histogram
+	err := utils.WalkFields(ts.XXX_unrecognized, func(num protowire.Number, typ protowire.Type, b []byte) error {
+		if num != timeSeriesField || typ != protowire.BytesType {
+			return nil
+		}
+		h, err := Decode(b)
+		if err != nil {
+			return err
+		}
+		histograms = append(histograms, h)
+		return nil
+	})
+	return histograms, invalid(err)
+}
+
+// Decode decodes a Histogram message, of the remote write 1.0 and 2.0 protocols alike.
+func Decode(buf []byte) (Histogram, error) {
+	var h Histogram
+	var negativeDeltas, positiveDeltas []int64
+	err := utils.WalkFields(buf, func(num protowire.Number, typ protowire.Type, b []byte) error {
+		var err error
+		switch num {
+		case 1:
+			v, _ := protowire.ConsumeVarint(b)
+			h.Count = float64(v)
+		case 2:
+			h.Count = fixed64(b)
+		case 3:
+			h.Sum = fixed64(b)
+		case 4:
+			v, _ := protowire.ConsumeVarint(b)
+			h.Schema = int32(protowire.DecodeZigZag(v))
+		case 5:
+			h.ZeroThreshold = fixed64(b)
+		case 6:
+			v, _ := protowire.ConsumeVarint(b)
+			h.ZeroCount = float64(v)
+		case 7:
+			h.ZeroCount = fixed64(b)
+		case 8:
+			h.NegativeSpans, err = appendSpan(h.NegativeSpans, b)
+		case 9:
+			negativeDeltas, err = appendVarints(negativeDeltas, typ, b)
+		case 10:
+			h.NegativeCounts, err = appendDoubles(h.NegativeCounts, typ, b)
+		case 11:
+			h.PositiveSpans, err = appendSpan(h.PositiveSpans, b)
+		case 12:
+			positiveDeltas, err = appendVarints(positiveDeltas, typ, b)
+		case 13:
+			h.PositiveCounts, err = appendDoubles(h.PositiveCounts, typ, b)
+		case 15:
+			v, _ := protowire.ConsumeVarint(b)
+			h.Timestamp = int64(v)
+		case 16:
+			h.CustomValues, err = appendDoubles(h.CustomValues, typ, b)
+		}
+		return err
+	})
+	if err != nil {
+		return h, invalid(err)
+	}
+
+	// Integer histograms hold the difference with the count of the previous bucket.
+	h.NegativeCounts = appendDeltas(h.NegativeCounts, negativeDeltas)
+	h.PositiveCounts = appendDeltas(h.PositiveCounts, positiveDeltas)
+	if spansLen(h.NegativeSpans) != len(h.NegativeCounts) || spansLen(h.PositiveSpans) != len(h.PositiveCounts) {
+		return h, fmt.Errorf("%w: spans do not match the number of buckets", errInvalidHistogram)
+	}
+	if h.Schema == customBucketsSchema && len(h.NegativeSpans) > 0 {
+		return h, fmt.Errorf("%w: negative buckets with custom bucket boundaries", errInvalidHistogram)
+	}
+	if h.Schema != customBucketsSchema && (h.Schema < -4 || h.Schema > 8) {
+		return h, fmt.Errorf("%w: unsupported schema %d", errInvalidHistogram, h.Schema)
+	}
+	return h, nil
+}
+
+// Buckets returns the populated buckets of the histogram in increasing order of their boundaries.
+func (h *Histogram) Buckets() []Bucket {
+	var buckets []Bucket
+	negative := h.buckets(h.NegativeSpans, h.NegativeCounts)
+	for i := len(negative) - 1; i >= 0; i-- {
+		b := negative[i]
+		buckets = append(buckets, Bucket{Lower: -b.Upper, Upper: -b.Lower, Count: b.Count})
+	}
+	if h.ZeroCount > 0 {
+		lower := -h.ZeroThreshold
+		if len(negative) == 0 {
+			lower = 0
+		}
+		buckets = append(buckets, Bucket{Lower: lower, Upper: h.ZeroThreshold, Count: h.ZeroCount})
+	}
+	return append(buckets, h.buckets(h.PositiveSpans, h.PositiveCounts)...)
+}
+
+// buckets returns the buckets of spans with their boundaries, as positive buckets.
+func (h *Histogram) buckets(spans []Span, counts []float64) []Bucket {
+	var buckets []Bucket
+	var index int32
+	n := 0
+	for i, span := range spans {
+		if i == 0 {
+			index = span.Offset
+		} else {
+			index += span.Offset
+		}
+		for j := uint32(0); j < span.Length; j, index, n = j+1, index+1, n+1 {
+			if counts[n] == 0 {
+				continue
+			}
+			buckets = append(buckets, Bucket{Lower: h.bound(index - 1), Upper: h.bound(index), Count: counts[n]})
+		}
+	}
+	return buckets
+}
+
+// bound returns the upper boundary of the positive bucket of an index.
+func (h *Histogram) bound(index int32) float64 {
+	if h.Schema == customBucketsSchema {
+		switch {
+		case index < 0:
+			return math.Inf(-1)
+		case int(index) >= len(h.CustomValues):
+			return math.Inf(1)
+		default:
+			return h.CustomValues[index]
+		}
+	}
+	// Buckets boundaries are powers of 2^(2^-schema).
+	if h.Schema >= 0 {
+		return math.Exp2(float64(index) / float64(int64(1)<<h.Schema))
+	}
+	return math.Exp2(float64(index) * float64(int64(1)<<-h.Schema))
+}
+
+// Quantile estimates the q-quantile of the observations of the histogram, by linear interpolation
+// within the bucket holding it. It returns NaN when the histogram has no observations.
+func (h *Histogram) Quantile(q float64) float64 {
+	switch {
+	case h.Count == 0 || math.IsNaN(q):
+		return math.NaN()
+	case q < 0:
+		return math.Inf(-1)
+	case q > 1:
+		return math.Inf(1)
+	}
+
+	buckets := h.Buckets()
+	if len(buckets) == 0 {
+		return math.NaN()
+	}
+	rank := q * h.Count
+	cumulative := 0.0
+	for _, b := range buckets {
+		if cumulative+b.Count < rank {
+			cumulative += b.Count
+			continue
+		}
+		switch {
+		case math.IsInf(b.Upper, 1):
+			return b.Lower
+		case math.IsInf(b.Lower, -1):
+			return b.Upper
+		}
+		return b.Lower + (b.Upper-b.Lower)*(rank-cumulative)/b.Count
+	}
+	return buckets[len(buckets)-1].Upper
+}
+
+func spansLen(spans []Span) int {
+	n := 0
+	for _, span := range spans {
+		n += int(span.Length)
+	}
+	return n
+}
+
+func fixed64(b []byte) float64 {
+	v, _ := protowire.ConsumeFixed64(b)
+	return math.Float64frombits(v)
+}
+
+func appendSpan(spans []Span, buf []byte) ([]Span, error) {
+	var span Span
+	err := utils.WalkFields(buf, func(num protowire.Number, _ protowire.Type, b []byte) error {
+		v, _ := protowire.ConsumeVarint(b)
+		switch num {
+		case 1:
+			span.Offset = int32(protowire.DecodeZigZag(v))
+		case 2:
+			span.Length = uint32(v)
+		}
+		return nil
+	})
+	return append(spans, span), err
+}
+
+// appendVarints appends the values of a packed or unpacked repeated sint64 field.
+func appendVarints(values []int64, typ protowire.Type, b []byte) ([]int64, error) {
+	if typ == protowire.VarintType {
+		v, _ := protowire.ConsumeVarint(b)
+		return append(values, protowire.DecodeZigZag(v)), nil
+	}
+	for len(b) > 0 {
+		v, n := protowire.ConsumeVarint(b)
+		if n < 0 {
+			return nil, fmt.Errorf("%w: %v", errInvalidHistogram, protowire.ParseError(n))
+		}
+		values = append(values, protowire.DecodeZigZag(v))
+		b = b[n:]
+	}
+	return values, nil
+}
+
+// appendDoubles appends the values of a packed or unpacked repeated double field.
+func appendDoubles(values []float64, typ protowire.Type, b []byte) ([]float64, error) {
+	if typ == protowire.Fixed64Type {
+		return append(values, fixed64(b)), nil
+	}
+	if len(b)%8 != 0 {
+		return nil, fmt.Errorf("%w: truncated doubles", errInvalidHistogram)
+	}
+	for ; len(b) > 0; b = b[8:] {
+		values = append(values, fixed64(b))
+	}
+	return values, nil
+}
+
+// appendDeltas appends the absolute counts of integer buckets.
+func appendDeltas(counts []float64, deltas []int64) []float64 {
+	var count int64
+	for _, delta := range deltas {
+		count += delta
+		counts = append(counts, float64(count))
+	}
+	return counts
+}
+
+// invalid reports a histogram which is not a valid protobuf message as an invalid histogram.
+func invalid(err error) error {
+	if errors.Is(err, utils.ErrInvalidProtobuf) && !errors.Is(err, errInvalidHistogram) {
+		return fmt.Errorf("%w: %w", errInvalidHistogram, err)
+	}
+	return err
+}
@@ -0,0 +1,152 @@
+// Copyright 2024-2025 NetCracker Technology Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package histogram
+
+import (
+	"math"
+	"testing"
+
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func appendSpans(b []byte, num protowire.Number, spans []Span) []byte {
+	for _, span := range spans {
+		var s []byte
+		s = protowire.AppendTag(s, 1, protowire.VarintType)
+		s = protowire.AppendVarint(s, protowire.EncodeZigZag(int64(span.Offset)))
+		s = protowire.AppendTag(s, 2, protowire.VarintType)
+		s = protowire.AppendVarint(s, uint64(span.Length))
+		b = protowire.AppendTag(b, num, protowire.BytesType)
+		b = protowire.AppendBytes(b, s)
+	}
+	return b
+}
+
+// encodeIntHistogram encodes an integer histogram with packed bucket deltas.
+func encodeIntHistogram(count uint64, sum float64, schema int32, zeroCount uint64, spans []Span, deltas []int64, timestamp int64) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.VarintType)
+	b = protowire.AppendVarint(b, count)
+	b = protowire.AppendTag(b, 3, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, math.Float64bits(sum))
+	b = protowire.AppendTag(b, 4, protowire.VarintType)
+	b = protowire.AppendVarint(b, protowire.EncodeZigZag(int64(schema)))
+	b = protowire.AppendTag(b, 5, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, math.Float64bits(0.001))
+	b = protowire.AppendTag(b, 6, protowire.VarintType)
+	b = protowire.AppendVarint(b, zeroCount)
+	b = appendSpans(b, 11, spans)
+	var packed []byte
+	for _, d := range deltas {
+		packed = protowire.AppendVarint(packed, protowire.EncodeZigZag(d))
+	}
+	b = protowire.AppendTag(b, 12, protowire.BytesType)
+	b = protowire.AppendBytes(b, packed)
+	b = protowire.AppendTag(b, 15, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(timestamp))
+}
+
+// encodeFloatHistogram encodes a float histogram with custom bucket boundaries.
+func encodeFloatHistogram(count, sum float64, spans []Span, counts []float64, customValues []float64) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 2, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, math.Float64bits(count))
+	b = protowire.AppendTag(b, 3, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, math.Float64bits(sum))
+	b = protowire.AppendTag(b, 4, protowire.VarintType)
+	b = protowire.AppendVarint(b, protowire.EncodeZigZag(customBucketsSchema))
+	b = appendSpans(b, 11, spans)
+	var packed []byte
+	for _, c := range counts {
+		packed = protowire.AppendFixed64(packed, math.Float64bits(c))
+	}
+	b = protowire.AppendTag(b, 13, protowire.BytesType)
+	b = protowire.AppendBytes(b, packed)
+	packed = nil
+	for _, v := range customValues {
+		packed = protowire.AppendFixed64(packed, math.Float64bits(v))
+	}
+	b = protowire.AppendTag(b, 16, protowire.BytesType)
+	return protowire.AppendBytes(b, packed)
+}
+
+func TestDecodeIntHistogram(t *testing.T) {
+	// Buckets (1,2], (2,4] and (8,16] holding 2, 4 and 3 observations.
+	raw := encodeIntHistogram(10, 42, 0, 1, []Span{{Offset: 1, Length: 2}, {Offset: 1, Length: 1}}, []int64{2, 2, -1}, 1600000000000)
+	h, err := Decode(raw)
+	require.NoError(t, err)
+	require.Equal(t, 10.0, h.Count)
+	require.Equal(t, 42.0, h.Sum)
+	require.Equal(t, int64(1600000000000), h.Timestamp)
+	require.Equal(t, []float64{2, 4, 3}, h.PositiveCounts)
+	require.Equal(t, []Bucket{
+		{Lower: 0, Upper: 0.001, Count: 1},
+		{Lower: 1, Upper: 2, Count: 2},
+		{Lower: 2, Upper: 4, Count: 4},
+		{Lower: 8, Upper: 16, Count: 3},
+	}, h.Buckets())
+
+	require.Equal(t, 1.5, h.Quantile(0.2))
+	require.Equal(t, 3.0, h.Quantile(0.5))
+	require.InDelta(t, 13.3333, h.Quantile(0.9), 1e-4)
+	require.Equal(t, 16.0, h.Quantile(1))
+	require.True(t, math.IsInf(h.Quantile(2), 1))
+}
+
+func TestDecodeFloatHistogramCustomBuckets(t *testing.T) {
+	// Buckets (-Inf,0.1], (0.1,0.5], (0.5,1] and (1,+Inf].
+	raw := encodeFloatHistogram(8, 3.5, []Span{{Offset: 0, Length: 4}}, []float64{2, 4, 0, 2}, []float64{0.1, 0.5, 1})
+	h, err := Decode(raw)
+	require.NoError(t, err)
+	require.Equal(t, []Bucket{
+		{Lower: math.Inf(-1), Upper: 0.1, Count: 2},
+		{Lower: 0.1, Upper: 0.5, Count: 4},
+		{Lower: 1, Upper: math.Inf(1), Count: 2},
+	}, h.Buckets())
+	require.Equal(t, 0.1, h.Quantile(0.1))
+	require.InDelta(t, 0.3, h.Quantile(0.5), 1e-9)
+	require.Equal(t, 1.0, h.Quantile(0.99))
+}
+
+func TestFromTimeSeries(t *testing.T) {
+	ts := &prompb.TimeSeries{}
+	require.Zero(t, Len(ts))
+
+	ts.XXX_unrecognized = AppendRaw(ts.XXX_unrecognized, encodeIntHistogram(0, 0, 3, 0, nil, nil, 1000))
+	ts.XXX_unrecognized = AppendRaw(ts.XXX_unrecognized, encodeIntHistogram(1, 2, 3, 0, []Span{{Offset: 8, Length: 1}}, []int64{1}, 2000))
+	require.Equal(t, 2, Len(ts))
+
+	histograms, err := FromTimeSeries(ts)
+	require.NoError(t, err)
+	require.Len(t, histograms, 2)
+	require.True(t, math.IsNaN(histograms[0].Quantile(0.5)))
+	// With schema 3, the bucket of index 8 is (2^(7/8),2].
+	require.Equal(t, []Bucket{{Lower: math.Exp2(7.0 / 8), Upper: 2, Count: 1}}, histograms[1].Buckets())
+	require.Equal(t, int64(2000), histograms[1].Timestamp)
+}
+
+func TestDecodeInvalidHistogram(t *testing.T) {
+	_, err := Decode(encodeIntHistogram(1, 1, 0, 0, []Span{{Offset: 0, Length: 2}}, []int64{1}, 0))
+	require.ErrorIs(t, err, errInvalidHistogram)
+
+	_, err = Decode(encodeIntHistogram(1, 1, 9, 0, nil, nil, 0))
+	require.ErrorIs(t, err, errInvalidHistogram)
+
+	_, err = Decode([]byte{0x0a, 0x05})
+	require.ErrorIs(t, err, errInvalidHistogram)
+}
@@ -16,9 +16,9 @@
 package client
 
 import (
+	"context"
 	"net/http"
 
-	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/prompb"
 )
 
@@ -30,9 +30,10 @@ type Client interface {
 	Shutdown()
 }
 
-// Writer is a client that sends a batch of samples to remote.
+// Writer is a client that sends a batch of time series to remote.
+// The time series of req must not be retained once Write returns, their request may be reused.
 type Writer interface {
-	Write(samples model.Samples, reqBufLen int, r *http.Request, dryRun bool) ([]byte, error)
+	Write(ctx context.Context, req *prompb.WriteRequest, r *http.Request, dryRun bool) ([]byte, error)
 	Client
 }
 
@@ -0,0 +1,210 @@
+// Copyright 2024-2025 NetCracker Technology Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package metadata keeps the metadata of the metric families received with remote write requests.
+package metadata
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// Types of metric families.
+const (
+	TypeUnknown        = "unknown"
+	TypeCounter        = "counter"
+	TypeGauge          = "gauge"
+	TypeHistogram      = "histogram"
+	TypeGaugeHistogram = "gaugehistogram"
+	TypeSummary        = "summary"
+	TypeInfo           = "info"
+	TypeStateset       = "stateset"
+)
+
+// Types lists the types of metric families, in the order of their remote write enumeration.
+var Types = []string{TypeUnknown, TypeCounter, TypeGauge, TypeHistogram, TypeGaugeHistogram, TypeSummary, TypeInfo, TypeStateset}
+
+// typeSuffixes are the suffixes of the series names of metric families, by type.
+var typeSuffixes = map[string][]string{
+	TypeCounter:        {"_total", "_created"},
+	TypeHistogram:      {"_bucket", "_sum", "_count", "_created"},
+	TypeGaugeHistogram: {"_bucket", "_gsum", "_gcount"},
+	TypeSummary:        {"_sum", "_count", "_created"},
+	TypeInfo:           {"_info"},
+}
+
+// seriesSuffixes are all the suffixes of typeSuffixes.
+var seriesSuffixes = []string{"_total", "_created", "_bucket", "_sum", "_count", "_gsum", "_gcount", "_info"}
+
+// Metadata describes a metric family.
+type Metadata struct {
+	Type string `json:"type"`
+	Help string `json:"help"`
+	Unit string `json:"unit"`
+}
+
+// TypeFromProto returns the type of a remote write metric type, which is unknown when out of range.
+func TypeFromProto(t prompb.MetricMetadata_MetricType) string {
+	if t < 0 || int(t) >= len(Types) {
+		return TypeUnknown
+	}
+	return Types[t]
+}
+
+// FamilyName returns the name of the metric family of a series of the type, without the suffix
+// telling apart the series of the family.
+func FamilyName(name, typ string) string {
+	for _, suffix := range typeSuffixes[typ] {
+		if strings.HasSuffix(name, suffix) && len(name) > len(suffix) {
+			return name[:len(name)-len(suffix)]
+		}
+	}
+	return name
+}
+
+// Cache holds the metadata of metric families by name. Lookups do not take locks: updates replace
+// the families with a copy, which is only made when the metadata of a family changes.
+type Cache struct {
+	mu          sync.Mutex
+	families    atomic.Pointer[map[string]Metadata]
+	maxFamilies atomic.Int64
+}
+
+// NewCache returns an empty cache of at most maxFamilies families, 0 meaning no limit.
+func NewCache(maxFamilies int) *Cache {
+	c := &Cache{}
+	c.families.Store(&map[string]Metadata{})
+	c.SetMaxFamilies(maxFamilies)
+	return c
+}
+
+// SetMaxFamilies sets the maximum number of families, 0 meaning no limit.
+// Families already cached are kept.
+func (c *Cache) SetMaxFamilies(maxFamilies int) {
+	c.maxFamilies.Store(int64(maxFamilies))
+}
+
+// Len returns the number of families.
+func (c *Cache) Len() int {
+	return len(*c.families.Load())
+}
+
+// Update records the metadata of metric families. Families above the limit are not recorded,
+// their number is returned.
+func (c *Cache) Update(mds []prompb.MetricMetadata) int {
+	if !c.changed(*c.families.Load(), mds) {
+		return 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	families := *c.families.Load()
+	if !c.changed(families, mds) {
+		return 0
+	}
+	updated := make(map[string]Metadata, len(families)+1)
+	for name, md := range families {
+		updated[name] = md
+	}
+	maxFamilies := int(c.maxFamilies.Load())
+	dropped := 0
+	for i := range mds {
+		name := mds[i].MetricFamilyName
+		if name == "" {
+			continue
+		}
+		if _, ok := updated[name]; !ok && maxFamilies > 0 && len(updated) >= maxFamilies {
+			dropped++
+			continue
+		}
+		updated[name] = fromProto(&mds[i])
+	}
+	c.families.Store(&updated)
+	return dropped
+}
+
+// changed tells whether the metadata of a family differ from families.
+func (c *Cache) changed(families map[string]Metadata, mds []prompb.MetricMetadata) bool {
+	for i := range mds {
+		if mds[i].MetricFamilyName == "" {
+			continue
+		}
+		if md, ok := families[mds[i].MetricFamilyName]; !ok || md != fromProto(&mds[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Lookup returns the metadata of the family of a series name: the family of the same name, or the
+// family named without the suffix of the series, if such series belong to families of its type.
+func (c *Cache) Lookup(name string) (Metadata, bool) {
+	families := *c.families.Load()
+	if len(families) == 0 {
+		return Metadata{}, false
+	}
+	if md, ok := families[name]; ok {
+		return md, true
+	}
+	for _, suffix := range seriesSuffixes {
+		if !strings.HasSuffix(name, suffix) {
+			continue
+		}
+		md, ok := families[name[:len(name)-len(suffix)]]
+		if !ok {
+			continue
+		}
+		for _, s := range typeSuffixes[md.Type] {
+			if s == suffix {
+				return md, true
+			}
+		}
+	}
+	return Metadata{}, false
+}
+
+// Families returns the metadata of the family named metric, or of all the families when empty.
+// When limit is positive, at most limit families are returned, the first ones by name.
+func (c *Cache) Families(metric string, limit int) map[string]Metadata {
+	families := *c.families.Load()
+	var names []string
+	if metric != "" {
+		if _, ok := families[metric]; ok {
+			names = append(names, metric)
+		}
+	} else {
+		names = make([]string, 0, len(families))
+		for name := range families {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	if limit > 0 && len(names) > limit {
+		names = names[:limit]
+	}
+	result := make(map[string]Metadata, len(names))
+	for _, name := range names {
+		result[name] = families[name]
+	}
+	return result
+}
+
+func fromProto(md *prompb.MetricMetadata) Metadata {
+	return Metadata{Type: TypeFromProto(md.Type), Help: md.Help, Unit: md.Unit}
+}
@@ -0,0 +1,88 @@
+// Copyright 2024-2025 NetCracker Technology Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package metadata
+
+import (
+	"testing"
+
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheLookup(t *testing.T) {
+	c := NewCache(0)
+	_, ok := c.Lookup("http_requests_total")
+	require.False(t, ok)
+
+	dropped := c.Update([]prompb.MetricMetadata{
+		{Type: prompb.MetricMetadata_COUNTER, MetricFamilyName: "http_requests_total", Help: "Requests."},
+		{Type: prompb.MetricMetadata_HISTOGRAM, MetricFamilyName: "http_latency", Unit: "seconds"},
+		{Type: prompb.MetricMetadata_GAUGE, MetricFamilyName: "queue"},
+		{Type: prompb.MetricMetadata_COUNTER, MetricFamilyName: "events"},
+	})
+	require.Zero(t, dropped)
+	require.Equal(t, 4, c.Len())
+
+	md, ok := c.Lookup("http_requests_total")
+	require.True(t, ok)
+	require.Equal(t, Metadata{Type: TypeCounter, Help: "Requests."}, md)
+
+	md, ok = c.Lookup("http_latency_bucket")
+	require.True(t, ok)
+	require.Equal(t, Metadata{Type: TypeHistogram, Unit: "seconds"}, md)
+
+	md, ok = c.Lookup("events_total")
+	require.True(t, ok)
+	require.Equal(t, TypeCounter, md.Type)
+
+	// Gauges have no series suffixes.
+	_, ok = c.Lookup("queue_count")
+	require.False(t, ok)
+}
+
+func TestCacheUpdate(t *testing.T) {
+	c := NewCache(2)
+	md := []prompb.MetricMetadata{
+		{Type: prompb.MetricMetadata_GAUGE, MetricFamilyName: "a"},
+		{Type: prompb.MetricMetadata_GAUGE, MetricFamilyName: "b"},
+		{Type: prompb.MetricMetadata_GAUGE, MetricFamilyName: "c"},
+		{Type: prompb.MetricMetadata_GAUGE},
+	}
+	require.Equal(t, 1, c.Update(md))
+	require.Equal(t, 2, c.Len())
+
+	// Families already cached are still updated at the limit.
+	require.Zero(t, c.Update([]prompb.MetricMetadata{{Type: prompb.MetricMetadata_SUMMARY, MetricFamilyName: "a"}}))
+	md2, ok := c.Lookup("a")
+	require.True(t, ok)
+	require.Equal(t, TypeSummary, md2.Type)
+
+	c.SetMaxFamilies(0)
+	require.Zero(t, c.Update(md))
+	require.Equal(t, map[string]Metadata{"a": {Type: TypeGauge}, "b": {Type: TypeGauge}}, c.Families("", 2))
+	require.Equal(t, map[string]Metadata{"c": {Type: TypeGauge}}, c.Families("c", 0))
+	require.Empty(t, c.Families("d", 0))
+	require.Len(t, c.Families("", 0), 3)
+}
+
+func TestFamilyName(t *testing.T) {
+	require.Equal(t, "http_latency", FamilyName("http_latency_bucket", TypeHistogram))
+	require.Equal(t, "requests", FamilyName("requests_total", TypeCounter))
+	require.Equal(t, "queue_count", FamilyName("queue_count", TypeGauge))
+	require.Equal(t, "_sum", FamilyName("_sum", TypeSummary))
+	require.Equal(t, TypeUnknown, TypeFromProto(prompb.MetricMetadata_MetricType(42)))
+	require.Equal(t, TypeStateset, TypeFromProto(prompb.MetricMetadata_STATESET))
+}
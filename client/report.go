@@ -0,0 +1,68 @@
+// Copyright 2024-2025 NetCracker Technology Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package client
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type writeReportKey struct{}
+
+// DestinationReport is the outcome of a write to a single destination of a Writer.
+type DestinationReport struct {
+	Target   string
+	Samples  int
+	Duration time.Duration
+	Err      error
+}
+
+// WriteReport collects the outcome of a write for each destination of a Writer.
+// Writers sending to a single remote may leave it empty.
+type WriteReport struct {
+	lock         sync.Mutex
+	destinations []DestinationReport
+}
+
+// WithWriteReport returns a context carrying a new WriteReport to be filled by writers.
+func WithWriteReport(ctx context.Context) (context.Context, *WriteReport) {
+	report := &WriteReport{}
+	return context.WithValue(ctx, writeReportKey{}, report), report
+}
+
+// WriteReportFromContext returns the WriteReport carried by ctx, or nil.
+func WriteReportFromContext(ctx context.Context) *WriteReport {
+	report, _ := ctx.Value(writeReportKey{}).(*WriteReport)
+	return report
+}
+
+// Add records the outcome of a write to one destination. It is safe to call on a nil report.
+func (r *WriteReport) Add(d DestinationReport) {
+	if r == nil {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.destinations = append(r.destinations, d)
+}
+
+// Destinations returns the reported destinations.
+func (r *WriteReport) Destinations() []DestinationReport {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]DestinationReport(nil), r.destinations...)
+}
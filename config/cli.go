@@ -51,6 +51,16 @@ func ParseCommandLine() *Config {
 		Default(DefaultConfig.Write.Timeout.String()).
 		DurationVar(&cfg.Write.Timeout)
 
+	a.Flag("write.max-inflight-bytes",
+		"Maximum size of the decoded remote write requests being processed. Requests above are rejected with 429 Too Many Requests. Default is 0, no limit").
+		Default("0").
+		Int64Var(&cfg.Write.MaxInflightBytes)
+
+	a.Flag("write.max-metadata-families",
+		"Maximum number of metric families whose metadata are kept. Metadata of other families are dropped. Default is 0, no limit").
+		Default("0").
+		IntVar(&cfg.Write.MaxMetadataFamilies)
+
 	a.Flag("read.timeout",
 		"Maximum duration before timing out remote read requests. Default is 5m").
 		Default(DefaultConfig.Read.Timeout.String()).
@@ -154,6 +154,10 @@ func (opts *readOptions) UnmarshalYAML(unmarshal func(interface{}) error) error
 
 type writeOptions struct {
 	Timeout time.Duration `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	// Maximum size of the decoded remote write requests being processed, 0 means no limit.
+	MaxInflightBytes int64 `yaml:"max_inflight_bytes,omitempty" json:"max_inflight_bytes,omitempty"`
+	// Maximum number of metric families whose metadata are kept, 0 means no limit.
+	MaxMetadataFamilies int `yaml:"max_metadata_families,omitempty" json:"max_metadata_families,omitempty"`
 
 	// Catches all undefined fields and must be empty after parsing.
 	XXX map[string]interface{} `yaml:",inline" json:"-"`
@@ -167,6 +171,9 @@ func (opts *writeOptions) UnmarshalYAML(unmarshal func(interface{}) error) error
 	if err := unmarshal((*plain)(opts)); err != nil {
 		return err
 	}
+	if opts.MaxMetadataFamilies < 0 {
+		return fmt.Errorf("max_metadata_families must not be negative, got %d", opts.MaxMetadataFamilies)
+	}
 
 	return utils.CheckOverflow(opts.XXX, "writeOptions")
 }
@@ -0,0 +1,236 @@
+// Copyright 2024-2025 NetCracker Technology Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package lz4
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	minMatch     = 4
+	lastLiterals = 5  // the last bytes of a block are always literals
+	mfLimit      = 12 // the last match starts at least mfLimit bytes before the end of a block
+	maxOffset    = 65535
+	hashLog      = 16
+	// niceMatch stops the search for a longer match.
+	niceMatch = 1 << 10
+)
+
+var errCorruptBlock = errors.New("lz4: corrupt block")
+
+// blockCompressor compresses lz4 blocks with a hash chain matcher.
+// Its tables are reused between blocks.
+type blockCompressor struct {
+	depth  int // number of candidates compared at each position
+	minLen int // shortest match emitted
+	table  []int32
+	chain  []uint16
+}
+
+// newBlockCompressor returns a compressor for a compression level of liblz4:
+// levels below 3 only look at the last position with the same hash,
+// higher levels search twice as many candidates per level.
+func newBlockCompressor(level int, favorDecSpeed bool) *blockCompressor {
+	depth := 1
+	if level >= 3 {
+		if level > 12 {
+			level = 12
+		}
+		depth = 1 << (level - 2)
+	}
+	minLen := minMatch
+	if favorDecSpeed && level >= 10 {
+		// Fewer, longer sequences are faster to decode.
+		minLen = 2 * minMatch
+	}
+	return &blockCompressor{
+		depth:  depth,
+		minLen: minLen,
+		table:  make([]int32, 1<<hashLog),
+		chain:  make([]uint16, maxOffset+1),
+	}
+}
+
+func hash4(u uint32) uint32 {
+	return (u * 2654435761) >> (32 - hashLog)
+}
+
+func (bc *blockCompressor) insert(src []byte, i int) {
+	h := hash4(binary.LittleEndian.Uint32(src[i:]))
+	var delta uint16
+	if prev := int(bc.table[h]) - 1; prev >= 0 && i-prev <= maxOffset {
+		delta = uint16(i - prev)
+	}
+	bc.chain[i&maxOffset] = delta
+	bc.table[h] = int32(i + 1)
+}
+
+// compress appends the lz4 block of src[start:] to dst.
+// src[:start] is the history matches may reference, at most the previous 64KB of a linked block.
+func (bc *blockCompressor) compress(dst, src []byte, start int) []byte {
+	clear(bc.table)
+	end := len(src)
+	if end-start < mfLimit+1 {
+		return appendLastLiterals(dst, src[start:])
+	}
+	for i := max(0, start-maxOffset); i < start; i++ {
+		bc.insert(src, i)
+	}
+
+	anchor := start
+	matchLimit := end - lastLiterals
+	for i := start; i < end-mfLimit; {
+		cur := binary.LittleEndian.Uint32(src[i:])
+		bestLen, bestPos := 0, 0
+		c := int(bc.table[hash4(cur)]) - 1
+		for n := 0; n < bc.depth && c >= 0 && i-c <= maxOffset; n++ {
+			// A longer match must also match at bestLen.
+			if (bestLen == 0 || (i+bestLen < matchLimit && src[c+bestLen] == src[i+bestLen])) &&
+				binary.LittleEndian.Uint32(src[c:]) == cur {
+				l := minMatch
+				for i+l < matchLimit && src[c+l] == src[i+l] {
+					l++
+				}
+				if l > bestLen {
+					bestLen, bestPos = l, c
+					if l >= niceMatch {
+						break
+					}
+				}
+			}
+			delta := int(bc.chain[c&maxOffset])
+			if delta == 0 {
+				break
+			}
+			c -= delta
+		}
+		if bestLen < bc.minLen {
+			bc.insert(src, i)
+			i++
+			continue
+		}
+		// Extend the match backwards over pending literals.
+		for i > anchor && bestPos > 0 && src[i-1] == src[bestPos-1] {
+			i--
+			bestPos--
+			bestLen++
+		}
+		dst = appendSequence(dst, src[anchor:i], i-bestPos, bestLen)
+		next := i + bestLen
+		for ; i < next && i < end-minMatch; i++ {
+			bc.insert(src, i)
+		}
+		i = next
+		anchor = i
+	}
+	return appendLastLiterals(dst, src[anchor:])
+}
+
+func appendLength(dst []byte, n int) []byte {
+	for ; n >= 255; n -= 255 {
+		dst = append(dst, 255)
+	}
+	return append(dst, byte(n))
+}
+
+func appendSequence(dst, literals []byte, offset, matchLen int) []byte {
+	ml := matchLen - minMatch
+	dst = append(dst, byte(min(len(literals), 15))<<4|byte(min(ml, 15)))
+	if len(literals) >= 15 {
+		dst = appendLength(dst, len(literals)-15)
+	}
+	dst = append(dst, literals...)
+	dst = append(dst, byte(offset), byte(offset>>8))
+	if ml >= 15 {
+		dst = appendLength(dst, ml-15)
+	}
+	return dst
+}
+
+func appendLastLiterals(dst, literals []byte) []byte {
+	dst = append(dst, byte(min(len(literals), 15))<<4)
+	if len(literals) >= 15 {
+		dst = appendLength(dst, len(literals)-15)
+	}
+	return append(dst, literals...)
+}
+
+// decompressBlock appends the decompressed lz4 block src to dst, which holds the history
+// matches may reference. It fails if the block decompresses to more than maxSize bytes.
+func decompressBlock(dst, src []byte, maxSize int) ([]byte, error) {
+	limit := len(dst) + maxSize
+	readLength := func(i, n int) (int, int, error) {
+		for {
+			if i >= len(src) {
+				return i, n, errCorruptBlock
+			}
+			b := src[i]
+			i++
+			n += int(b)
+			if b != 255 {
+				return i, n, nil
+			}
+		}
+	}
+
+	var err error
+	for i := 0; i < len(src); {
+		token := src[i]
+		i++
+		literals := int(token >> 4)
+		if literals == 15 {
+			if i, literals, err = readLength(i, literals); err != nil {
+				return dst, err
+			}
+		}
+		if literals > len(src)-i || literals > limit-len(dst) {
+			return dst, errCorruptBlock
+		}
+		dst = append(dst, src[i:i+literals]...)
+		i += literals
+		if i == len(src) {
+			return dst, nil
+		}
+
+		if i+2 > len(src) {
+			return dst, errCorruptBlock
+		}
+		offset := int(src[i]) | int(src[i+1])<<8
+		i += 2
+		matchLen := int(token & 15)
+		if matchLen == 15 {
+			if i, matchLen, err = readLength(i, matchLen); err != nil {
+				return dst, err
+			}
+		}
+		matchLen += minMatch
+		if offset == 0 || offset > len(dst) || matchLen > limit-len(dst) {
+			return dst, errCorruptBlock
+		}
+		pos := len(dst) - offset
+		if offset >= matchLen {
+			dst = append(dst, dst[pos:pos+matchLen]...)
+			continue
+		}
+		// Overlapping match, repeats the last offset bytes.
+		for ; matchLen > 0; matchLen-- {
+			dst = append(dst, dst[pos])
+			pos++
+		}
+	}
+	return dst, errCorruptBlock
+}
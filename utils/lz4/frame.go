@@ -0,0 +1,371 @@
+// Copyright 2024-2025 NetCracker Technology Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package lz4
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/config"
+)
+
+const (
+	frameMagic         uint32 = 0x184D2204
+	skippableMagic     uint32 = 0x184D2A50
+	skippableMagicMask uint32 = 0xFFFFFFF0
+	uncompressedBlock  uint32 = 1 << 31
+	historySize               = 64 << 10
+
+	flagVersion         = 0x40
+	flagBlockIndep      = 0x20
+	flagBlockChecksum   = 0x10
+	flagContentSize     = 0x08
+	flagContentChecksum = 0x04
+	flagDictID          = 0x01
+)
+
+var (
+	errCorruptFrame     = errors.New("lz4: corrupt frame")
+	errChecksumMismatch = errors.New("lz4: checksum mismatch")
+)
+
+// frameOptions are the lz4 frame parameters set by config.LZ4Preferences.
+type frameOptions struct {
+	blockSizeID     byte
+	independent     bool
+	blockChecksum   bool
+	contentChecksum bool
+	level           int
+	autoFlush       bool
+	favorDecSpeed   bool
+}
+
+// newFrameOptions applies cfg with the same defaults as liblz4.
+func newFrameOptions(cfg *config.LZ4Preferences) frameOptions {
+	opts := frameOptions{blockSizeID: 4, level: config.LZ4CompressLevelDefault}
+	if cfg == nil {
+		return opts
+	}
+	opts.level = cfg.CompressionLevel
+	opts.autoFlush = cfg.AutoFlush
+	opts.favorDecSpeed = cfg.DecompressionSpeed
+	if cfg.FrameInfo != nil {
+		switch cfg.FrameInfo.BlockSizeID {
+		case config.LZ4fBlockSizeMax256kb:
+			opts.blockSizeID = 5
+		case config.LZ4fBlockSizeMax1mb:
+			opts.blockSizeID = 6
+		case config.LZ4fBlockSizeMax4mb:
+			opts.blockSizeID = 7
+		}
+		opts.independent = cfg.FrameInfo.BlockMode
+		opts.blockChecksum = cfg.FrameInfo.BlockChecksumFlag
+		opts.contentChecksum = cfg.FrameInfo.ContentChecksumFlag
+	}
+	return opts
+}
+
+// blockSize returns the maximum size of a block with the block size id.
+func blockSize(id byte) int {
+	return 1 << (8 + 2*int(id))
+}
+
+// frameEncoder encodes lz4 frames in pure Go, a frame is started with begin,
+// fed with update and ended with end.
+type frameEncoder struct {
+	opts       frameOptions
+	compressor *blockCompressor
+	blockSize  int
+	// window holds the history of linked blocks followed by the pending block.
+	window  []byte
+	pending int
+	content *xxh32
+}
+
+func newFrameEncoder(opts frameOptions) *frameEncoder {
+	return &frameEncoder{
+		opts:       opts,
+		compressor: newBlockCompressor(opts.level, opts.favorDecSpeed),
+		blockSize:  blockSize(opts.blockSizeID),
+		content:    newXXH32(),
+	}
+}
+
+// begin appends the frame header to dst.
+func (e *frameEncoder) begin(dst []byte) []byte {
+	e.window = e.window[:0]
+	e.pending = 0
+	e.content.Reset()
+
+	flg := byte(flagVersion)
+	if e.opts.independent {
+		flg |= flagBlockIndep
+	}
+	if e.opts.blockChecksum {
+		flg |= flagBlockChecksum
+	}
+	if e.opts.contentChecksum {
+		flg |= flagContentChecksum
+	}
+	dst = binary.LittleEndian.AppendUint32(dst, frameMagic)
+	descriptor := []byte{flg, e.opts.blockSizeID << 4}
+	dst = append(dst, descriptor...)
+	return append(dst, byte(checksum32(descriptor)>>8))
+}
+
+// update appends the blocks filled by src to dst. The last partial block is kept
+// for the next update unless auto flush is set.
+func (e *frameEncoder) update(dst, src []byte) []byte {
+	for len(src) > 0 {
+		n := min(len(src), e.blockSize-e.pending)
+		e.window = append(e.window, src[:n]...)
+		e.pending += n
+		src = src[n:]
+		if e.pending == e.blockSize {
+			dst = e.flush(dst)
+		}
+	}
+	if e.opts.autoFlush {
+		dst = e.flush(dst)
+	}
+	return dst
+}
+
+// flush appends the pending block to dst.
+func (e *frameEncoder) flush(dst []byte) []byte {
+	if e.pending == 0 {
+		return dst
+	}
+	start := len(e.window) - e.pending
+	data := e.window[start:]
+
+	sizePos := len(dst)
+	dst = append(dst, 0, 0, 0, 0)
+	dst = e.compressor.compress(dst, e.window, start)
+	size := uint32(len(dst) - sizePos - 4)
+	if int(size) >= len(data) {
+		// Incompressible data is stored as is.
+		dst = append(dst[:sizePos+4], data...)
+		size = uint32(len(data)) | uncompressedBlock
+	}
+	binary.LittleEndian.PutUint32(dst[sizePos:], size)
+	if e.opts.blockChecksum {
+		dst = binary.LittleEndian.AppendUint32(dst, checksum32(dst[sizePos+4:]))
+	}
+	if e.opts.contentChecksum {
+		_, _ = e.content.Write(data)
+	}
+
+	e.pending = 0
+	if e.opts.independent {
+		e.window = e.window[:0]
+	} else if len(e.window) > historySize {
+		e.window = e.window[:copy(e.window, e.window[len(e.window)-historySize:])]
+	}
+	return dst
+}
+
+// end appends the pending block, the end mark and the content checksum to dst.
+func (e *frameEncoder) end(dst []byte) []byte {
+	dst = e.flush(dst)
+	dst = binary.LittleEndian.AppendUint32(dst, 0)
+	if e.opts.contentChecksum {
+		dst = binary.LittleEndian.AppendUint32(dst, e.content.Sum32())
+	}
+	return dst
+}
+
+// frameDecoder decodes a stream of concatenated lz4 frames in pure Go.
+type frameDecoder struct {
+	reader *bufio.Reader
+	buf    [8]byte
+
+	inFrame         bool
+	flags           byte
+	blockSize       int
+	contentSize     uint64
+	decompressed    uint64
+	content         *xxh32
+	compressedBlock []byte
+	// out holds the history of linked blocks followed by the last decoded block.
+	out []byte
+}
+
+func newFrameDecoder(reader io.Reader, bufferSize int) *frameDecoder {
+	return &frameDecoder{
+		reader:  bufio.NewReaderSize(reader, bufferSize),
+		content: newXXH32(),
+	}
+}
+
+func (d *frameDecoder) readUint32() (uint32, error) {
+	if _, err := io.ReadFull(d.reader, d.buf[:4]); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(d.buf[:4]), nil
+}
+
+// readHeader reads the header of the next frame, skipping skippable frames.
+// It returns io.EOF at the end of the stream.
+func (d *frameDecoder) readHeader() error {
+	for {
+		magic, err := d.readUint32()
+		if err != nil {
+			return err
+		}
+		if magic&skippableMagicMask == skippableMagic {
+			size, err := d.readUint32()
+			if err != nil {
+				return unexpectedEOF(err)
+			}
+			if _, err = d.reader.Discard(int(size)); err != nil {
+				return unexpectedEOF(err)
+			}
+			continue
+		}
+		if magic != frameMagic {
+			return fmt.Errorf("%w: unknown magic number %#x", errCorruptFrame, magic)
+		}
+		break
+	}
+
+	descriptor := make([]byte, 2, 14)
+	if _, err := io.ReadFull(d.reader, descriptor); err != nil {
+		return unexpectedEOF(err)
+	}
+	flg, bd := descriptor[0], descriptor[1]
+	if flg&0xC0 != flagVersion || flg&0x02 != 0 || bd&0x8F != 0 {
+		return fmt.Errorf("%w: invalid frame descriptor", errCorruptFrame)
+	}
+	if flg&flagDictID != 0 {
+		return fmt.Errorf("%w: dictionaries are not supported", errCorruptFrame)
+	}
+	id := bd >> 4
+	if id < 4 {
+		return fmt.Errorf("%w: invalid block size id %d", errCorruptFrame, id)
+	}
+	d.contentSize = 0
+	if flg&flagContentSize != 0 {
+		if _, err := io.ReadFull(d.reader, d.buf[:8]); err != nil {
+			return unexpectedEOF(err)
+		}
+		descriptor = append(descriptor, d.buf[:8]...)
+		d.contentSize = binary.LittleEndian.Uint64(d.buf[:8])
+	}
+	hc, err := d.reader.ReadByte()
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+	if hc != byte(checksum32(descriptor)>>8) {
+		return fmt.Errorf("%w: frame header", errChecksumMismatch)
+	}
+
+	d.inFrame = true
+	d.flags = flg
+	d.blockSize = blockSize(id)
+	d.decompressed = 0
+	d.content.Reset()
+	d.out = d.out[:0]
+	return nil
+}
+
+// next returns the next decompressed block, valid until the following call.
+// It returns io.EOF at the end of the stream.
+func (d *frameDecoder) next() ([]byte, error) {
+	for !d.inFrame {
+		if err := d.readHeader(); err != nil {
+			return nil, err
+		}
+	}
+
+	size, err := d.readUint32()
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if size == 0 {
+		if err = d.endFrame(); err != nil {
+			return nil, err
+		}
+		return d.next()
+	}
+	stored := size&uncompressedBlock != 0
+	size &^= uncompressedBlock
+	if int(size) > d.blockSize {
+		return nil, fmt.Errorf("%w: block of %d bytes", errCorruptFrame, size)
+	}
+	if cap(d.compressedBlock) < int(size) {
+		d.compressedBlock = make([]byte, size)
+	}
+	block := d.compressedBlock[:size]
+	if _, err = io.ReadFull(d.reader, block); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if d.flags&flagBlockChecksum != 0 {
+		sum, err := d.readUint32()
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		if sum != checksum32(block) {
+			return nil, fmt.Errorf("%w: block", errChecksumMismatch)
+		}
+	}
+
+	if d.flags&flagBlockIndep != 0 {
+		d.out = d.out[:0]
+	} else if len(d.out) > historySize {
+		d.out = d.out[:copy(d.out, d.out[len(d.out)-historySize:])]
+	}
+	start := len(d.out)
+	if stored {
+		d.out = append(d.out, block...)
+	} else if d.out, err = decompressBlock(d.out, block, d.blockSize); err != nil {
+		return nil, err
+	}
+	decompressed := d.out[start:]
+	d.decompressed += uint64(len(decompressed))
+	if d.flags&flagContentChecksum != 0 {
+		_, _ = d.content.Write(decompressed)
+	}
+	return decompressed, nil
+}
+
+// endFrame checks the content size and checksum at the end mark of a frame.
+func (d *frameDecoder) endFrame() error {
+	d.inFrame = false
+	if d.flags&flagContentSize != 0 && d.contentSize != d.decompressed {
+		return fmt.Errorf("%w: content size %d, decompressed %d", errCorruptFrame, d.contentSize, d.decompressed)
+	}
+	if d.flags&flagContentChecksum != 0 {
+		sum, err := d.readUint32()
+		if err != nil {
+			return unexpectedEOF(err)
+		}
+		if sum != d.content.Sum32() {
+			return fmt.Errorf("%w: content", errChecksumMismatch)
+		}
+	}
+	return nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
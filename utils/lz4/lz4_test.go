@@ -0,0 +1,210 @@
+// Copyright 2024-2025 NetCracker Technology Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package lz4
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/config"
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/require"
+)
+
+func testPreferences() map[string]*config.LZ4Preferences {
+	return map[string]*config.LZ4Preferences{
+		"default":     nil,
+		"fast linked": {CompressionLevel: 1},
+		"independent with block checksums": {
+			FrameInfo:        &config.LZ4FrameInfo{BlockSizeID: config.LZ4fBlockSizeMax256kb, BlockMode: true, BlockChecksumFlag: true},
+			CompressionLevel: 9,
+		},
+		"content checksum": {
+			FrameInfo:          &config.LZ4FrameInfo{BlockSizeID: config.LZ4fBlockSizeMax1mb, ContentChecksumFlag: true},
+			CompressionLevel:   12,
+			DecompressionSpeed: true,
+		},
+		"all checksums": {
+			FrameInfo: &config.LZ4FrameInfo{BlockSizeID: config.LZ4fBlockSizeMax4mb,
+				ContentChecksumFlag: true, BlockChecksumFlag: true},
+			CompressionLevel: 3,
+			AutoFlush:        true,
+		},
+	}
+}
+
+func testInputs() map[string][]byte {
+	random := make([]byte, 200<<10)
+	rand.New(rand.NewSource(1)).Read(random)
+
+	var lines bytes.Buffer
+	for i := 0; lines.Len() < 300<<10; i++ {
+		fmt.Fprintf(&lines, "prometheus.node_cpu_seconds_total.cpu_%d.mode_idle %d.000000 %d\n", i%64, i, 1600000000+i/64)
+	}
+	return map[string][]byte{
+		"empty":    {},
+		"byte":     []byte("a"),
+		"line":     []byte("metric.path 1.000000 1600000000\n"),
+		"lines":    lines.Bytes(),
+		"random":   random,
+		"repeated": bytes.Repeat([]byte{'x'}, 5<<20),
+		"mixed":    append(append(append([]byte{}, lines.Bytes()[:100<<10]...), random[:50<<10]...), lines.Bytes()...),
+	}
+}
+
+func TestXXH32(t *testing.T) {
+	require.Equal(t, uint32(0x02CC5D05), checksum32(nil))
+	require.Equal(t, uint32(0x32D153FF), checksum32([]byte("abc")))
+
+	data := bytes.Repeat([]byte("0123456789"), 10)
+	h := newXXH32()
+	for _, b := range data {
+		_, _ = h.Write([]byte{b})
+	}
+	require.Equal(t, checksum32(data), h.Sum32())
+}
+
+func TestWriterReader(t *testing.T) {
+	logger := log.NewNopLogger()
+	for name, cfg := range testPreferences() {
+		for input, data := range testInputs() {
+			t.Run(name+"/"+input, func(t *testing.T) {
+				var compressed bytes.Buffer
+				writer, err := NewWriter(&compressed, logger, cfg)
+				require.NoError(t, err)
+				n, err := writer.Write(data)
+				require.NoError(t, err)
+				require.Equal(t, len(data), n)
+				// A second write adds a frame to the stream.
+				_, err = writer.Write(data)
+				require.NoError(t, err)
+				require.NoError(t, writer.Close())
+
+				reader, err := NewReader(&compressed, logger, 1<<16)
+				require.NoError(t, err)
+				decompressed, err := io.ReadAll(reader)
+				require.NoError(t, err)
+				require.Equal(t, append(append([]byte{}, data...), data...), decompressed)
+				require.NoError(t, reader.Close())
+			})
+		}
+	}
+}
+
+func TestFrameEncoderCompresses(t *testing.T) {
+	data := testInputs()["lines"]
+	for _, level := range []int{1, 9} {
+		e := newFrameEncoder(frameOptions{blockSizeID: 4, level: level})
+		frame := e.end(e.update(e.begin(nil), data))
+		require.Less(t, len(frame), len(data)/4, "level %d", level)
+	}
+}
+
+func TestFrameDecoderErrors(t *testing.T) {
+	data := testInputs()["lines"]
+	opts := newFrameOptions(testPreferences()["all checksums"])
+	e := newFrameEncoder(opts)
+	frame := e.end(e.update(e.begin(nil), data))
+
+	decode := func(frame []byte) error {
+		d := newFrameDecoder(bytes.NewReader(frame), 1<<16)
+		for {
+			if _, err := d.next(); err != nil {
+				if err == io.EOF {
+					return nil
+				}
+				return err
+			}
+		}
+	}
+	require.NoError(t, decode(frame))
+
+	corrupt := func(i int) []byte {
+		b := append([]byte{}, frame...)
+		b[i] ^= 0xFF
+		return b
+	}
+	require.ErrorIs(t, decode(corrupt(0)), errCorruptFrame)
+	require.ErrorIs(t, decode(corrupt(6)), errChecksumMismatch)
+	require.ErrorIs(t, decode(corrupt(len(frame)/2)), errChecksumMismatch)
+	require.ErrorIs(t, decode(frame[:len(frame)-1]), io.ErrUnexpectedEOF)
+
+	// Skippable frames are ignored.
+	skippable := []byte{0x50, 0x2A, 0x4D, 0x18, 3, 0, 0, 0, 1, 2, 3}
+	require.NoError(t, decode(append(skippable, frame...)))
+}
+
+func TestStreamWriter(t *testing.T) {
+	logger := log.NewNopLogger()
+	lines := testInputs()["lines"]
+	for name, cfg := range testPreferences() {
+		t.Run(name, func(t *testing.T) {
+			var compressed, frames bytes.Buffer
+			writer, err := NewStreamWriter(&compressed, logger, cfg)
+			require.NoError(t, err)
+			reader, err := NewReader(&compressed, logger, 1<<16)
+			require.NoError(t, err)
+
+			for i := 0; i < 50; i++ {
+				batch := lines[i*1000 : (i+1)*1000]
+				_, err = writer.Write(batch)
+				require.NoError(t, err)
+				require.NoError(t, writer.Flush())
+
+				// Each flushed batch can be decompressed before the frame ends.
+				decompressed := make([]byte, len(batch))
+				_, err = io.ReadFull(reader, decompressed)
+				require.NoError(t, err)
+				require.Equal(t, batch, decompressed)
+
+				frameWriter, err := NewWriter(&frames, logger, cfg)
+				require.NoError(t, err)
+				_, err = frameWriter.Write(batch)
+				require.NoError(t, err)
+				require.NoError(t, frameWriter.Close())
+			}
+			require.NoError(t, writer.End())
+			// Blocks linked across batches compress better than a frame per batch.
+			if cfg == nil || cfg.FrameInfo == nil || !cfg.FrameInfo.BlockMode {
+				require.Less(t, compressed.Len()*2, frames.Len())
+			}
+
+			// A new frame starts after End, and after Reset on another writer.
+			_, err = writer.Write(lines[:1000])
+			require.NoError(t, err)
+			require.NoError(t, writer.End())
+			decompressed, err := io.ReadAll(reader)
+			require.NoError(t, err)
+			require.Equal(t, lines[:1000], decompressed)
+
+			_, err = writer.Write(lines[:1000])
+			require.NoError(t, err)
+			var other bytes.Buffer
+			writer.Reset(&other)
+			_, err = writer.Write(lines[1000:2000])
+			require.NoError(t, err)
+			require.NoError(t, writer.Close())
+			reader, err = NewReader(&other, logger, 1<<16)
+			require.NoError(t, err)
+			decompressed, err = io.ReadAll(reader)
+			require.NoError(t, err)
+			require.Equal(t, lines[1000:2000], decompressed)
+		})
+	}
+}
@@ -18,10 +18,10 @@
 package lz4
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
 	"io"
+	"runtime"
 	"strconv"
 	"unsafe"
 
@@ -38,12 +38,20 @@ import (
 */
 import "C"
 
+// lz4fHeaderSizeMax is LZ4F_HEADER_SIZE_MAX, the maximum size of a frame header.
+const lz4fHeaderSizeMax = 19
+
 // Writer is a wrapper around an io.Writer that compresses data using lz4frame c library before writing it.
+// A Writer created with NewWriter writes a frame for each Write, one created with NewStreamWriter
+// writes a single frame across Writes until End or Close.
 type Writer struct {
 	logger      log.Logger
 	writer      io.Writer
 	ctx         *C.LZ4F_cctx
 	preferences *C.LZ4F_preferences_t
+	stream      bool
+	started     bool // the header of the current frame is written
+	buffer      []byte
 }
 
 // NewWriter creates a new Writer with the given underlying io.Writer and compression preferences.
@@ -105,124 +113,154 @@ func NewWriter(writer io.Writer, logger log.Logger, cfg *config.LZ4Preferences)
 		autoFlush:        autoFlush,
 		favorDecSpeed:    decompressionSpeed,
 	}
-	return &Writer{
+	w := &Writer{
 		logger:      logger,
 		writer:      writer,
 		ctx:         ctx,
 		preferences: &preferences,
-	}, nil
-}
-
-// Write compresses p using lz4frame and writes it to the underlying io.Writer.
-// It returns the number of bytes written and any error encountered.
-func (writer *Writer) Write(inputData []byte) (int, error) {
-	// Start the frame
-	outputBufferSize := int(C.LZ4F_compressBound(C.size_t(len(inputData)), writer.preferences)) // Use LZ4F_compressBound to get the maximum output size
-	outputBuffer := make([]byte, outputBufferSize)                                              // Allocate output buffer
-	inputBuffer := make([]byte, outputBufferSize)                                               // Allocate input buffer
-	outputPtr := unsafe.Pointer(&outputBuffer[0])                                               // Create a C pointer to the output buffer
-	headerSize := C.LZ4F_compressBegin(writer.ctx, outputPtr, C.size_t(outputBufferSize), writer.preferences)
-	if C.LZ4F_isError(headerSize) != 0 {
-		err := errors.New(C.GoString(C.LZ4F_getErrorName(headerSize)))
-		_ = level.Error(writer.logger).Log("err", err, "msg", "error creating frame")
-		return 0, err
 	}
+	// Pooled writers are dropped without Close, free their context with them.
+	runtime.SetFinalizer(w, (*Writer).free)
+	return w, nil
+}
 
-	// Write the frame header to the destination file
-	sent, err := writer.writer.Write(outputBuffer[:uint64(headerSize)])
+// NewStreamWriter creates a new Writer that writes a single frame across Writes,
+// the frame is ended by End or Close.
+func NewStreamWriter(writer io.Writer, logger log.Logger, cfg *config.LZ4Preferences) (*Writer, error) {
+	w, err := NewWriter(writer, logger, cfg)
 	if err != nil {
-		_ = level.Error(writer.logger).Log("err", err, "msg", "error writing frame header")
-		return 0, err
-	}
-
-	if uint64(sent) != uint64(headerSize) {
-		_ = level.Error(writer.logger).Log("err", io.ErrShortWrite, "msg", "error writing frame header")
-		return 0, io.ErrShortWrite
+		return nil, err
 	}
+	w.stream = true
+	return w, nil
+}
 
-	_ = level.Debug(writer.logger).Log("msg", "input data", "size", strconv.Itoa(len(inputData)))
-	var sentOut int
-	_ = level.Debug(writer.logger).Log("msg", "frame header", "size", strconv.FormatUint(uint64(headerSize), 10))
-	_ = level.Debug(writer.logger).Log("msg", "frame sent", "size", strconv.Itoa(sent))
-	sentOut += int(headerSize)
-
-	// convert byte slice to io.Reader
-	reader := bytes.NewReader(inputData)
-	// Loop until the end of the source file
-	var m int
-	for {
-		// Read a chunk of data from the source
-		m, err = reader.Read(inputBuffer)
-		if err != nil && err != io.EOF {
-			_ = level.Error(writer.logger).Log("err", err, "msg", "error reading source")
+// Write compresses p using lz4frame and writes it to the underlying io.Writer.
+// It returns the number of bytes written and any error encountered.
+func (writer *Writer) Write(inputData []byte) (int, error) {
+	if !writer.started {
+		if err := writer.begin(); err != nil {
 			return 0, err
 		}
-		if m == 0 {
-			break // End of buffer
-		}
-
-		// Compress the chunk of data
-		compressedSize := C.LZ4F_compressUpdate(writer.ctx, outputPtr, C.size_t(outputBufferSize), unsafe.Pointer(&inputBuffer[0]), C.size_t(m), nil)
-		if C.LZ4F_isError(compressedSize) != 0 {
-			err = errors.New(C.GoString(C.LZ4F_getErrorName(compressedSize)))
-			_ = level.Error(writer.logger).Log("err", err, "msg", "error compressing data")
+	}
+	if len(inputData) > 0 {
+		// Compress the data, it may be buffered until a block is full
+		outputBuffer := writer.grow(int(C.LZ4F_compressBound(C.size_t(len(inputData)), writer.preferences)))
+		compressedSize := C.LZ4F_compressUpdate(writer.ctx, unsafe.Pointer(&outputBuffer[0]), C.size_t(len(outputBuffer)),
+			unsafe.Pointer(&inputData[0]), C.size_t(len(inputData)), nil)
+		if err := writer.check(compressedSize, "error compressing data"); err != nil {
 			return 0, err
 		}
-
-		if compressedSize == 0 {
-			// zero meaning input data was just buffered and is not written into outputBuffer
-			continue
+		if err := writer.send(outputBuffer[:compressedSize], "error writing compressed data"); err != nil {
+			return 0, err
 		}
-
-		// Write the compressed data to the destination file
-		sent, err = writer.writer.Write(outputBuffer[:uint64(compressedSize)])
-		if err != nil {
-			_ = level.Error(writer.logger).Log("err", err, "msg", "error writing compressed data")
+	}
+	if !writer.stream {
+		if err := writer.End(); err != nil {
 			return 0, err
 		}
+	}
+	return len(inputData), nil
+}
 
-		_ = level.Debug(writer.logger).Log("msg", "frame compressed", "size", strconv.FormatUint(uint64(compressedSize), 10))
-		_ = level.Debug(writer.logger).Log("msg", "frame sent", "size", strconv.Itoa(sent))
+// Flush compresses the buffered data of the frame and writes it to the underlying io.Writer.
+func (writer *Writer) Flush() error {
+	if !writer.started {
+		return nil
+	}
+	// LZ4F_compressBound of 0 bytes bounds the output of LZ4F_flush and LZ4F_compressEnd
+	outputBuffer := writer.grow(int(C.LZ4F_compressBound(0, writer.preferences)))
+	flushedSize := C.LZ4F_flush(writer.ctx, unsafe.Pointer(&outputBuffer[0]), C.size_t(len(outputBuffer)), nil)
+	if err := writer.check(flushedSize, "error flushing frame"); err != nil {
+		return err
+	}
+	return writer.send(outputBuffer[:flushedSize], "error writing compressed data")
+}
 
-		if uint64(sent) != uint64(compressedSize) {
-			_ = level.Error(writer.logger).Log("err", io.ErrShortWrite, "msg", "error writing frame header")
-			return 0, io.ErrShortWrite
-		}
-		sentOut += int(compressedSize)
+// End ends the current frame, the next Write starts a new one.
+func (writer *Writer) End() error {
+	if !writer.started {
+		return nil
+	}
+	writer.started = false
+	outputBuffer := writer.grow(int(C.LZ4F_compressBound(0, writer.preferences)))
+	tailSize := C.LZ4F_compressEnd(writer.ctx, unsafe.Pointer(&outputBuffer[0]), C.size_t(len(outputBuffer)), nil)
+	if err := writer.check(tailSize, "error ending frame"); err != nil {
+		return err
 	}
+	return writer.send(outputBuffer[:tailSize], "error writing frame footer")
+}
+
+// Reset discards the current frame and makes the writer write to w, reusing its compression context.
+func (writer *Writer) Reset(w io.Writer) {
+	writer.writer = w
+	writer.started = false
+}
 
-	// End the frame
-	tailSize := C.LZ4F_compressEnd(writer.ctx, outputPtr, C.size_t(outputBufferSize), nil)
-	if C.LZ4F_isError(tailSize) != 0 {
-		err = errors.New(C.GoString(C.LZ4F_getErrorName(tailSize)))
-		_ = level.Error(writer.logger).Log("err", err, "msg", "error ending frame")
-		return 0, err
+// Close ends the current frame and frees the compression context
+func (writer *Writer) Close() error {
+	err := writer.End()
+	if freeErr := writer.free(); err == nil {
+		err = freeErr
 	}
+	return err
+}
 
-	// Write the frame footer to the destination file
-	sent, err = writer.writer.Write(outputBuffer[:uint64(tailSize)])
-	if err != nil {
-		_ = level.Error(writer.logger).Log("err", err, "msg", "error writing frame footer")
-		return 0, err
+func (writer *Writer) begin() error {
+	outputBuffer := writer.grow(lz4fHeaderSizeMax)
+	headerSize := C.LZ4F_compressBegin(writer.ctx, unsafe.Pointer(&outputBuffer[0]), C.size_t(len(outputBuffer)), writer.preferences)
+	if err := writer.check(headerSize, "error creating frame"); err != nil {
+		return err
 	}
-	_ = level.Debug(writer.logger).Log("msg", "frame tail", "size", strconv.FormatUint(uint64(tailSize), 10))
-	_ = level.Debug(writer.logger).Log("msg", "frame sent", "size", strconv.Itoa(sent))
+	if err := writer.send(outputBuffer[:headerSize], "error writing frame header"); err != nil {
+		return err
+	}
+	writer.started = true
+	return nil
+}
 
-	if uint64(sent) != uint64(tailSize) {
-		_ = level.Error(writer.logger).Log("err", io.ErrShortWrite, "msg", "error writing frame footer")
-		return 0, io.ErrShortWrite
+// grow returns the output buffer with at least size bytes.
+func (writer *Writer) grow(size int) []byte {
+	if cap(writer.buffer) < size {
+		writer.buffer = make([]byte, size)
 	}
-	sentOut += int(tailSize)
+	return writer.buffer[:cap(writer.buffer)]
+}
 
-	_ = level.Debug(writer.logger).Log("msg", "compression done", "size", strconv.Itoa(sentOut))
+func (writer *Writer) check(code C.size_t, msg string) error {
+	if C.LZ4F_isError(code) != 0 {
+		err := errors.New(C.GoString(C.LZ4F_getErrorName(code)))
+		_ = level.Error(writer.logger).Log("err", err, "msg", msg)
+		return err
+	}
+	return nil
+}
 
-	return len(inputData), err
+// send writes compressed data to the underlying io.Writer.
+func (writer *Writer) send(data []byte, msg string) error {
+	if len(data) == 0 {
+		return nil
+	}
+	sent, err := writer.writer.Write(data)
+	if err == nil && sent != len(data) {
+		err = io.ErrShortWrite
+	}
+	if err != nil {
+		_ = level.Error(writer.logger).Log("err", err, "msg", msg)
+		return err
+	}
+	_ = level.Debug(writer.logger).Log("msg", "frame sent", "size", strconv.Itoa(sent))
+	return nil
 }
 
-// Close flushes any remaining data and frees the compression context
-func (writer *Writer) Close() error {
-	// free the compression context
+// free frees the compression context
+func (writer *Writer) free() error {
+	if writer.ctx == nil {
+		return nil
+	}
 	errCode := C.LZ4F_freeCompressionContext(writer.ctx)
+	writer.ctx = nil
+	runtime.SetFinalizer(writer, nil)
 	if C.LZ4F_isError(errCode) != 0 {
 		return errors.New(C.GoString(C.LZ4F_getErrorName(errCode)))
 	}
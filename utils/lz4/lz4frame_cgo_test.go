@@ -0,0 +1,65 @@
+// Copyright 2024-2025 NetCracker Technology Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+//go:build cgo
+
+package lz4
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPureGoCompatibility checks that frames of liblz4 and of the pure Go implementation decode identically.
+func TestPureGoCompatibility(t *testing.T) {
+	logger := log.NewNopLogger()
+	for name, cfg := range testPreferences() {
+		for input, data := range testInputs() {
+			t.Run(name+"/"+input, func(t *testing.T) {
+				var compressed bytes.Buffer
+				writer, err := NewWriter(&compressed, logger, cfg)
+				require.NoError(t, err)
+				_, err = writer.Write(data)
+				require.NoError(t, err)
+				require.NoError(t, writer.Close())
+
+				var decompressed []byte
+				d := newFrameDecoder(&compressed, 1<<16)
+				for {
+					block, err := d.next()
+					if err == io.EOF {
+						break
+					}
+					require.NoError(t, err)
+					decompressed = append(decompressed, block...)
+				}
+				require.Equal(t, data, append([]byte{}, decompressed...))
+
+				e := newFrameEncoder(newFrameOptions(cfg))
+				frame := e.end(e.update(e.begin(nil), data))
+				reader, err := NewReader(bytes.NewReader(frame), logger, 1<<16)
+				require.NoError(t, err)
+				decompressed, err = io.ReadAll(reader)
+				require.NoError(t, err)
+				require.Equal(t, data, append([]byte{}, decompressed...))
+				require.NoError(t, reader.Close())
+			})
+		}
+	}
+}
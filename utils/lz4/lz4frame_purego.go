@@ -0,0 +1,159 @@
+// Copyright 2024-2025 NetCracker Technology Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+//go:build !cgo
+
+package lz4
+
+import (
+	"io"
+	"strconv"
+
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/config"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+// Writer is a wrapper around an io.Writer that compresses data in the lz4 frame format before writing it.
+// It is the pure Go implementation used when cgo is disabled. A Writer created with NewWriter writes
+// a frame for each Write, one created with NewStreamWriter writes a single frame across Writes until End or Close.
+type Writer struct {
+	logger  log.Logger
+	writer  io.Writer
+	encoder *frameEncoder
+	stream  bool
+	started bool // the header of the current frame is written
+	buffer  []byte
+}
+
+// NewWriter creates a new Writer with the given underlying io.Writer and compression preferences.
+func NewWriter(writer io.Writer, logger log.Logger, cfg *config.LZ4Preferences) (*Writer, error) {
+	return &Writer{
+		logger:  logger,
+		writer:  writer,
+		encoder: newFrameEncoder(newFrameOptions(cfg)),
+	}, nil
+}
+
+// NewStreamWriter creates a new Writer that writes a single frame across Writes,
+// the frame is ended by End or Close.
+func NewStreamWriter(writer io.Writer, logger log.Logger, cfg *config.LZ4Preferences) (*Writer, error) {
+	w, err := NewWriter(writer, logger, cfg)
+	if err != nil {
+		return nil, err
+	}
+	w.stream = true
+	return w, nil
+}
+
+// Write compresses p in the lz4 frame format and writes it to the underlying io.Writer.
+// It returns the number of bytes written and any error encountered.
+func (writer *Writer) Write(inputData []byte) (int, error) {
+	out := writer.buffer[:0]
+	if !writer.started {
+		out = writer.encoder.begin(out)
+		writer.started = true
+	}
+	out = writer.encoder.update(out, inputData)
+	if !writer.stream {
+		out = writer.encoder.end(out)
+		writer.started = false
+	}
+	if err := writer.send(out); err != nil {
+		return 0, err
+	}
+	return len(inputData), nil
+}
+
+// Flush compresses the buffered data of the frame and writes it to the underlying io.Writer.
+func (writer *Writer) Flush() error {
+	if !writer.started {
+		return nil
+	}
+	return writer.send(writer.encoder.flush(writer.buffer[:0]))
+}
+
+// End ends the current frame, the next Write starts a new one.
+func (writer *Writer) End() error {
+	if !writer.started {
+		return nil
+	}
+	writer.started = false
+	return writer.send(writer.encoder.end(writer.buffer[:0]))
+}
+
+// Reset discards the current frame and makes the writer write to w.
+func (writer *Writer) Reset(w io.Writer) {
+	writer.writer = w
+	writer.started = false
+}
+
+// Close ends the current frame and releases the buffers of the writer.
+func (writer *Writer) Close() error {
+	err := writer.End()
+	writer.buffer = nil
+	return err
+}
+
+// send writes compressed data to the underlying io.Writer.
+func (writer *Writer) send(data []byte) error {
+	writer.buffer = data
+	if len(data) == 0 {
+		return nil
+	}
+	sent, err := writer.writer.Write(data)
+	if err == nil && sent != len(data) {
+		err = io.ErrShortWrite
+	}
+	if err != nil {
+		_ = level.Error(writer.logger).Log("err", err, "msg", "error writing compressed data")
+		return err
+	}
+	_ = level.Debug(writer.logger).Log("msg", "frame sent", "size", strconv.Itoa(sent))
+	return nil
+}
+
+// Reader is a reader that decompresses lz4 streams, it is the pure Go implementation used when cgo is disabled.
+type Reader struct {
+	decoder *frameDecoder
+	pending []byte // decompressed data not read yet
+}
+
+// NewReader creates a new Reader with the given underlying io.Reader and size of its read buffer.
+func NewReader(reader io.Reader, logger log.Logger, bufferSize int) (*Reader, error) {
+	return &Reader{
+		decoder: newFrameDecoder(reader, bufferSize),
+	}, nil
+}
+
+// Read implements the io.Reader interface
+func (reader *Reader) Read(p []byte) (int, error) {
+	if len(reader.pending) == 0 {
+		block, err := reader.decoder.next()
+		if err != nil {
+			return 0, err
+		}
+		reader.pending = block
+	}
+	n := copy(p, reader.pending)
+	reader.pending = reader.pending[n:]
+	return n, nil
+}
+
+// Close releases the buffers of the reader.
+func (reader *Reader) Close() error {
+	reader.pending = nil
+	return nil
+}
@@ -0,0 +1,118 @@
+// Copyright 2024-2025 NetCracker Technology Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package lz4
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+const (
+	prime32x1 uint32 = 2654435761
+	prime32x2 uint32 = 2246822519
+	prime32x3 uint32 = 3266489917
+	prime32x4 uint32 = 668265263
+	prime32x5 uint32 = 374761393
+)
+
+// xxh32 computes the 32-bit xxHash of the data written to it, as used by lz4 frame checksums.
+type xxh32 struct {
+	v     [4]uint32
+	total uint64
+	buf   [16]byte
+	n     int
+}
+
+func newXXH32() *xxh32 {
+	h := &xxh32{}
+	h.Reset()
+	return h
+}
+
+// Reset resets the hash to its initial state with a zero seed.
+func (h *xxh32) Reset() {
+	var seed uint32
+	h.v = [4]uint32{seed + prime32x1 + prime32x2, seed + prime32x2, seed, seed - prime32x1}
+	h.total = 0
+	h.n = 0
+}
+
+func xxh32Round(v, input uint32) uint32 {
+	return bits.RotateLeft32(v+input*prime32x2, 13) * prime32x1
+}
+
+func (h *xxh32) stripe(b []byte) {
+	h.v[0] = xxh32Round(h.v[0], binary.LittleEndian.Uint32(b[0:]))
+	h.v[1] = xxh32Round(h.v[1], binary.LittleEndian.Uint32(b[4:]))
+	h.v[2] = xxh32Round(h.v[2], binary.LittleEndian.Uint32(b[8:]))
+	h.v[3] = xxh32Round(h.v[3], binary.LittleEndian.Uint32(b[12:]))
+}
+
+// Write adds p to the hash, it never fails.
+func (h *xxh32) Write(p []byte) (int, error) {
+	n := len(p)
+	h.total += uint64(n)
+	if h.n > 0 {
+		c := copy(h.buf[h.n:], p)
+		h.n += c
+		p = p[c:]
+		if h.n < len(h.buf) {
+			return n, nil
+		}
+		h.stripe(h.buf[:])
+		h.n = 0
+	}
+	for ; len(p) >= 16; p = p[16:] {
+		h.stripe(p)
+	}
+	h.n = copy(h.buf[:], p)
+	return n, nil
+}
+
+// Sum32 returns the hash of the data written so far.
+func (h *xxh32) Sum32() uint32 {
+	var sum uint32
+	if h.total >= 16 {
+		sum = bits.RotateLeft32(h.v[0], 1) + bits.RotateLeft32(h.v[1], 7) +
+			bits.RotateLeft32(h.v[2], 12) + bits.RotateLeft32(h.v[3], 18)
+	} else {
+		sum = h.v[2] + prime32x5
+	}
+	sum += uint32(h.total)
+
+	p := h.buf[:h.n]
+	for ; len(p) >= 4; p = p[4:] {
+		sum += binary.LittleEndian.Uint32(p) * prime32x3
+		sum = bits.RotateLeft32(sum, 17) * prime32x4
+	}
+	for _, b := range p {
+		sum += uint32(b) * prime32x5
+		sum = bits.RotateLeft32(sum, 11) * prime32x1
+	}
+	sum ^= sum >> 15
+	sum *= prime32x2
+	sum ^= sum >> 13
+	sum *= prime32x3
+	sum ^= sum >> 16
+	return sum
+}
+
+// checksum32 returns the 32-bit xxHash of b.
+func checksum32(b []byte) uint32 {
+	h := newXXH32()
+	_, _ = h.Write(b)
+	return h.Sum32()
+}
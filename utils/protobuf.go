@@ -0,0 +1,51 @@
+// Copyright 2024-2025 NetCracker Technology Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package utils
+
+import (
+	"errors"
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// ErrInvalidProtobuf is returned by WalkFields when a message is not valid protobuf wire format.
+var ErrInvalidProtobuf = errors.New("invalid protobuf message")
+
+// WalkFields calls fn with the number, the type and the value of each field of a protobuf message.
+// Values of length-delimited fields are passed without their length.
+// Errors returned by fn stop the walk and are returned as is.
+func WalkFields(buf []byte, fn func(num protowire.Number, typ protowire.Type, b []byte) error) error {
+	for len(buf) > 0 {
+		num, typ, n := protowire.ConsumeTag(buf)
+		if n < 0 {
+			return fmt.Errorf("%w: %v", ErrInvalidProtobuf, protowire.ParseError(n))
+		}
+		buf = buf[n:]
+		if n = protowire.ConsumeFieldValue(num, typ, buf); n < 0 {
+			return fmt.Errorf("%w: %v", ErrInvalidProtobuf, protowire.ParseError(n))
+		}
+		value := buf[:n]
+		buf = buf[n:]
+		if typ == protowire.BytesType {
+			value, _ = protowire.ConsumeBytes(value)
+		}
+		if err := fn(num, typ, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+// Copyright 2024-2025 NetCracker Technology Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package utils
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type field struct {
+	num   protowire.Number
+	typ   protowire.Type
+	value string
+}
+
+func TestWalkFields(t *testing.T) {
+	var buf []byte
+	buf = protowire.AppendTag(buf, 1, protowire.VarintType)
+	buf = protowire.AppendVarint(buf, 150)
+	buf = protowire.AppendTag(buf, 2, protowire.BytesType)
+	buf = protowire.AppendString(buf, "value")
+	buf = protowire.AppendTag(buf, 3, protowire.Fixed64Type)
+	buf = protowire.AppendFixed64(buf, 1)
+
+	var fields []field
+	err := WalkFields(buf, func(num protowire.Number, typ protowire.Type, b []byte) error {
+		fields = append(fields, field{num, typ, string(b)})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	expected := []field{
+		{1, protowire.VarintType, "\x96\x01"},
+		{2, protowire.BytesType, "value"},
+		{3, protowire.Fixed64Type, "\x01\x00\x00\x00\x00\x00\x00\x00"},
+	}
+	if !reflect.DeepEqual(expected, fields) {
+		t.Errorf("Expected %v, got %v", expected, fields)
+	}
+
+	// The length of the value exceeds the message.
+	err = WalkFields(buf[:len(buf)-12], func(protowire.Number, protowire.Type, []byte) error { return nil })
+	if !errors.Is(err, ErrInvalidProtobuf) {
+		t.Errorf("Expected %v, got %v", ErrInvalidProtobuf, err)
+	}
+
+	stop := errors.New("stop")
+	err = WalkFields(buf, func(protowire.Number, protowire.Type, []byte) error { return stop })
+	if err != stop {
+		t.Errorf("Expected %v, got %v", stop, err)
+	}
+}
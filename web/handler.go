@@ -20,9 +20,12 @@ import (
 	"html"
 	"net/http"
 	"sync"
+	"sync/atomic"
 
 	"github.com/Netcracker/qubership-graphite-remote-adapter/client"
 	"github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite"
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/limiter"
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/metadata"
 	"github.com/Netcracker/qubership-graphite-remote-adapter/config"
 	"github.com/Netcracker/qubership-graphite-remote-adapter/ui"
 	"github.com/Netcracker/qubership-graphite-remote-adapter/utils/template"
@@ -82,8 +85,14 @@ type Handler struct {
 
 	writers []client.Writer
 	readers []client.Reader
+	// metadata of the metric families received, kept across configuration reloads.
+	metadata *metadata.Cache
+	// limiter of the series cardinality, kept across configuration reloads while limits are configured.
+	limiter *limiter.Limiter
 
 	lock sync.RWMutex
+	// inflightBytes is the size of the decoded write requests being processed.
+	inflightBytes atomic.Int64
 }
 
 func instrumentHandler(name string, handlerFunc http.HandlerFunc) http.Handler {
@@ -107,6 +116,7 @@ func New(logger log.Logger, cfg *config.Config) *Handler {
 		logger:   logger,
 		router:   router,
 		reloadCh: make(chan chan error),
+		metadata: metadata.NewCache(cfg.Write.MaxMetadataFamilies),
 	}
 	h.buildClients()
 
@@ -127,6 +137,7 @@ func New(logger log.Logger, cfg *config.Config) *Handler {
 
 	router.Methods(http.MethodPost).Path("/write").Handler(instrumentHandler("write", h.write))
 	router.Methods(http.MethodPost).Path("/read").Handler(instrumentHandler("read", h.read))
+	router.Methods(http.MethodGet).Path("/api/v1/metadata").Handler(instrumentHandler("metadata", h.metadataList))
 
 	return h
 }
@@ -141,14 +152,20 @@ func (h *Handler) ApplyConfig(cfg *config.Config) error {
 	h.lock.Lock()
 	defer h.lock.Unlock()
 
+	// A client can be both a writer and a reader, shut it down once.
+	clients := make(map[client.Client]struct{})
 	for _, w := range h.writers {
-		w.Shutdown()
+		clients[w] = struct{}{}
 	}
 	for _, r := range h.readers {
-		r.Shutdown()
+		clients[r] = struct{}{}
+	}
+	for c := range clients {
+		c.Shutdown()
 	}
 
 	h.cfg = cfg
+	h.metadata.SetMaxFamilies(cfg.Write.MaxMetadataFamilies)
 	h.buildClients()
 
 	return nil
@@ -158,7 +175,15 @@ func (h *Handler) buildClients() {
 	_ = level.Info(h.logger).Log("cfg", h.cfg, "msg", "Building clients")
 	h.writers = nil
 	h.readers = nil
-	if c := graphite.NewClient(h.cfg, h.logger); c != nil {
+	switch limits := h.cfg.Graphite.Write.Limits; {
+	case limits == nil:
+		h.limiter = nil
+	case h.limiter == nil:
+		h.limiter = limiter.New(limits)
+	default:
+		h.limiter.SetConfig(limits)
+	}
+	if c := graphite.NewClient(h.cfg, h.logger, h.metadata, h.limiter); c != nil {
 		h.writers = append(h.writers, c)
 		h.readers = append(h.readers, c)
 	}
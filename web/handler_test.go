@@ -0,0 +1,75 @@
+// Copyright 2024-2025 NetCracker Technology Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package web
+
+import (
+	"testing"
+	"time"
+
+	graphiteconfig "github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/config"
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/graphite/limiter"
+	"github.com/Netcracker/qubership-graphite-remote-adapter/config"
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyConfigReload(t *testing.T) {
+	asyncCfg := graphiteconfig.DefaultAsyncConfig
+	spoolCfg := graphiteconfig.DefaultSpoolConfig
+	spoolCfg.Directory = t.TempDir()
+	cfg := config.DefaultConfig
+	cfg.Graphite.Write.CarbonAddress = "127.0.0.1:1"
+	cfg.Graphite.Write.Async = &asyncCfg
+	cfg.Graphite.Write.Spool = &spoolCfg
+
+	// The client built by New is both a writer and a reader, and is shut down on each reload.
+	h := New(log.NewNopLogger(), &cfg)
+	require.NoError(t, h.ApplyConfig(&cfg))
+	require.NoError(t, h.ApplyConfig(&cfg))
+	require.Len(t, h.writers, 1)
+	require.Len(t, h.readers, 1)
+	h.writers[0].Shutdown()
+}
+
+func TestApplyConfigKeepsLimiter(t *testing.T) {
+	limits := graphiteconfig.DefaultLimitsConfig
+	limits.MaxSeries = 2
+	cfg := config.DefaultConfig
+	cfg.Graphite.Write.CarbonAddress = "127.0.0.1:1"
+	cfg.Graphite.Write.Limits = &limits
+
+	h := New(log.NewNopLogger(), &cfg)
+	lim := h.limiter
+	require.NotNil(t, lim)
+	lim.Admit(1, "a", "", time.Now())
+
+	// Active series and their budgets are kept across reloads, with the new limits.
+	reloaded := cfg
+	reloadedLimits := limits
+	reloadedLimits.MaxSeries = 1
+	reloaded.Graphite.Write.Limits = &reloadedLimits
+	require.NoError(t, h.ApplyConfig(&reloaded))
+	require.Same(t, lim, h.limiter)
+	require.Equal(t, 1, h.limiter.Active())
+	require.Equal(t, limiter.Global, h.limiter.Admit(2, "a", "", time.Now()))
+
+	// Series are tracked from scratch once limits are removed.
+	unlimited := cfg
+	unlimited.Graphite.Write.Limits = nil
+	require.NoError(t, h.ApplyConfig(&unlimited))
+	require.Nil(t, h.limiter)
+	h.writers[0].Shutdown()
+}
@@ -0,0 +1,93 @@
+// Copyright 2024-2025 NetCracker Technology Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/metadata"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+var (
+	metadataFamilies = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "metadata_families",
+			Help:      "Number of metric families whose metadata are kept.",
+		},
+	)
+	droppedMetadata = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "dropped_metadata_total",
+			Help:      "Total number of metric family metadata dropped because of the limit of families.",
+		},
+	)
+)
+
+// metadataResponse is the response of the metadata endpoint, in the format of the Prometheus API.
+type metadataResponse struct {
+	Status    string      `json:"status"`
+	Data      interface{} `json:"data,omitempty"`
+	ErrorType string      `json:"errorType,omitempty"`
+	Error     string      `json:"error,omitempty"`
+}
+
+// updateMetadata records the metadata of metric families received with a write request.
+func (h *Handler) updateMetadata(mds []prompb.MetricMetadata) {
+	if dropped := h.metadata.Update(mds); dropped > 0 {
+		droppedMetadata.Add(float64(dropped))
+		_ = level.Debug(h.logger).Log("dropped", dropped, "msg", "Dropped metadata of metric families above the limit")
+	}
+	metadataFamilies.Set(float64(h.metadata.Len()))
+}
+
+// metadataList lists the metadata of the metric families received, optionally only the family
+// named by the metric parameter and at most limit families.
+func (h *Handler) metadataList(w http.ResponseWriter, r *http.Request) {
+	limit := -1
+	if s := r.FormValue("limit"); s != "" {
+		var err error
+		if limit, err = strconv.Atoi(s); err != nil {
+			writeMetadataResponse(w, http.StatusBadRequest, metadataResponse{
+				Status:    "error",
+				ErrorType: "bad_data",
+				Error:     fmt.Sprintf("limit must be a number, got %q", s),
+			})
+			return
+		}
+	}
+
+	families := h.metadata.Families(r.FormValue("metric"), limit)
+	data := make(map[string][]metadata.Metadata, len(families))
+	for name, md := range families {
+		data[name] = []metadata.Metadata{md}
+	}
+	writeMetadataResponse(w, http.StatusOK, metadataResponse{Status: "success", Data: data})
+}
+
+func writeMetadataResponse(w http.ResponseWriter, status int, resp metadataResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
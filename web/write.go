@@ -16,18 +16,40 @@
 package web
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
 	"net/http"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/Netcracker/qubership-graphite-remote-adapter/client"
 	"github.com/go-kit/log/level"
+	"github.com/golang/snappy"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/prompb"
-	"github.com/prometheus/prometheus/storage/remote"
+)
+
+// inflightRetryAfter is the delay after which a request rejected by the in-flight limit can be retried.
+const inflightRetryAfter = time.Second
+
+// Buffers and requests used to decode remote write requests are reused across requests.
+var (
+	readBufferPool = sync.Pool{New: func() interface{} {
+		return &bytes.Buffer{}
+	}}
+	decodeBufferPool = sync.Pool{New: func() interface{} {
+		return &[]byte{}
+	}}
+	writeRequestPool = sync.Pool{New: func() interface{} {
+		return &prompb.WriteRequest{}
+	}}
 )
 
 var (
@@ -64,6 +86,13 @@ var (
 		},
 		[]string{"remote"},
 	)
+	inflightBytes = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "write_inflight_bytes",
+			Help:      "Size of the decoded remote write requests being processed, when their size is limited.",
+		},
+	)
 )
 
 func (h *Handler) write(w http.ResponseWriter, r *http.Request) {
@@ -71,46 +100,122 @@ func (h *Handler) write(w http.ResponseWriter, r *http.Request) {
 	defer h.lock.RUnlock()
 	_ = level.Debug(h.logger).Log("request", r.RemoteAddr, r.Method, r.URL, "msg", "Handling /write request")
 
-	// As default, we expected snappy encoded protobuf.
+	// As default, we expected snappy encoded protobuf, of the remote write 1.0 or 2.0 protocol.
 	// But for simulation purpose we also accept json.
 	dryRun := false
-	if ct := r.Header.Get("Content-Type"); ct == "application/json" {
+	proto := ""
+	mediaType, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/json":
 		dryRun = true
+	case "application/x-protobuf":
+		proto = params["proto"]
+	}
+	if version := r.Header.Get(writeVersionHeader); !dryRun && version != "" {
+		versionProto, ok := writeVersionProto(version)
+		if !ok {
+			http.Error(w, fmt.Sprintf("unsupported remote write version %q", version), http.StatusUnsupportedMediaType)
+			return
+		}
+		if proto != "" && proto != versionProto {
+			http.Error(w, fmt.Sprintf("remote write version %q does not match the protobuf message %q", version, proto), http.StatusUnsupportedMediaType)
+			return
+		}
+		proto = versionProto
+	}
+	if proto == "" {
+		proto = writeV1Proto
+	}
+	if proto != writeV1Proto && proto != writeV2Proto {
+		http.Error(w, fmt.Sprintf("unsupported remote write protobuf message %q", proto), http.StatusUnsupportedMediaType)
+		return
+	}
+	if enc := r.Header.Get("Content-Encoding"); !dryRun && enc != "" && enc != "snappy" {
+		http.Error(w, fmt.Sprintf("unsupported remote write content encoding %q", enc), http.StatusUnsupportedMediaType)
+		return
 	}
 
-	// Parse samples from request.
-	var samples model.Samples
+	// Parse time series from request.
+	var req *prompb.WriteRequest
+	var stats writeV2Stats
 	var err error
-	var reqBufLen int
 	if dryRun {
-		samples, err = h.parseTestWriteRequest(w, r)
+		req, err = h.parseTestWriteRequest(w, r)
 	} else {
-		samples, reqBufLen, err = h.parseWriteRequest(w, r)
+		var release func()
+		req, stats, release, err = h.parseWriteRequest(w, r, proto)
+		if release != nil {
+			defer release()
+		}
 	}
 	if err != nil {
+		if proto == writeV2Proto {
+			setWrittenHeaders(w, 0, 0, 0)
+		}
+		var throttled *client.ThrottledError
+		if errors.As(err, &throttled) {
+			writeThrottled(w, err.Error(), throttled.RetryAfter)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	// Metadata are recorded before writing, for the time series of the same request.
+	if len(req.Metadata) > 0 {
+		h.updateMetadata(req.Metadata)
+	}
+
 	prefix := h.cfg.Graphite.StoragePrefixFromRequest(r)
+	numSamples := countSamples(req.Timeseries)
 
-	receivedSamples.WithLabelValues(prefix).Add(float64(len(samples)))
+	receivedSamples.WithLabelValues(prefix).Add(float64(numSamples))
 
 	// Execute write on each writer clients.
 	var wg sync.WaitGroup
+	var responseLock sync.Mutex
 	writeResponse := make(map[string]string)
-	var msgBytes []byte
+	status := http.StatusOK
+	var retryAfter time.Duration
 	for _, writer := range h.writers {
 		wg.Add(1)
-		go func(client client.Writer) {
-			msgBytes, err = h.instrumentedWriteSamples(client, samples, reqBufLen, r, dryRun)
+		go func(writer client.Writer) {
+			ctx, report := client.WithWriteReport(r.Context())
+			msgBytes, err := h.instrumentedWriteSamples(ctx, writer, req, numSamples, r, dryRun)
+			if destinations := report.Destinations(); len(destinations) > 0 {
+				// The writer sent to several destinations, account for each of them.
+				for _, d := range destinations {
+					sentBatchDuration.WithLabelValues(d.Target).Observe(d.Duration.Seconds())
+					if d.Err != nil {
+						failedSamples.WithLabelValues(prefix, d.Target).Add(float64(d.Samples))
+					} else {
+						sentSamples.WithLabelValues(prefix, d.Target).Add(float64(d.Samples))
+					}
+				}
+			} else if err != nil {
+				failedSamples.WithLabelValues(prefix, writer.Target()).Add(float64(numSamples))
+			} else {
+				sentSamples.WithLabelValues(prefix, writer.Target()).Add(float64(numSamples))
+			}
+			responseLock.Lock()
 			if err != nil {
-				failedSamples.WithLabelValues(prefix, client.Target()).Add(float64(len(samples)))
-				writeResponse[client.Name()] = err.Error()
+				writeResponse[writer.Name()] = err.Error()
+				// Report the most severe failure, all writers are retried with the request.
+				errStatus := http.StatusServiceUnavailable
+				var throttled *client.ThrottledError
+				if errors.As(err, &throttled) {
+					errStatus = http.StatusTooManyRequests
+					if throttled.RetryAfter > retryAfter {
+						retryAfter = throttled.RetryAfter
+					}
+				}
+				if errStatus > status {
+					status = errStatus
+				}
 			} else {
-				sentSamples.WithLabelValues(prefix, client.Target()).Add(float64(len(samples)))
-				writeResponse[client.Name()] = string(msgBytes)
+				writeResponse[writer.Name()] = string(msgBytes)
 			}
+			responseLock.Unlock()
 			wg.Done()
 		}(writer)
 	}
@@ -122,62 +227,177 @@ func (h *Handler) write(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	w.Header().Set("Content-Type", "application/json")
+	if proto == writeV2Proto {
+		// Exemplars are not written to Graphite, nor histograms unless they are configured.
+		writtenSamples, writtenHistograms := 0, 0
+		if status == http.StatusOK {
+			writtenSamples = numSamples
+			if h.cfg.Graphite.Write.Histograms != nil {
+				writtenHistograms = stats.histograms
+			}
+		}
+		setWrittenHeaders(w, writtenSamples, writtenHistograms, 0)
+	}
+	if status == http.StatusTooManyRequests {
+		setRetryAfter(w, retryAfter)
+	}
+	w.WriteHeader(status)
 	_, _ = w.Write(data)
 }
 
-func (h *Handler) parseTestWriteRequest(w http.ResponseWriter, r *http.Request) (model.Samples, error) {
+// writeThrottled responds with 429 Too Many Requests, asking to retry the request after retryAfter.
+func writeThrottled(w http.ResponseWriter, msg string, retryAfter time.Duration) {
+	setRetryAfter(w, retryAfter)
+	http.Error(w, msg, http.StatusTooManyRequests)
+}
+
+// setWrittenHeaders reports what was written from a remote write 2.0 request.
+func setWrittenHeaders(w http.ResponseWriter, samples, histograms, exemplars int) {
+	w.Header().Set(writtenSamplesHeader, strconv.Itoa(samples))
+	w.Header().Set(writtenHistogramsHeader, strconv.Itoa(histograms))
+	w.Header().Set(writtenExemplarsHeader, strconv.Itoa(exemplars))
+}
+
+// setRetryAfter sets the Retry-After header in seconds, rounded up.
+func setRetryAfter(w http.ResponseWriter, retryAfter time.Duration) {
+	seconds := int64((retryAfter + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+}
+
+// parseTestWriteRequest decodes a JSON list of samples, each of them in its own time series.
+func (h *Handler) parseTestWriteRequest(w http.ResponseWriter, r *http.Request) (*prompb.WriteRequest, error) {
 	decoder := json.NewDecoder(r.Body)
 	var samples []*model.Sample
 	err := decoder.Decode(&samples)
 	if err != nil {
 		return nil, err
 	}
-	return samples, nil
+	req := &prompb.WriteRequest{Timeseries: make([]prompb.TimeSeries, 0, len(samples))}
+	for _, s := range samples {
+		labels := make([]prompb.Label, 0, len(s.Metric))
+		for name, value := range s.Metric {
+			labels = append(labels, prompb.Label{Name: string(name), Value: string(value)})
+		}
+		req.Timeseries = append(req.Timeseries, prompb.TimeSeries{
+			Labels:  labels,
+			Samples: []prompb.Sample{{Value: float64(s.Value), Timestamp: int64(s.Timestamp)}},
+		})
+	}
+	return req, nil
 }
 
-func (h *Handler) parseWriteRequest(w http.ResponseWriter, r *http.Request) (model.Samples, int, error) {
-	req, err := remote.DecodeWriteRequest(r.Body)
+// parseWriteRequest decodes a snappy encoded remote write request of the proto message into a pooled
+// request. Once its time series are processed, release returns the request to the pool and frees
+// the room it takes in the in-flight limit.
+func (h *Handler) parseWriteRequest(w http.ResponseWriter, r *http.Request, proto string) (*prompb.WriteRequest, writeV2Stats, func(), error) {
+	compressed := readBufferPool.Get().(*bytes.Buffer)
+	compressed.Reset()
+	defer readBufferPool.Put(compressed)
+	if _, err := compressed.ReadFrom(r.Body); err != nil {
+		_ = level.Error(h.logger).Log("msg", "Error reading remote write request", "err", err.Error())
+		return nil, writeV2Stats{}, nil, err
+	}
+	size, err := snappy.DecodedLen(compressed.Bytes())
 	if err != nil {
 		_ = level.Error(h.logger).Log("msg", "Error decoding remote write request", "err", err.Error())
-		return nil, 0, err
+		return nil, writeV2Stats{}, nil, err
+	}
+	releaseInflight, err := h.acquireInflight(int64(size))
+	if err != nil {
+		return nil, writeV2Stats{}, nil, err
 	}
 
-	samples, sSize := protoToSamples(req)
+	// Labels are copied by the decoding, the decoded buffer is not referenced by the request.
+	decoded := decodeBufferPool.Get().(*[]byte)
+	defer decodeBufferPool.Put(decoded)
+	reqBuf, err := snappy.Decode((*decoded)[:cap(*decoded)], compressed.Bytes())
+	if err != nil {
+		releaseInflight()
+		_ = level.Error(h.logger).Log("msg", "Error decoding remote write request", "err", err.Error())
+		return nil, writeV2Stats{}, nil, err
+	}
+	*decoded = reqBuf
 
-	return samples, sSize, nil
+	req := writeRequestPool.Get().(*prompb.WriteRequest)
+	release := func() {
+		resetWriteRequest(req)
+		writeRequestPool.Put(req)
+		releaseInflight()
+	}
+	var stats writeV2Stats
+	if proto == writeV2Proto {
+		stats, err = decodeWriteV2(reqBuf, req)
+	} else {
+		// Unlike proto.Unmarshal, the generated Unmarshal appends to the time series of the pooled request.
+		err = req.Unmarshal(reqBuf)
+	}
+	if err != nil {
+		release()
+		_ = level.Error(h.logger).Log("msg", "Error decoding remote write request", "err", err.Error())
+		return nil, writeV2Stats{}, nil, err
+	}
+	return req, stats, release, nil
 }
 
-func protoToSamples(req *prompb.WriteRequest) (samples model.Samples, sSize int) {
-	for _, ts := range req.Timeseries {
-		metric := make(model.Metric, len(ts.Labels))
-		for _, l := range ts.Labels {
-			metric[model.LabelName(l.Name)] = model.LabelValue(l.Value)
-		}
+// resetWriteRequest empties a request, keeping the capacity of its time series.
+func resetWriteRequest(req *prompb.WriteRequest) {
+	// Drop the references to the labels and samples of the previous request.
+	clear(req.Timeseries)
+	clear(req.Metadata)
+	req.Timeseries = req.Timeseries[:0]
+	req.Metadata = req.Metadata[:0]
+	req.XXX_unrecognized = nil
+}
 
-		for _, s := range ts.Samples {
-			samples = append(samples, &model.Sample{
-				Metric:    metric,
-				Value:     model.SampleValue(s.Value),
-				Timestamp: model.Time(s.Timestamp),
-			})
+// countSamples returns the number of samples of time series.
+func countSamples(series []prompb.TimeSeries) int {
+	n := 0
+	for i := range series {
+		n += len(series[i].Samples)
+	}
+	return n
+}
+
+// acquireInflight takes room for a request of size bytes in the in-flight limit.
+// A request is always accepted when no other request is in flight, so that it cannot be rejected forever.
+func (h *Handler) acquireInflight(size int64) (func(), error) {
+	limit := h.cfg.Write.MaxInflightBytes
+	if limit <= 0 {
+		return func() {}, nil
+	}
+	inflight := h.inflightBytes.Add(size)
+	release := func() {
+		inflightBytes.Set(float64(h.inflightBytes.Add(-size)))
+	}
+	if inflight > limit && inflight != size {
+		release()
+		return nil, &client.ThrottledError{
+			Err:        fmt.Errorf("too many write requests in flight: %d bytes, the limit is %d bytes", inflight, limit),
+			RetryAfter: inflightRetryAfter,
 		}
-		sSize += ts.Size()
 	}
-	return
+	inflightBytes.Set(float64(inflight))
+	return release, nil
 }
 
 func (h *Handler) instrumentedWriteSamples(
-	w client.Writer, samples model.Samples, reqBufLen int, r *http.Request, dryRun bool) ([]byte, error) {
+	ctx context.Context, w client.Writer, req *prompb.WriteRequest, numSamples int, r *http.Request, dryRun bool) ([]byte, error) {
 
 	begin := time.Now()
-	msgBytes, err := w.Write(samples, reqBufLen, r, dryRun)
+	msgBytes, err := w.Write(ctx, req, r, dryRun)
 	duration := time.Since(begin).Seconds()
 	if err != nil {
 		_ = level.Warn(h.logger).Log(
-			"num_samples", len(samples), "storage", w.Name(),
+			"num_samples", numSamples, "storage", w.Name(),
 			"err", err, "msg", "Error sending samples to remote storage")
 		return nil, err
 	}
-	sentBatchDuration.WithLabelValues(w.Target()).Observe(duration)
+	if report := client.WriteReportFromContext(ctx); report == nil || len(report.Destinations()) == 0 {
+		sentBatchDuration.WithLabelValues(w.Target()).Observe(duration)
+	}
 	return msgBytes, nil
 }
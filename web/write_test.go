@@ -0,0 +1,177 @@
+// Copyright 2024-2025 NetCracker Technology Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package web
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client"
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/metadata"
+	"github.com/Netcracker/qubership-graphite-remote-adapter/config"
+	"github.com/go-kit/log"
+	"github.com/golang/snappy"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeWriter is a writer failing with err, if not nil.
+type fakeWriter struct {
+	name    string
+	err     error
+	samples atomic.Int64
+}
+
+func (w *fakeWriter) Write(ctx context.Context, req *prompb.WriteRequest, r *http.Request, dryRun bool) ([]byte, error) {
+	if w.err != nil {
+		return nil, w.err
+	}
+	w.samples.Add(int64(countSamples(req.Timeseries)))
+	return []byte("Done."), nil
+}
+
+func (w *fakeWriter) Name() string   { return w.name }
+func (w *fakeWriter) Target() string { return "fake" }
+func (w *fakeWriter) String() string { return w.name }
+func (w *fakeWriter) Shutdown()      {}
+
+func newTestHandler(cfg *config.Config, writers ...client.Writer) *Handler {
+	return &Handler{
+		cfg:      cfg,
+		logger:   log.NewNopLogger(),
+		writers:  writers,
+		metadata: metadata.NewCache(cfg.Write.MaxMetadataFamilies),
+	}
+}
+
+// encodeWriteRequest returns the snappy encoded body of a remote write 1.0 request.
+func encodeWriteRequest(t *testing.T, req *prompb.WriteRequest) []byte {
+	data, err := req.Marshal()
+	require.NoError(t, err)
+	return snappy.Encode(nil, data)
+}
+
+func TestWriteStatus(t *testing.T) {
+	body := encodeWriteRequest(t, &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{{
+		Labels:  []prompb.Label{{Name: "__name__", Value: "metric"}},
+		Samples: []prompb.Sample{{Value: 1, Timestamp: 1000}, {Value: 2, Timestamp: 2000}},
+	}}})
+	throttled := &client.ThrottledError{Err: errors.New("queue is full"), RetryAfter: 1500 * time.Millisecond}
+
+	tests := []struct {
+		name             string
+		body             []byte
+		contentEncoding  string
+		errs             []error
+		inflight         int64
+		expectStatus     int
+		expectRetryAfter string
+		expectSamples    int64
+	}{
+		{
+			name:          "written",
+			body:          body,
+			errs:          []error{nil},
+			expectStatus:  http.StatusOK,
+			expectSamples: 2,
+		},
+		{
+			name:         "not snappy",
+			body:         []byte("not a remote write request"),
+			errs:         []error{nil},
+			expectStatus: http.StatusBadRequest,
+		},
+		{
+			name:         "not protobuf",
+			body:         snappy.Encode(nil, []byte{0xff, 0xff, 0xff}),
+			errs:         []error{nil},
+			expectStatus: http.StatusBadRequest,
+		},
+		{
+			name:            "unsupported content encoding",
+			body:            body,
+			contentEncoding: "gzip",
+			errs:            []error{nil},
+			expectStatus:    http.StatusUnsupportedMediaType,
+		},
+		{
+			name:         "writer failed",
+			body:         body,
+			errs:         []error{errors.New("carbon is unreachable")},
+			expectStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:             "writer throttled",
+			body:             body,
+			errs:             []error{throttled},
+			expectStatus:     http.StatusTooManyRequests,
+			expectRetryAfter: "2",
+		},
+		{
+			name:          "writer failed and writer throttled",
+			body:          body,
+			errs:          []error{throttled, errors.New("carbon is unreachable"), nil},
+			expectStatus:  http.StatusServiceUnavailable,
+			expectSamples: 2,
+		},
+		{
+			name:             "too many requests in flight",
+			body:             body,
+			errs:             []error{nil},
+			inflight:         1,
+			expectStatus:     http.StatusTooManyRequests,
+			expectRetryAfter: "1",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := config.DefaultConfig
+			cfg.Write.MaxInflightBytes = 1
+			var writers []client.Writer
+			var fakes []*fakeWriter
+			for i, err := range test.errs {
+				w := &fakeWriter{name: string(rune('a' + i)), err: err}
+				fakes = append(fakes, w)
+				writers = append(writers, w)
+			}
+			h := newTestHandler(&cfg, writers...)
+			h.inflightBytes.Store(test.inflight)
+
+			r := httptest.NewRequest(http.MethodPost, "/write", bytes.NewReader(test.body))
+			r.Header.Set("Content-Type", "application/x-protobuf")
+			r.Header.Set("Content-Encoding", "snappy")
+			if test.contentEncoding != "" {
+				r.Header.Set("Content-Encoding", test.contentEncoding)
+			}
+			rec := httptest.NewRecorder()
+			h.write(rec, r)
+
+			require.Equal(t, test.expectStatus, rec.Code, rec.Body.String())
+			require.Equal(t, test.expectRetryAfter, rec.Header().Get("Retry-After"))
+			var samples int64
+			for _, w := range fakes {
+				samples += w.samples.Load()
+			}
+			require.Equal(t, test.expectSamples, samples)
+		})
+	}
+}
@@ -0,0 +1,248 @@
+// Copyright 2024-2025 NetCracker Technology Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package web
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/histogram"
+	"github.com/Netcracker/qubership-graphite-remote-adapter/client/metadata"
+	"github.com/Netcracker/qubership-graphite-remote-adapter/utils"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Protobuf messages of the remote write protocols, negotiated with the proto parameter of the Content-Type.
+const (
+	writeV1Proto = "prometheus.WriteRequest"
+	writeV2Proto = "io.prometheus.write.v2.Request"
+)
+
+// writeVersionHeader is the request header holding the version of the remote write protocol,
+// 0.1.0 for remote write 1.0 and 2.0.0 for remote write 2.0.
+const writeVersionHeader = "X-Prometheus-Remote-Write-Version"
+
+// Response headers of the remote write 2.0 protocol.
+const (
+	writtenSamplesHeader    = "X-Prometheus-Remote-Write-Samples-Written"
+	writtenHistogramsHeader = "X-Prometheus-Remote-Write-Histograms-Written"
+	writtenExemplarsHeader  = "X-Prometheus-Remote-Write-Exemplars-Written"
+)
+
+var errInvalidWriteV2 = errors.New("invalid remote write 2.0 request")
+
+// writeV2Stats counts the histograms and exemplars of a remote write 2.0 request.
+type writeV2Stats struct {
+	histograms int
+	exemplars  int
+}
+
+// writeVersionProto returns the protobuf message of a version of the remote write protocol.
+func writeVersionProto(version string) (string, bool) {
+	major, minor, _ := strings.Cut(version, ".")
+	minor, _, _ = strings.Cut(minor, ".")
+	switch {
+	case major == "0" && minor == "1", major == "1":
+		return writeV1Proto, true
+	case major == "2":
+		return writeV2Proto, true
+	default:
+		return "", false
+	}
+}
+
+// decodeWriteV2 decodes an io.prometheus.write.v2.Request into the time series of req.
+// Symbols are decoded once and shared by the labels of all the time series referencing them.
+// Histograms are kept encoded in the time series, like in remote write 1.0 requests.
+// The metadata of the time series are added to the metadata of req, once for consecutive time series
+// of the same family.
+func decodeWriteV2(buf []byte, req *prompb.WriteRequest) (writeV2Stats, error) {
+	var stats writeV2Stats
+	var symbols []string
+	var series [][]byte
+	// Symbols are not required to come before the time series referencing them.
+	err := utils.WalkFields(buf, func(num protowire.Number, typ protowire.Type, b []byte) error {
+		switch {
+		case num == 4 && typ == protowire.BytesType:
+			symbols = append(symbols, string(b))
+		case num == 5 && typ == protowire.BytesType:
+			series = append(series, b)
+		}
+		return nil
+	})
+	if err != nil {
+		return stats, invalidWriteV2(err)
+	}
+
+	// Labels and samples of all time series are allocated together.
+	var labels []prompb.Label
+	var samples []prompb.Sample
+	for _, b := range series {
+		labelsStart, samplesStart := len(labels), len(samples)
+		refs := 0
+		var histograms []byte
+		var md prompb.MetricMetadata
+		err = utils.WalkFields(b, func(num protowire.Number, typ protowire.Type, b []byte) error {
+			switch {
+			case num == 1:
+				return walkRefs(typ, b, func(ref uint64) error {
+					if ref >= uint64(len(symbols)) {
+						return fmt.Errorf("%w: symbol reference %d out of %d symbols", errInvalidWriteV2, ref, len(symbols))
+					}
+					// References alternate between label names and values.
+					if refs%2 == 0 {
+						labels = append(labels, prompb.Label{Name: symbols[ref]})
+					} else {
+						labels[len(labels)-1].Value = symbols[ref]
+					}
+					refs++
+					return nil
+				})
+			case num == 2 && typ == protowire.BytesType:
+				s, err := decodeSampleV2(b)
+				if err != nil {
+					return err
+				}
+				samples = append(samples, s)
+			case num == 3 && typ == protowire.BytesType:
+				histograms = histogram.AppendRaw(histograms, b)
+				stats.histograms++
+			case num == 4 && typ == protowire.BytesType:
+				stats.exemplars++
+			case num == 5 && typ == protowire.BytesType:
+				var err error
+				md, err = decodeMetadataV2(b, symbols)
+				return err
+			}
+			return nil
+		})
+		if err != nil {
+			return stats, invalidWriteV2(err)
+		}
+		if refs%2 != 0 {
+			return stats, fmt.Errorf("%w: odd number of label references", errInvalidWriteV2)
+		}
+		req.Timeseries = append(req.Timeseries, prompb.TimeSeries{
+			Labels:  labels[labelsStart:len(labels):len(labels)],
+			Samples: samples[samplesStart:len(samples):len(samples)],
+
+			XXX_unrecognized: histograms,
+		})
+		if md.Type != prompb.MetricMetadata_UNKNOWN || md.Help != "" || md.Unit != "" {
+			appendMetadataV2(req, labels[labelsStart:], md)
+		}
+	}
+	return stats, nil
+}
+
+// decodeMetadataV2 decodes an io.prometheus.write.v2.Metadata, whose family name is left empty.
+func decodeMetadataV2(buf []byte, symbols []string) (prompb.MetricMetadata, error) {
+	var md prompb.MetricMetadata
+	err := utils.WalkFields(buf, func(num protowire.Number, typ protowire.Type, b []byte) error {
+		if typ != protowire.VarintType {
+			return nil
+		}
+		v, _ := protowire.ConsumeVarint(b)
+		switch num {
+		case 1:
+			md.Type = prompb.MetricMetadata_MetricType(v)
+		case 3, 4:
+			if v >= uint64(len(symbols)) {
+				return fmt.Errorf("%w: symbol reference %d out of %d symbols", errInvalidWriteV2, v, len(symbols))
+			}
+			if num == 3 {
+				md.Help = symbols[v]
+			} else {
+				md.Unit = symbols[v]
+			}
+		}
+		return nil
+	})
+	return md, err
+}
+
+// appendMetadataV2 adds the metadata of a time series to the metadata of req, named after the family
+// of its metric name, unless the previous time series had the same.
+func appendMetadataV2(req *prompb.WriteRequest, labels []prompb.Label, md prompb.MetricMetadata) {
+	for _, l := range labels {
+		if l.Name == model.MetricNameLabel {
+			md.MetricFamilyName = metadata.FamilyName(l.Value, metadata.TypeFromProto(md.Type))
+			break
+		}
+	}
+	if md.MetricFamilyName == "" {
+		return
+	}
+	if n := len(req.Metadata); n > 0 {
+		last := &req.Metadata[n-1]
+		if last.MetricFamilyName == md.MetricFamilyName && last.Type == md.Type && last.Help == md.Help && last.Unit == md.Unit {
+			return
+		}
+	}
+	req.Metadata = append(req.Metadata, md)
+}
+
+// decodeSampleV2 decodes an io.prometheus.write.v2.Sample.
+func decodeSampleV2(buf []byte) (prompb.Sample, error) {
+	var s prompb.Sample
+	err := utils.WalkFields(buf, func(num protowire.Number, typ protowire.Type, b []byte) error {
+		switch {
+		case num == 1 && typ == protowire.Fixed64Type:
+			v, _ := protowire.ConsumeFixed64(b)
+			s.Value = math.Float64frombits(v)
+		case num == 2 && typ == protowire.VarintType:
+			v, _ := protowire.ConsumeVarint(b)
+			s.Timestamp = int64(v)
+		}
+		return nil
+	})
+	return s, err
+}
+
+// invalidWriteV2 reports a request which is not a valid protobuf message as an invalid remote write 2.0 request.
+func invalidWriteV2(err error) error {
+	if errors.Is(err, utils.ErrInvalidProtobuf) && !errors.Is(err, errInvalidWriteV2) {
+		return fmt.Errorf("%w: %w", errInvalidWriteV2, err)
+	}
+	return err
+}
+
+// walkRefs calls fn with each symbol reference of a packed or unpacked repeated uint32 field.
+func walkRefs(typ protowire.Type, b []byte, fn func(ref uint64) error) error {
+	switch typ {
+	case protowire.VarintType:
+		ref, _ := protowire.ConsumeVarint(b)
+		return fn(ref)
+	case protowire.BytesType:
+		for len(b) > 0 {
+			ref, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return fmt.Errorf("%w: %v", errInvalidWriteV2, protowire.ParseError(n))
+			}
+			if err := fn(ref); err != nil {
+				return err
+			}
+			b = b[n:]
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: unexpected wire type %d of label references", errInvalidWriteV2, typ)
+	}
+}
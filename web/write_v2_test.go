@@ -0,0 +1,298 @@
+// Copyright 2024-2025 NetCracker Technology Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package web
+
+import (
+	"bytes"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Netcracker/qubership-graphite-remote-adapter/config"
+	"github.com/golang/snappy"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// seriesV2 is an io.prometheus.write.v2.TimeSeries to encode.
+type seriesV2 struct {
+	refs       []uint64
+	samples    []prompb.Sample
+	histograms int
+	exemplars  int
+	// Type, help and unit references of the metadata, if any.
+	metadata []uint64
+}
+
+// encodeWriteV2 encodes an io.prometheus.write.v2.Request, with the time series before the symbols.
+func encodeWriteV2(symbols []string, series ...seriesV2) []byte {
+	var buf []byte
+	for _, s := range series {
+		var ts, refs []byte
+		for _, ref := range s.refs {
+			refs = protowire.AppendVarint(refs, ref)
+		}
+		ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+		ts = protowire.AppendBytes(ts, refs)
+		for _, sample := range s.samples {
+			var b []byte
+			b = protowire.AppendTag(b, 1, protowire.Fixed64Type)
+			b = protowire.AppendFixed64(b, math.Float64bits(sample.Value))
+			b = protowire.AppendTag(b, 2, protowire.VarintType)
+			b = protowire.AppendVarint(b, uint64(sample.Timestamp))
+			ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, b)
+		}
+		for i := 0; i < s.histograms; i++ {
+			var b []byte
+			b = protowire.AppendTag(b, 1, protowire.VarintType)
+			b = protowire.AppendVarint(b, 0)
+			ts = protowire.AppendTag(ts, 3, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, b)
+		}
+		for i := 0; i < s.exemplars; i++ {
+			ts = protowire.AppendTag(ts, 4, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, nil)
+		}
+		if s.metadata != nil {
+			var b []byte
+			for i, v := range s.metadata {
+				b = protowire.AppendTag(b, []protowire.Number{1, 3, 4}[i], protowire.VarintType)
+				b = protowire.AppendVarint(b, v)
+			}
+			ts = protowire.AppendTag(ts, 5, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, b)
+		}
+		buf = protowire.AppendTag(buf, 5, protowire.BytesType)
+		buf = protowire.AppendBytes(buf, ts)
+	}
+	for _, symbol := range symbols {
+		buf = protowire.AppendTag(buf, 4, protowire.BytesType)
+		buf = protowire.AppendString(buf, symbol)
+	}
+	return buf
+}
+
+var testSymbols = []string{"", "__name__", "http_requests_total", "job", "app", "Requests.", "requests"}
+
+func TestDecodeWriteV2(t *testing.T) {
+	valid := encodeWriteV2(testSymbols,
+		seriesV2{
+			refs:     []uint64{1, 2, 3, 4},
+			samples:  []prompb.Sample{{Value: 1, Timestamp: 1000}, {Value: 2, Timestamp: 2000}},
+			metadata: []uint64{uint64(prompb.MetricMetadata_COUNTER), 5, 6},
+		},
+		seriesV2{
+			refs:       []uint64{1, 2},
+			histograms: 2,
+			exemplars:  1,
+		},
+	)
+
+	tests := []struct {
+		name            string
+		buf             []byte
+		expectSeries    []prompb.TimeSeries
+		expectMetadata  []prompb.MetricMetadata
+		expectStats     writeV2Stats
+		expectErr       bool
+		expectErrSubstr string
+	}{
+		{
+			name: "valid",
+			buf:  valid,
+			expectSeries: []prompb.TimeSeries{
+				{
+					Labels:  []prompb.Label{{Name: "__name__", Value: "http_requests_total"}, {Name: "job", Value: "app"}},
+					Samples: []prompb.Sample{{Value: 1, Timestamp: 1000}, {Value: 2, Timestamp: 2000}},
+				},
+				{
+					Labels: []prompb.Label{{Name: "__name__", Value: "http_requests_total"}},
+				},
+			},
+			expectMetadata: []prompb.MetricMetadata{
+				{Type: prompb.MetricMetadata_COUNTER, MetricFamilyName: "http_requests", Help: "Requests.", Unit: "requests"},
+			},
+			expectStats: writeV2Stats{histograms: 2, exemplars: 1},
+		},
+		{
+			name:         "empty",
+			buf:          nil,
+			expectSeries: nil,
+		},
+		{
+			name:            "label reference out of range",
+			buf:             encodeWriteV2(testSymbols, seriesV2{refs: []uint64{1, 7}}),
+			expectErr:       true,
+			expectErrSubstr: "symbol reference 7 out of 7 symbols",
+		},
+		{
+			name:            "metadata reference out of range",
+			buf:             encodeWriteV2(testSymbols, seriesV2{refs: []uint64{1, 2}, metadata: []uint64{1, 42}}),
+			expectErr:       true,
+			expectErrSubstr: "symbol reference 42 out of 7 symbols",
+		},
+		{
+			name:            "odd number of label references",
+			buf:             encodeWriteV2(testSymbols, seriesV2{refs: []uint64{1, 2, 3}}),
+			expectErr:       true,
+			expectErrSubstr: "odd number of label references",
+		},
+		{
+			name:      "truncated symbols",
+			buf:       valid[:len(valid)-3],
+			expectErr: true,
+		},
+		{
+			name:      "truncated time series",
+			buf:       valid[:10],
+			expectErr: true,
+		},
+		{
+			name:      "truncated tag",
+			buf:       []byte{0x80},
+			expectErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var req prompb.WriteRequest
+			stats, err := decodeWriteV2(test.buf, &req)
+			if test.expectErr {
+				require.ErrorIs(t, err, errInvalidWriteV2)
+				require.ErrorContains(t, err, test.expectErrSubstr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expectStats, stats)
+			require.Len(t, req.Timeseries, len(test.expectSeries))
+			for i, ts := range req.Timeseries {
+				require.Equal(t, test.expectSeries[i].Labels, ts.Labels)
+				require.Equal(t, len(test.expectSeries[i].Samples), len(ts.Samples))
+				if len(ts.Samples) > 0 {
+					require.Equal(t, test.expectSeries[i].Samples, ts.Samples)
+				}
+			}
+			require.Equal(t, test.expectMetadata, req.Metadata)
+		})
+	}
+}
+
+func TestWriteV2(t *testing.T) {
+	body := snappy.Encode(nil, encodeWriteV2(testSymbols,
+		seriesV2{refs: []uint64{1, 2, 3, 4}, samples: []prompb.Sample{{Value: 1, Timestamp: 1000}, {Value: 2, Timestamp: 2000}}},
+		seriesV2{refs: []uint64{1, 2}, histograms: 1, exemplars: 2},
+	))
+	v1Body := encodeWriteRequest(t, &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{{
+		Labels:  []prompb.Label{{Name: "__name__", Value: "metric"}},
+		Samples: []prompb.Sample{{Value: 1, Timestamp: 1000}},
+	}}})
+
+	tests := []struct {
+		name          string
+		body          []byte
+		contentType   string
+		version       string
+		expectStatus  int
+		expectHeaders []string // samples, histograms and exemplars written
+		expectSamples int64
+	}{
+		{
+			name:          "remote write 2.0",
+			body:          body,
+			contentType:   "application/x-protobuf;proto=io.prometheus.write.v2.Request",
+			version:       "2.0.0",
+			expectStatus:  http.StatusOK,
+			expectHeaders: []string{"2", "0", "0"},
+			expectSamples: 2,
+		},
+		{
+			name:          "message of the version header",
+			body:          body,
+			contentType:   "application/x-protobuf",
+			version:       "2.0.0",
+			expectStatus:  http.StatusOK,
+			expectHeaders: []string{"2", "0", "0"},
+			expectSamples: 2,
+		},
+		{
+			name:          "remote write 1.0",
+			body:          v1Body,
+			contentType:   "application/x-protobuf",
+			version:       "0.1.0",
+			expectStatus:  http.StatusOK,
+			expectHeaders: []string{"", "", ""},
+			expectSamples: 1,
+		},
+		{
+			name:          "unknown version",
+			body:          body,
+			contentType:   "application/x-protobuf;proto=io.prometheus.write.v2.Request",
+			version:       "3.0.0",
+			expectStatus:  http.StatusUnsupportedMediaType,
+			expectHeaders: []string{"", "", ""},
+		},
+		{
+			name:          "version not matching the message",
+			body:          body,
+			contentType:   "application/x-protobuf;proto=io.prometheus.write.v2.Request",
+			version:       "0.1.0",
+			expectStatus:  http.StatusUnsupportedMediaType,
+			expectHeaders: []string{"", "", ""},
+		},
+		{
+			name:          "unknown message",
+			body:          body,
+			contentType:   "application/x-protobuf;proto=io.prometheus.write.v3.Request",
+			expectStatus:  http.StatusUnsupportedMediaType,
+			expectHeaders: []string{"", "", ""},
+		},
+		{
+			name:          "truncated",
+			body:          snappy.Encode(nil, []byte{0x2a, 0x05, 0x08}),
+			contentType:   "application/x-protobuf;proto=io.prometheus.write.v2.Request",
+			version:       "2.0.0",
+			expectStatus:  http.StatusBadRequest,
+			expectHeaders: []string{"0", "0", "0"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := config.DefaultConfig
+			writer := &fakeWriter{name: "fake"}
+			h := newTestHandler(&cfg, writer)
+
+			r := httptest.NewRequest(http.MethodPost, "/write", bytes.NewReader(test.body))
+			r.Header.Set("Content-Type", test.contentType)
+			r.Header.Set("Content-Encoding", "snappy")
+			if test.version != "" {
+				r.Header.Set(writeVersionHeader, test.version)
+			}
+			rec := httptest.NewRecorder()
+			h.write(rec, r)
+
+			require.Equal(t, test.expectStatus, rec.Code, rec.Body.String())
+			require.Equal(t, test.expectHeaders, []string{
+				rec.Header().Get(writtenSamplesHeader),
+				rec.Header().Get(writtenHistogramsHeader),
+				rec.Header().Get(writtenExemplarsHeader),
+			})
+			require.Equal(t, test.expectSamples, writer.samples.Load())
+		})
+	}
+}